@@ -0,0 +1,57 @@
+package main
+
+import "time"
+
+// Age buckets of the summary, by upper bound in days.
+var ageBuckets = []struct {
+	name    string
+	maxDays int
+}{
+	{"<90d", 90},
+	{"90d-1y", 365},
+	{"1y-2y", 2 * 365},
+	{">2y", -1},
+}
+
+// ageDays returns the whole days between created and now, or nil when the
+// creation time is unknown.
+func ageDays(created *time.Time, now time.Time) *int {
+	if created == nil || created.IsZero() {
+		return nil
+	}
+	days := int(now.Sub(*created) / (24 * time.Hour))
+	if days < 0 {
+		days = 0
+	}
+	return &days
+}
+
+// setAges sets the age of the clusters and projects of inv at the time it
+// was collected. Ages are computed after collection so unchanged clusters
+// reused by differential sync still age.
+func setAges(inv *Inventory) {
+	for i := range inv.Clusters {
+		inv.Clusters[i].AgeDays = ageDays(inv.Clusters[i].Created, inv.GeneratedAt)
+	}
+	for i := range inv.Projects {
+		inv.Projects[i].AgeDays = ageDays(inv.Projects[i].Created, inv.GeneratedAt)
+	}
+}
+
+// ageBucket returns the summary bucket of an age in days.
+func ageBucket(days int) string {
+	for _, bucket := range ageBuckets {
+		if bucket.maxDays < 0 || days < bucket.maxDays {
+			return bucket.name
+		}
+	}
+	return ""
+}
+
+// dueForRefresh reports whether a cluster is older than a year and runs a
+// Kubernetes release past its end of life, the first candidates for a
+// lifecycle refresh.
+func dueForRefresh(cluster Cluster) bool {
+	return cluster.AgeDays != nil && *cluster.AgeDays >= 365 &&
+		cluster.KubernetesEOL != nil && cluster.KubernetesEOL.Status == eolReached
+}
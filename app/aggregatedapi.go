@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// The serve API doubles as a Kubernetes aggregated API server: registered
+// with an APIService, kube-apiserver proxies requests for the
+// inventory.scriba.io group to it, so `kubectl get rancherclusters` works
+// and access is governed by RBAC on the group's resources. kube-apiserver
+// authenticates and authorizes the user; scriba authenticates
+// kube-apiserver's proxy by its client certificate (--tls-client-ca-file).
+const (
+	aggregatedGroup   = "inventory.scriba.io"
+	aggregatedVersion = "v1alpha1"
+)
+
+var aggregatedGroupVersion = aggregatedGroup + "/" + aggregatedVersion
+
+// RancherCluster is a cluster of the inventory as an object of the
+// aggregated API.
+type RancherCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Status            Cluster `json:"status"`
+}
+
+// RancherProject is a project of the inventory as an object of the
+// aggregated API, named <cluster ID>.<project ID>.
+type RancherProject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Status            Project `json:"status"`
+}
+
+// aggregatedResource is a resource of the aggregated API: how its objects
+// are built from the inventory and shown by kubectl.
+type aggregatedResource struct {
+	name    string
+	kind    string
+	columns []metav1.TableColumnDefinition
+	objects func(inv *Inventory) []aggregatedObject
+}
+
+type aggregatedObject struct {
+	meta   *metav1.ObjectMeta
+	object interface{}
+	cells  []interface{}
+}
+
+var aggregatedResources = []aggregatedResource{
+	{
+		name: "rancherclusters",
+		kind: "RancherCluster",
+		columns: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Rancher cluster ID."},
+			{Name: "Display Name", Type: "string", Description: "Name of the cluster in Rancher."},
+			{Name: "State", Type: "string", Description: "Rancher cluster state."},
+			{Name: "Provider", Type: "string", Description: "Cluster provider."},
+			{Name: "Version", Type: "string", Description: "Kubernetes version."},
+			{Name: "Nodes", Type: "integer", Description: "Number of nodes."},
+		},
+		objects: func(inv *Inventory) []aggregatedObject {
+			var objects []aggregatedObject
+			for _, cluster := range inv.Clusters {
+				obj := &RancherCluster{
+					TypeMeta:   metav1.TypeMeta{APIVersion: aggregatedGroupVersion, Kind: "RancherCluster"},
+					ObjectMeta: metav1.ObjectMeta{Name: cluster.ID, Labels: cluster.Labels},
+					Status:     cluster,
+				}
+				objects = append(objects, aggregatedObject{
+					meta:   &obj.ObjectMeta,
+					object: obj,
+					cells:  []interface{}{cluster.ID, cluster.Name, cluster.State, cluster.Provider, cluster.KubernetesVersion(), cluster.NodeCount},
+				})
+			}
+			return objects
+		},
+	},
+	{
+		name: "rancherprojects",
+		kind: "RancherProject",
+		columns: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "<cluster ID>.<project ID>."},
+			{Name: "Display Name", Type: "string", Description: "Name of the project in Rancher."},
+			{Name: "Cluster", Type: "string", Description: "Rancher cluster ID."},
+		},
+		objects: func(inv *Inventory) []aggregatedObject {
+			var objects []aggregatedObject
+			for _, project := range inv.Projects {
+				clusterID, projectID := splitProjectID(project)
+				obj := &RancherProject{
+					TypeMeta:   metav1.TypeMeta{APIVersion: aggregatedGroupVersion, Kind: "RancherProject"},
+					ObjectMeta: metav1.ObjectMeta{Name: clusterID + "." + projectID, Annotations: project.Annotations},
+					Status:     project,
+				}
+				objects = append(objects, aggregatedObject{
+					meta:   &obj.ObjectMeta,
+					object: obj,
+					cells:  []interface{}{obj.Name, project.Name, clusterID},
+				})
+			}
+			return objects
+		},
+	},
+}
+
+// handleAggregatedAPI serves discovery and the read-only resources of the
+// aggregated API under /apis.
+func (s *server) handleAggregatedAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, "the inventory is read-only")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/apis"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		writeAPIObject(w, &metav1.APIGroupList{
+			TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"},
+			Groups:   []metav1.APIGroup{aggregatedAPIGroup()},
+		})
+		return
+	case parts[0] != aggregatedGroup:
+		writeAPIStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	case len(parts) == 1:
+		group := aggregatedAPIGroup()
+		group.TypeMeta = metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"}
+		writeAPIObject(w, &group)
+		return
+	case parts[1] != aggregatedVersion:
+		writeAPIStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	case len(parts) == 2:
+		list := &metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: aggregatedGroupVersion,
+		}
+		for _, res := range aggregatedResources {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:         res.name,
+				SingularName: strings.TrimSuffix(res.name, "s"),
+				Kind:         res.kind,
+				Verbs:        metav1.Verbs{"get", "list"},
+				Categories:   []string{"rancher"},
+			})
+		}
+		writeAPIObject(w, list)
+		return
+	}
+
+	var res *aggregatedResource
+	for i := range aggregatedResources {
+		if aggregatedResources[i].name == parts[2] {
+			res = &aggregatedResources[i]
+		}
+	}
+	if res == nil || len(parts) > 4 {
+		writeAPIStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	}
+	if r.URL.Query().Get("watch") == "true" {
+		writeAPIStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, "watch is not supported")
+		return
+	}
+
+	inv := scopeInventory(s.latest(), requestTenant(r))
+	if inv == nil {
+		writeAPIStatus(w, http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable, "inventory not collected yet")
+		return
+	}
+	objects := res.objects(inv)
+
+	if len(parts) == 4 {
+		for _, obj := range objects {
+			if obj.meta.Name == parts[3] {
+				writeAggregatedObjects(w, r, res, []aggregatedObject{obj}, true)
+				return
+			}
+		}
+		writeAPIStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("%s %q not found", res.name, parts[3]))
+		return
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeAPIStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+	var selected []aggregatedObject
+	for _, obj := range objects {
+		if selector.Matches(labels.Set(obj.meta.Labels)) {
+			selected = append(selected, obj)
+		}
+	}
+	writeAggregatedObjects(w, r, res, selected, false)
+}
+
+func aggregatedAPIGroup() metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{GroupVersion: aggregatedGroupVersion, Version: aggregatedVersion}
+	return metav1.APIGroup{
+		Name:             aggregatedGroup,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+// writeAggregatedObjects writes a single object or a list of objects, as a
+// Table when the client asks for one, as kubectl get does.
+func writeAggregatedObjects(w http.ResponseWriter, r *http.Request, res *aggregatedResource, objects []aggregatedObject, single bool) {
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		table := &metav1.Table{
+			TypeMeta:          metav1.TypeMeta{Kind: "Table", APIVersion: "meta.k8s.io/v1"},
+			ColumnDefinitions: res.columns,
+			Rows:              []metav1.TableRow{},
+		}
+		for _, obj := range objects {
+			raw, err := json.Marshal(obj.object)
+			if err != nil {
+				writeAPIStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+				return
+			}
+			table.Rows = append(table.Rows, metav1.TableRow{Cells: obj.cells, Object: runtime.RawExtension{Raw: raw}})
+		}
+		writeAPIObject(w, table)
+		return
+	}
+
+	if single {
+		writeAPIObject(w, objects[0].object)
+		return
+	}
+	items := make([]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		items = append(items, obj.object)
+	}
+	writeAPIObject(w, map[string]interface{}{
+		"apiVersion": aggregatedGroupVersion,
+		"kind":       res.kind + "List",
+		"metadata":   metav1.ListMeta{},
+		"items":      items,
+	})
+}
+
+func writeAPIObject(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(obj)
+}
+
+// writeAPIStatus writes an error as a Kubernetes Status, which kubectl
+// shows as the error message.
+func writeAPIStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
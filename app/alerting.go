@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AlertingConfig configures the alerts opened in serve mode when syncs keep
+// failing. An alert is opened once FailureThreshold consecutive syncs
+// failed or no sync succeeded for MaxStaleness, and resolved by the next
+// successful sync.
+type AlertingConfig struct {
+	PagerDutyRoutingKey string `json:"pagerDutyRoutingKey,omitempty"`
+	PagerDutyURL        string `json:"pagerDutyURL,omitempty"`
+	OpsgenieAPIKey      string `json:"opsgenieAPIKey,omitempty"`
+	OpsgenieURL         string `json:"opsgenieURL,omitempty"`
+
+	FailureThreshold int             `json:"failureThreshold,omitempty"`
+	MaxStaleness     metav1.Duration `json:"maxStaleness,omitempty"`
+}
+
+func (a *AlertingConfig) enabled() bool {
+	return a.PagerDutyRoutingKey != "" || a.OpsgenieAPIKey != ""
+}
+
+func validateAlerting(a *AlertingConfig) error {
+	if a.FailureThreshold < 0 {
+		return fmt.Errorf("alert failure threshold must not be negative, got %d", a.FailureThreshold)
+	}
+	if a.MaxStaleness.Duration < 0 {
+		return fmt.Errorf("alert max staleness must not be negative, got %s", a.MaxStaleness.Duration)
+	}
+	return nil
+}
+
+// alertState tracks the sync outcomes alerts are based on.
+type alertState struct {
+	failures    int
+	lastSuccess time.Time
+	open        bool
+}
+
+// alertKey identifies the alert of one scriba deployment or sync profile,
+// so repeated triggers are deduplicated and the resolve matches the
+// trigger. It is used in Opsgenie URL paths and therefore omits the URL
+// scheme.
+func alertKey(cfg *Config) string {
+	host := cfg.RancherURL
+	if u, err := url.Parse(cfg.RancherURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if cfg.syncProfile != "" {
+		return "rancher-scriba:" + host + ":" + cfg.syncProfile
+	}
+	return "rancher-scriba:" + host
+}
+
+// recordSync updates the alert state with the outcome of a sync and opens
+// or resolves the alert accordingly.
+func (a *alertState) recordSync(ctx context.Context, cfg *Config, syncErr error) {
+	if !cfg.Alerting.enabled() {
+		return
+	}
+
+	now := time.Now()
+	if syncErr == nil {
+		a.failures = 0
+		a.lastSuccess = now
+		if a.open {
+			log.Printf("Sync recovered, resolving alert")
+			if err := resolveAlert(ctx, cfg); err != nil {
+				log.Printf("Error resolving alert: %v", err)
+				return
+			}
+			a.open = false
+		}
+		return
+	}
+
+	a.failures++
+	if a.open {
+		return
+	}
+
+	var reason string
+	switch {
+	case cfg.Alerting.FailureThreshold > 0 && a.failures >= cfg.Alerting.FailureThreshold:
+		reason = fmt.Sprintf("%d consecutive syncs failed", a.failures)
+	case cfg.Alerting.MaxStaleness.Duration > 0 && now.Sub(a.lastSuccess) > cfg.Alerting.MaxStaleness.Duration:
+		reason = fmt.Sprintf("no successful sync for %s", now.Sub(a.lastSuccess).Round(time.Second))
+	default:
+		return
+	}
+
+	log.Printf("Opening alert: %s", reason)
+	if err := triggerAlert(ctx, cfg, reason, syncErr); err != nil {
+		log.Printf("Error opening alert: %v", err)
+		return
+	}
+	a.open = true
+}
+
+// triggerAlert opens the alert with every configured provider.
+func triggerAlert(ctx context.Context, cfg *Config, reason string, syncErr error) error {
+	summary := fmt.Sprintf("rancher-scriba: %s for %s", reason, cfg.RancherURL)
+
+	var errs []error
+	if cfg.Alerting.PagerDutyRoutingKey != "" {
+		if err := sendPagerDutyEvent(ctx, cfg, "trigger", summary, syncErr); err != nil {
+			errs = append(errs, fmt.Errorf("PagerDuty: %w", err))
+		}
+	}
+	if cfg.Alerting.OpsgenieAPIKey != "" {
+		body, err := json.Marshal(map[string]string{
+			"message":     summary,
+			"alias":       alertKey(cfg),
+			"description": syncErr.Error(),
+			"priority":    "P2",
+			"source":      "rancher-scriba",
+		})
+		if err == nil {
+			err = postJSONHeader(ctx, strings.TrimSuffix(cfg.Alerting.OpsgenieURL, "/")+"/v2/alerts", opsgenieHeader(cfg), body)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Opsgenie: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolveAlert resolves the alert with every configured provider.
+func resolveAlert(ctx context.Context, cfg *Config) error {
+	var errs []error
+	if cfg.Alerting.PagerDutyRoutingKey != "" {
+		if err := sendPagerDutyEvent(ctx, cfg, "resolve", "", nil); err != nil {
+			errs = append(errs, fmt.Errorf("PagerDuty: %w", err))
+		}
+	}
+	if cfg.Alerting.OpsgenieAPIKey != "" {
+		u := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias",
+			strings.TrimSuffix(cfg.Alerting.OpsgenieURL, "/"), url.PathEscape(alertKey(cfg)))
+		if err := postJSONHeader(ctx, u, opsgenieHeader(cfg), []byte(`{"source":"rancher-scriba"}`)); err != nil {
+			errs = append(errs, fmt.Errorf("Opsgenie: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendPagerDutyEvent sends an Events API v2 event. Only trigger events
+// carry a payload.
+func sendPagerDutyEvent(ctx context.Context, cfg *Config, action, summary string, syncErr error) error {
+	event := map[string]interface{}{
+		"routing_key":  cfg.Alerting.PagerDutyRoutingKey,
+		"event_action": action,
+		"dedup_key":    alertKey(cfg),
+	}
+	if action == "trigger" {
+		event["payload"] = map[string]interface{}{
+			"summary":  summary,
+			"source":   cfg.RancherURL,
+			"severity": "error",
+			"custom_details": map[string]string{
+				"error": syncErr.Error(),
+			},
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, cfg.Alerting.PagerDutyURL, body)
+}
+
+func opsgenieHeader(cfg *Config) http.Header {
+	return http.Header{"Authorization": {"GenieKey " + cfg.Alerting.OpsgenieAPIKey}}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// APIConfig secures the serve-mode HTTP API. When tokens or a client CA
+// are configured, every endpoint except /healthz requires a bearer token
+// or a client certificate signed by the CA.
+type APIConfig struct {
+	// Tokens are accepted as bearer tokens. TokenFile holds further
+	// tokens, one per line, and is re-read on every request so it can be
+	// rotated without a restart.
+	Tokens       []string `json:"tokens,omitempty"`
+	TokenFile    string   `json:"tokenFile,omitempty"`
+	ClientCAFile string   `json:"clientCAFile,omitempty"`
+
+	// Tenants are further bearer tokens, each seeing only part of the
+	// inventory.
+	Tenants []APITenant `json:"tenants,omitempty"`
+
+	// The serving certificate is read from TLSCertFile and TLSKeyFile or
+	// from a kubernetes.io/tls Secret in scriba's own namespace, and
+	// reloaded when it changes.
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+	TLSSecret   string `json:"tlsSecret,omitempty"`
+}
+
+func (a *APIConfig) authEnabled() bool {
+	return len(a.Tokens) > 0 || a.TokenFile != "" || a.ClientCAFile != "" || len(a.Tenants) > 0
+}
+
+func (a *APIConfig) tlsEnabled() bool {
+	return a.TLSCertFile != "" || a.TLSSecret != ""
+}
+
+func validateAPI(a *APIConfig) error {
+	if (a.TLSCertFile == "") != (a.TLSKeyFile == "") {
+		return errors.New("--tls-cert-file and --tls-key-file must be set together")
+	}
+	if a.TLSCertFile != "" && a.TLSSecret != "" {
+		return errors.New("--tls-cert-file and --tls-secret are mutually exclusive")
+	}
+	if a.ClientCAFile != "" && !a.tlsEnabled() {
+		return errors.New("--tls-client-ca-file requires a serving certificate (--tls-cert-file or --tls-secret)")
+	}
+	return validateAPITenants(a.Tenants)
+}
+
+// requireAuth rejects requests to next that carry neither a valid bearer
+// token nor a verified client certificate. Requests with a tenant's token
+// are passed on with the tenant, see requestTenant. The current
+// configuration is consulted on every request, so tokens can be changed by
+// a reload.
+func (s *server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api := &s.config().API
+		if !api.authEnabled() {
+			next(w, r)
+			return
+		}
+		if ok, tenant := authenticate(api, r); ok {
+			if tenant != nil {
+				r = withTenant(r, tenant)
+			}
+			next(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="rancher-scriba"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// authenticate reports whether the request is authenticated, and as which
+// tenant when it carries a tenant's token.
+func authenticate(api *APIConfig, r *http.Request) (bool, *APITenant) {
+	if api.ClientCAFile != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true, nil
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false, nil
+	}
+	tokens, err := apiTokens(api)
+	if err != nil {
+		log.Printf("Error reading API tokens: %v", err)
+	}
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true, nil
+		}
+	}
+	tenant, err := matchTenant(api, token)
+	if err != nil {
+		log.Printf("Error reading API tenant tokens: %v", err)
+	}
+	return tenant != nil, tenant
+}
+
+// apiTokens returns the configured tokens and those in the token file.
+func apiTokens(api *APIConfig) ([]string, error) {
+	tokens := api.Tokens
+	if api.TokenFile == "" {
+		return tokens, nil
+	}
+
+	data, err := os.ReadFile(api.TokenFile)
+	if err != nil {
+		return tokens, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens, nil
+}
+
+// serverTLSConfig returns the TLS configuration of the HTTP API, or nil
+// when it is served in plain HTTP.
+func serverTLSConfig(cfg *Config) (*tls.Config, error) {
+	if !cfg.API.tlsEnabled() {
+		return nil, nil
+	}
+
+	certs, err := newCertReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+
+	if cfg.API.ClientCAFile != "" {
+		data, err := os.ReadFile(cfg.API.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.API.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		// Client certificates are optional at the TLS level so /healthz
+		// stays reachable for probes; requireAuth enforces them.
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// certReloader serves the current certificate and reloads it from its
+// source every configPollInterval.
+type certReloader struct {
+	load func() (certPEM, keyPEM []byte, err error)
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newCertReloader(cfg *Config) (*certReloader, error) {
+	r := &certReloader{}
+	api := cfg.API
+	if api.TLSSecret != "" {
+		r.load = func() ([]byte, []byte, error) { return readTLSSecret(cfg, api.TLSSecret) }
+	} else {
+		r.load = func() ([]byte, []byte, error) { return readTLSFiles(api.TLSCertFile, api.TLSKeyFile) }
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	go r.watch()
+	return r, nil
+}
+
+func (r *certReloader) watch() {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := r.reload(); err != nil {
+			log.Printf("Error reloading serving certificate, keeping the current one: %v", err)
+		}
+	}
+}
+
+func (r *certReloader) reload() error {
+	certPEM, keyPEM, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("parsing serving certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	initial := r.cert == nil
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	r.mu.Unlock()
+	if !initial {
+		log.Printf("Reloaded serving certificate")
+	}
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func readTLSFiles(certFile, keyFile string) ([]byte, []byte, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading serving certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading serving certificate key: %w", err)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// readTLSSecret reads a kubernetes.io/tls Secret in scriba's own
+// namespace.
+func readTLSSecret(cfg *Config, name string) ([]byte, []byte, error) {
+	clientset, err := getKubeClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	namespace := ownNamespace(cfg)
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading TLS Secret %s/%s: %w", namespace, name, err)
+	}
+	certPEM, keyPEM := secret.Data["tls.crt"], secret.Data["tls.key"]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, nil, fmt.Errorf("TLS Secret %s/%s has no tls.crt and tls.key", namespace, name)
+	}
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// APITenant is a bearer token of the serve API that only sees a slice of
+// the inventory: the clusters matching ClusterSelector and, when Projects
+// is set, only those projects and their clusters. Tenants are configured
+// in the config file only.
+type APITenant struct {
+	// Name identifies the tenant in logs.
+	Name string `json:"name"`
+	// Token is the tenant's bearer token, or TokenFile a file holding it,
+	// re-read on every request so it can be rotated without a restart.
+	Token     string `json:"token,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+
+	ClusterSelector string `json:"clusterSelector,omitempty"`
+	// Projects are project IDs (<cluster ID>:<project ID>).
+	Projects []string `json:"projects,omitempty"`
+}
+
+func validateAPITenants(tenants []APITenant) error {
+	names := make(map[string]bool, len(tenants))
+	for _, t := range tenants {
+		if t.Name == "" {
+			return errors.New("every API tenant needs a name")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate API tenant %q", t.Name)
+		}
+		names[t.Name] = true
+		if (t.Token == "") == (t.TokenFile == "") {
+			return fmt.Errorf("API tenant %q needs exactly one of token and tokenFile", t.Name)
+		}
+		if _, err := labels.Parse(t.ClusterSelector); err != nil {
+			return fmt.Errorf("API tenant %q: invalid cluster selector: %w", t.Name, err)
+		}
+		for _, id := range t.Projects {
+			if clusterID, projectID, ok := strings.Cut(id, ":"); !ok || clusterID == "" || projectID == "" {
+				return fmt.Errorf("API tenant %q: invalid project ID %q, expected <cluster ID>:<project ID>", t.Name, id)
+			}
+		}
+	}
+	return nil
+}
+
+// tenantToken returns the tenant's current token.
+func (t *APITenant) tenantToken() (string, error) {
+	if t.TokenFile == "" {
+		return t.Token, nil
+	}
+	data, err := os.ReadFile(t.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading token of API tenant %s: %w", t.Name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// matchTenant returns the tenant whose token is token, if any.
+func matchTenant(api *APIConfig, token string) (*APITenant, error) {
+	var errs []error
+	for i := range api.Tenants {
+		t := &api.Tenants[i]
+		expected, err := t.tenantToken()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return t, nil
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+type tenantContextKey struct{}
+
+// requestTenant returns the tenant a request was authenticated as, or nil
+// for requests with full access.
+func requestTenant(r *http.Request) *APITenant {
+	t, _ := r.Context().Value(tenantContextKey{}).(*APITenant)
+	return t
+}
+
+func withTenant(r *http.Request, t *APITenant) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, t))
+}
+
+// denyTenants rejects requests of tenants to endpoints that are not
+// scoped, such as /metrics.
+func denyTenants(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requestTenant(r) != nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// scopeInventory returns the slice of inv visible to the tenant, or inv
+// itself for full access. Rancher-wide data that does not belong to any
+// cluster, the API tokens, authentication providers, orphaned projects and
+// Rancher-wide collector documents, is left out. Tenants restricted to
+// projects only see their projects, the clusters these live in, the
+// projects' namespaces and alert groups, and the multi-cluster apps and
+// global DNS entries targeting them, reduced to their targets among the
+// tenant's projects. Everything spanning a cluster or Rancher, such as
+// nodes, machine configs, cloud credentials, notifiers, chart
+// repositories, roles, drivers, features and collector documents, is left
+// out.
+func scopeInventory(inv *Inventory, t *APITenant) *Inventory {
+	if t == nil || inv == nil {
+		return inv
+	}
+	out := Profile{ClusterSelector: t.ClusterSelector}.selectClusters(inv)
+	out.AuthProviders, out.Tokens, out.Orphans = nil, nil, nil
+	out.Resources = selectResources(out.Resources, out.clusterIDs(), false)
+	if len(t.Projects) == 0 {
+		return out
+	}
+	out.Nodes, out.MachineConfigs, out.CloudCredentials, out.Notifiers, out.ChartRepos = nil, nil, nil, nil, nil
+	out.Roles, out.Drivers, out.Features, out.Resources = nil, nil, nil, nil
+
+	var projects []Project
+	clusters := make(map[string]bool)
+	for _, project := range out.Projects {
+		if containsString(t.Projects, project.ID) {
+			projects = append(projects, project)
+			clusters[project.ClusterID] = true
+		}
+	}
+	out.Projects = projects
+
+	var scoped []Cluster
+	for _, cluster := range out.Clusters {
+		if clusters[cluster.ID] {
+			scoped = append(scoped, cluster)
+		}
+	}
+	out.Clusters = scoped
+
+	var namespaces []Namespace
+	for _, ns := range out.Namespaces {
+		if containsString(t.Projects, ns.ProjectID) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	out.Namespaces = namespaces
+
+	var groups []AlertGroup
+	for _, group := range out.AlertGroups {
+		if containsString(t.Projects, group.ProjectID) {
+			groups = append(groups, group)
+		}
+	}
+	out.AlertGroups = groups
+
+	var apps []MultiClusterApp
+	for _, app := range out.MultiClusterApps {
+		var targets []MultiClusterAppTarget
+		for _, target := range app.Targets {
+			if containsString(t.Projects, target.ProjectID) {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) > 0 {
+			app.Targets = targets
+			apps = append(apps, app)
+		}
+	}
+	out.MultiClusterApps = apps
+
+	var entries []GlobalDNS
+	for _, dns := range out.GlobalDNS {
+		var projectIDs []string
+		for _, id := range dns.ProjectIDs {
+			if containsString(t.Projects, id) {
+				projectIDs = append(projectIDs, id)
+			}
+		}
+		if len(projectIDs) > 0 {
+			dns.ProjectIDs = projectIDs
+			entries = append(entries, dns)
+		}
+	}
+	out.GlobalDNS = entries
+	return out
+}
+
+// scopeEvents returns the change events visible to the tenant: those of
+// the clusters and projects in its slice of the current inventory.
+func scopeEvents(events *SyncEvents, inv *Inventory, t *APITenant) *SyncEvents {
+	if t == nil || events == nil {
+		return events
+	}
+	ids := scopeInventory(inv, t).clusterIDs()
+	out := &SyncEvents{GeneratedAt: events.GeneratedAt, Since: events.Since, Events: []ChangeEvent{}}
+	for _, event := range events.Events {
+		switch {
+		case event.Kind == kindCluster && ids[event.ID]:
+		case event.Kind == kindProject && ids[event.ClusterID] && (len(t.Projects) == 0 || containsString(t.Projects, event.ID)):
+		default:
+			continue
+		}
+		out.Events = append(out.Events, event)
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// rancherTokenSources holds the token source of each sync profile, by
+// profile name.
+var rancherTokenSources struct {
+	sync.Mutex
+	sources map[string]oauth2.TokenSource
+	errs    map[string]error
+}
+
+// getRancherToken returns the bearer token for Rancher API requests. The
+// token source is chosen once per sync profile from the configuration: an
+// OIDC client credentials grant, a Vault KV secret, an AWS Secrets Manager
+// secret or SSM parameter, a token file refreshed by an external process,
+// or the static RANCHER_TOKEN_KEY.
+func getRancherToken(cfg *Config) (string, error) {
+	source, err := rancherTokenSource(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := source.Token()
+	if err != nil {
+		return "", fmt.Errorf("obtaining Rancher token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+func rancherTokenSource(cfg *Config) (oauth2.TokenSource, error) {
+	ts := &rancherTokenSources
+	ts.Lock()
+	defer ts.Unlock()
+	if ts.sources == nil {
+		ts.sources = make(map[string]oauth2.TokenSource)
+		ts.errs = make(map[string]error)
+	}
+	if _, ok := ts.sources[cfg.syncProfile]; !ok {
+		ts.sources[cfg.syncProfile], ts.errs[cfg.syncProfile] = newRancherTokenSource(cfg)
+	}
+	return ts.sources[cfg.syncProfile], ts.errs[cfg.syncProfile]
+}
+
+// credentialSourceType returns the configured credential source type, or
+// infers it from the sources that are configured.
+func credentialSourceType(cs *CredentialSource) string {
+	switch {
+	case cs.Type != "":
+		return cs.Type
+	case cs.OIDC.TokenURL != "":
+		return credentialOIDC
+	case cs.Vault.SecretPath != "":
+		return credentialVault
+	case cs.AWS.SecretID != "":
+		return credentialAWSSecretsManager
+	case cs.AWS.Parameter != "":
+		return credentialAWSSSM
+	case cs.TokenFile != "":
+		return credentialFile
+	default:
+		return credentialStatic
+	}
+}
+
+func newRancherTokenSource(cfg *Config) (oauth2.TokenSource, error) {
+	cs := &cfg.CredentialSource
+
+	switch credentialSourceType(cs) {
+	case credentialOIDC:
+		if cs.OIDC.TokenURL == "" || cs.OIDC.ClientID == "" || cs.OIDC.ClientSecret == "" {
+			return nil, errors.New("OIDC token URL, client ID and secret are required for the oidc credential source")
+		}
+		log.Printf("Using OIDC client credentials from %s for Rancher authentication", cs.OIDC.TokenURL)
+		cc := &clientcredentials.Config{
+			ClientID:     cs.OIDC.ClientID,
+			ClientSecret: cs.OIDC.ClientSecret,
+			TokenURL:     cs.OIDC.TokenURL,
+			Scopes:       cs.OIDC.Scopes,
+		}
+		// The returned source caches the token and only requests a new one
+		// shortly before it expires.
+		return cc.TokenSource(context.Background()), nil
+	case credentialVault:
+		if cs.Vault.Addr == "" || cs.Vault.SecretPath == "" {
+			return nil, errors.New("VAULT_ADDR and VAULT_SECRET_PATH are required to read the Rancher token from Vault")
+		}
+		log.Printf("Using Vault secret %s at %s for Rancher authentication", cs.Vault.SecretPath, cs.Vault.Addr)
+		return newVaultTokenSource(&cs.Vault)
+	case credentialAWSSecretsManager:
+		if cs.AWS.SecretID == "" {
+			return nil, errors.New("credentialSource.aws.secretId is required for the awsSecretsManager credential source")
+		}
+		log.Printf("Using AWS Secrets Manager secret %s for Rancher authentication", cs.AWS.SecretID)
+		return newAWSTokenSource(&cs.AWS, credentialAWSSecretsManager)
+	case credentialAWSSSM:
+		if cs.AWS.Parameter == "" {
+			return nil, errors.New("credentialSource.aws.parameter is required for the awsSSM credential source")
+		}
+		log.Printf("Using AWS SSM parameter %s for Rancher authentication", cs.AWS.Parameter)
+		return newAWSTokenSource(&cs.AWS, credentialAWSSSM)
+	case credentialFile:
+		if cs.TokenFile == "" {
+			return nil, errors.New("RANCHER_TOKEN_FILE is required for the file credential source")
+		}
+		log.Printf("Using token file %s for Rancher authentication", cs.TokenFile)
+		return fileTokenSource(cs.TokenFile), nil
+	case credentialKeyring:
+		if cfg.RancherURL == "" {
+			return nil, errors.New("RANCHER_SERVER_URL is required for the keyring credential source")
+		}
+		log.Printf("Using the OS keychain token of %s for Rancher authentication", cfg.RancherURL)
+		return keyringTokenSource(cfg.RancherURL)
+	default:
+		// Without a token, fall back to the one stored by scriba login.
+		if cfg.RancherToken == "" && hasKeyringToken(cfg.RancherURL) {
+			log.Printf("Using the OS keychain token of %s for Rancher authentication", cfg.RancherURL)
+			return keyringTokenSource(cfg.RancherURL)
+		}
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cfg.RancherToken}), nil
+	}
+}
+
+// refreshingTokenSource caches a token read from a secret store and reads
+// it again once the refresh interval has passed, so rotations in the store
+// are picked up without a restart.
+type refreshingTokenSource struct {
+	store   string
+	refresh time.Duration
+	fetch   func() (string, error)
+
+	mu        sync.Mutex
+	token     string
+	fetchedAt time.Time
+}
+
+func (r *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token == "" || time.Since(r.fetchedAt) >= r.refresh {
+		token, err := r.fetch()
+		if err != nil {
+			if r.token == "" {
+				return nil, err
+			}
+			// Keep using the last token while the store is unavailable;
+			// Rancher will reject it once it is really revoked.
+			log.Printf("Error refreshing Rancher token from %s, reusing previous token: %v", r.store, err)
+		} else {
+			r.token, r.fetchedAt = token, time.Now()
+		}
+	}
+
+	return &oauth2.Token{AccessToken: r.token}, nil
+}
+
+// fileTokenSource reads the token from a file on every call, so rotations
+// by an external refresher (e.g. a sidecar or a projected Secret) are
+// picked up without a restart.
+type fileTokenSource string
+
+func (f fileTokenSource) Token() (*oauth2.Token, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", string(f))
+	}
+	return &oauth2.Token{AccessToken: token}, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+)
+
+// AuthProvider is a Rancher authentication provider (/v3/authConfigs) with
+// its non-secret settings.
+type AuthProvider struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Enabled    bool   `json:"enabled"`
+	AccessMode string `json:"accessMode,omitempty"`
+	// AllowedPrincipals counts the users and groups allowed to log in when
+	// the access mode restricts logins.
+	AllowedPrincipals int               `json:"allowedPrincipals"`
+	Settings          map[string]string `json:"settings,omitempty"`
+}
+
+// authProviderSettings lists the auth config fields recorded as settings.
+// Fields not listed, among them every password, key and client secret,
+// are never read into the inventory.
+var authProviderSettings = []string{
+	// LDAP (Active Directory, OpenLDAP, FreeIPA)
+	"servers", "port", "tls", "startTLS", "userSearchBase", "groupSearchBase", "nestedGroupMembershipEnabled",
+	// SAML (ADFS, Keycloak, Okta, Ping, Shibboleth)
+	"rancherApiHost", "entityID", "displayNameField", "userNameField", "uidField", "groupsField",
+	// OIDC, GitHub, Azure AD and Google
+	"issuer", "authEndpoint", "clientId", "hostname", "tenantId", "endpoint", "applicationId", "graphEndpoint", "adminEmail",
+}
+
+// getAuthProviders lists the authentication providers configured in
+// Rancher, enabled or not.
+func getAuthProviders(ctx context.Context, rancherAPIURL string, accessToken string) ([]AuthProvider, error) {
+	log.Println("Starting getAuthProviders function")
+
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/authConfigs", accessToken, "auth configs", &response); err != nil {
+		return nil, err
+	}
+
+	providers := make([]AuthProvider, 0, len(response.Data))
+	for _, item := range response.Data {
+		provider := AuthProvider{
+			ID:         stringField(item, "id"),
+			Type:       stringField(item, "type"),
+			AccessMode: stringField(item, "accessMode"),
+		}
+		provider.Enabled, _ = item["enabled"].(bool)
+		if principals, ok := item["allowedPrincipalIds"].([]interface{}); ok {
+			provider.AllowedPrincipals = len(principals)
+		}
+
+		for _, field := range authProviderSettings {
+			value := stringField(item, field)
+			if values, ok := item[field].([]interface{}); ok {
+				value = joinValues(values)
+			}
+			if value != "" {
+				if provider.Settings == nil {
+					provider.Settings = make(map[string]string)
+				}
+				provider.Settings[field] = value
+			}
+		}
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].ID < providers[j].ID })
+
+	log.Printf("Fetched %d auth providers", len(providers))
+	return providers, nil
+}
+
+// joinValues joins the scalar elements of a decoded JSON array with
+// commas.
+func joinValues(values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, scalarString(value))
+	}
+	return strings.Join(parts, ",")
+}
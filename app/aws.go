@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsClient reads the Rancher token from AWS Secrets Manager or SSM
+// Parameter Store. Credentials come from IRSA (the web identity token EKS
+// projects into the pod, exchanged through STS) or, outside EKS, from the
+// standard AWS_ACCESS_KEY_ID environment variables.
+type awsClient struct {
+	cfg    *AWSSource
+	client *http.Client
+
+	mu    sync.Mutex
+	creds awsCredentials
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+func newAWSTokenSource(cfg *AWSSource, sourceType string) (*refreshingTokenSource, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("an AWS region is required, set credentialSource.aws.region or AWS_REGION")
+	}
+
+	a := &awsClient{
+		cfg:    cfg,
+		client: &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}, Timeout: 30 * time.Second},
+	}
+
+	fetch, store := a.getSecretValue, "AWS Secrets Manager"
+	if sourceType == credentialAWSSSM {
+		fetch, store = a.getParameter, "AWS SSM"
+	}
+	return &refreshingTokenSource{store: store, refresh: cfg.Refresh.Duration, fetch: fetch}, nil
+}
+
+func (a *awsClient) getSecretValue() (string, error) {
+	log.Printf("Reading Rancher token from AWS Secrets Manager secret %s", a.cfg.SecretID)
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	in := map[string]string{"SecretId": a.cfg.SecretID}
+	if err := a.call("secretsmanager", "secretsmanager.GetSecretValue", in, &out); err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", a.cfg.SecretID, err)
+	}
+	return tokenFromSecretString(out.SecretString, a.cfg.Field)
+}
+
+func (a *awsClient) getParameter() (string, error) {
+	log.Printf("Reading Rancher token from AWS SSM parameter %s", a.cfg.Parameter)
+
+	var out struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	in := map[string]interface{}{"Name": a.cfg.Parameter, "WithDecryption": true}
+	if err := a.call("ssm", "AmazonSSM.GetParameter", in, &out); err != nil {
+		return "", fmt.Errorf("reading parameter %s: %w", a.cfg.Parameter, err)
+	}
+	return tokenFromSecretString(out.Parameter.Value, a.cfg.Field)
+}
+
+// tokenFromSecretString extracts the Rancher token from a secret value. A
+// JSON document is searched for field, or for the fields understood by
+// tokenFromFields; anything else is taken as the token itself.
+func tokenFromSecretString(value string, field string) (string, error) {
+	value = strings.TrimSpace(value)
+	if field == "" && !strings.HasPrefix(value, "{") {
+		if value == "" {
+			return "", errors.New("secret is empty")
+		}
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON document: %w", err)
+	}
+	if field == "" {
+		return tokenFromFields(fields)
+	}
+	token, _ := fields[field].(string)
+	if token == "" {
+		return "", fmt.Errorf("secret has no %s field", field)
+	}
+	return token, nil
+}
+
+// call invokes an action of an AWS JSON 1.1 API such as Secrets Manager or
+// SSM.
+func (a *awsClient) call(service string, target string, in interface{}, out interface{}) error {
+	creds, err := a.credentials()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", awsEndpoint(service, a.cfg.Region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, body, creds, a.cfg.Region, service, time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("unexpected status code from AWS %s: %d %s %s", service, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// credentials returns the AWS credentials, assuming the IRSA role again
+// shortly before the temporary credentials expire.
+func (a *awsClient) credentials() (awsCredentials, error) {
+	roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN == "" || tokenFile == "" {
+		if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+			return awsCredentials{}, errors.New("no AWS credentials: AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE (IRSA) or AWS_ACCESS_KEY_ID must be set")
+		}
+		return awsCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.creds.AccessKeyID != "" && time.Until(a.creds.Expiration) > 5*time.Minute {
+		return a.creds, nil
+	}
+
+	creds, err := a.assumeRoleWithWebIdentity(roleARN, tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("assuming role %s: %w", roleARN, err)
+	}
+	a.creds = creds
+	return creds, nil
+}
+
+func (a *awsClient) assumeRoleWithWebIdentity(roleARN string, tokenFile string) (awsCredentials, error) {
+	log.Printf("Assuming AWS role %s with web identity token %s", roleARN, tokenFile)
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = "rancher-scriba"
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	// AssumeRoleWithWebIdentity is authenticated by the token itself and
+	// is not signed.
+	resp, err := a.client.PostForm(awsEndpoint("sts", a.cfg.Region), form)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return awsCredentials{}, fmt.Errorf("unexpected status code from AWS STS: %d %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return awsCredentials{}, err
+	}
+	return awsCredentials(out.Credentials), nil
+}
+
+// awsEndpoint returns the regional endpoint of service. AWS_ENDPOINT_URL
+// overrides it, e.g. for VPC endpoints or local testing.
+func awsEndpoint(service string, region string) string {
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/"
+	}
+	return "https://" + service + "." + region + ".amazonaws.com/"
+}
+
+// signAWSRequest signs req with AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
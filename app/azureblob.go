@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AzureBlobConfig configures the Azure Blob Storage sink, which writes a
+// timestamped snapshot of the rendered ConfigMap data to a container after
+// every sync. Blobs are named
+// <prefix><namespace>/<configMap>/<timestamp>/<key>.
+type AzureBlobConfig struct {
+	Account   string `json:"account,omitempty"`
+	Container string `json:"container,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	// Endpoint defaults to https://<account>.blob.core.windows.net.
+	Endpoint string `json:"endpoint,omitempty"`
+	// SASToken authenticates with a shared access signature instead of a
+	// managed identity.
+	SASToken string `json:"sasToken,omitempty"`
+	// Retention deletes the snapshots of the ConfigMap it does not keep
+	// after every write.
+	Retention RetentionPolicy `json:"retention,omitempty"`
+}
+
+// azureSnapshotLayout formats the timestamp of a snapshot in blob names.
+const azureSnapshotLayout = "20060102T150405Z"
+
+func (a *AzureBlobConfig) enabled() bool {
+	return a.Container != ""
+}
+
+func (a *AzureBlobConfig) endpoint() string {
+	if a.Endpoint != "" {
+		return strings.TrimSuffix(a.Endpoint, "/")
+	}
+	return "https://" + a.Account + ".blob.core.windows.net"
+}
+
+func validateAzureBlob(a *AzureBlobConfig) error {
+	if !a.enabled() {
+		return nil
+	}
+	if a.Account == "" && a.Endpoint == "" {
+		return errors.New("an Azure storage account (--azure-storage-account) is required to write to Azure Blob Storage")
+	}
+	if strings.HasPrefix(a.Prefix, "/") {
+		return fmt.Errorf("Azure Blob prefix %q must not start with a slash", a.Prefix)
+	}
+	if a.Endpoint != "" {
+		if _, err := url.ParseRequestURI(a.Endpoint); err != nil {
+			return fmt.Errorf("invalid Azure Blob endpoint %q: %w", a.Endpoint, err)
+		}
+	}
+	return validateRetention("Azure Blob", &a.Retention)
+}
+
+const azureStorageResource = "https://storage.azure.com/"
+
+// azureToken caches the managed identity token for Azure Storage until
+// shortly before it expires.
+var azureToken struct {
+	sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// azureAccessToken returns a token for Azure Storage. With AKS Workload
+// Identity (AZURE_FEDERATED_TOKEN_FILE set by its webhook) the projected
+// service account token is exchanged with Microsoft Entra ID; otherwise the
+// managed identity of the node is used through the instance metadata
+// service. AZURE_CLIENT_ID selects a user-assigned identity.
+func azureAccessToken(client *http.Client) (string, error) {
+	azureToken.Lock()
+	defer azureToken.Unlock()
+	if azureToken.value != "" && time.Now().Before(azureToken.expires) {
+		return azureToken.value, nil
+	}
+
+	var req *http.Request
+	var err error
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		assertion, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading the federated token: %w", err)
+		}
+		authority := envString("AZURE_AUTHORITY_HOST", "https://login.microsoftonline.com/")
+		form := url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_id":             {clientID},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+			"scope":                 {azureStorageResource + ".default"},
+		}
+		req, err = http.NewRequest("POST", strings.TrimSuffix(authority, "/")+"/"+url.PathEscape(os.Getenv("AZURE_TENANT_ID"))+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureStorageResource}}
+		if clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		req, err = http.NewRequest("GET", "http://169.254.169.254/metadata/identity/oauth2/token?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata", "true")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting an Azure Storage token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("Azure token endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	// The instance metadata service returns expires_in as a string, Entra
+	// ID as a number.
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding the Azure Storage token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("Azure token endpoint returned no access token")
+	}
+	expiresIn, _ := token.ExpiresIn.Int64()
+
+	azureToken.value = token.AccessToken
+	azureToken.expires = time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute)
+	return azureToken.value, nil
+}
+
+// uploadToAzureBlob writes every rendered key as a blob of the snapshot
+// taken at generatedAt, encrypted for the configured age recipients.
+func uploadToAzureBlob(ctx context.Context, cfg *Config, generatedAt time.Time, rendered map[string]string) error {
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}, Timeout: 30 * time.Second}
+	dir := cfg.AzureBlob.Prefix + cfg.Namespace + "/" + cfg.ConfigMapName + "/" + generatedAt.UTC().Format(azureSnapshotLayout) + "/"
+
+	keys := make([]string, 0, len(rendered))
+	for key := range rendered {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		data, err := encryptOutput(cfg, []byte(rendered[key]))
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", key, err)
+		}
+		if err := withRetry(ctx, func() error { return putBlob(ctx, client, &cfg.AzureBlob, dir+key, data) }); err != nil {
+			return fmt.Errorf("writing blob %s/%s: %w", cfg.AzureBlob.Container, dir+key, err)
+		}
+	}
+	log.Printf("Wrote %d blobs to %s/%s/%s", len(keys), cfg.AzureBlob.endpoint(), cfg.AzureBlob.Container, dir)
+
+	if cfg.AzureBlob.Retention.enabled() {
+		pruneAzureBlobSnapshots(ctx, cfg, client, time.Now())
+	}
+	return nil
+}
+
+// pruneAzureBlobSnapshots deletes the snapshots of the ConfigMap that the
+// retention policy does not keep. Failures are logged rather than failing
+// the sink, as the snapshot was written and the next sync prunes again.
+func pruneAzureBlobSnapshots(ctx context.Context, cfg *Config, client *http.Client, now time.Time) {
+	a := &cfg.AzureBlob
+	base := a.Prefix + cfg.Namespace + "/" + cfg.ConfigMapName + "/"
+	_, dirs, err := listBlobs(ctx, client, a, base, "/")
+	if err != nil {
+		log.Printf("Warning: listing the Azure Blob snapshots to prune: %v", err)
+		return
+	}
+	snapshots := make(map[time.Time]string, len(dirs))
+	taken := make([]time.Time, 0, len(dirs))
+	for _, dir := range dirs {
+		t, err := time.Parse(azureSnapshotLayout, strings.TrimSuffix(strings.TrimPrefix(dir, base), "/"))
+		if err != nil {
+			continue
+		}
+		snapshots[t] = dir
+		taken = append(taken, t)
+	}
+
+	pruned := 0
+	for _, t := range a.Retention.expired(taken, now) {
+		names, _, err := listBlobs(ctx, client, a, snapshots[t], "")
+		if err == nil {
+			for _, name := range names {
+				if err = withRetry(ctx, func() error { return deleteBlob(ctx, client, a, name) }); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: pruning Azure Blob snapshot %s: %v", snapshots[t], err)
+			break
+		}
+		pruned++
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d Azure Blob snapshots of %s/%s", pruned, cfg.Namespace, cfg.ConfigMapName)
+	}
+	recordPrunedSnapshots(cfg, "azureBlob", pruned)
+}
+
+// azureBlobRequest returns a request to the container, or to the blob with
+// the given name, authenticated with the SAS token or managed identity.
+func azureBlobRequest(ctx context.Context, client *http.Client, a *AzureBlobConfig, method, name string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := a.endpoint() + "/" + url.PathEscape(a.Container)
+	if name != "" {
+		u += "/" + (&url.URL{Path: name}).EscapedPath()
+	}
+	params := query.Encode()
+	if a.SASToken != "" {
+		params = strings.TrimPrefix(params+"&"+strings.TrimPrefix(a.SASToken, "?"), "&")
+	}
+	if params != "" {
+		u += "?" + params
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", "2021-08-06")
+	if a.SASToken == "" {
+		token, err := azureAccessToken(client)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// listBlobs returns the names of the blobs starting with prefix, and with
+// a delimiter the prefixes up to it, e.g. the snapshot directories.
+func listBlobs(ctx context.Context, client *http.Client, a *AzureBlobConfig, prefix, delimiter string) ([]string, []string, error) {
+	var names, prefixes []string
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		req, err := azureBlobRequest(ctx, client, a, "GET", "", query, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		var result struct {
+			Blobs []struct {
+				Name string `xml:"Name"`
+			} `xml:"Blobs>Blob"`
+			Prefixes []struct {
+				Name string `xml:"Name"`
+			} `xml:"Blobs>BlobPrefix"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("unexpected status code from Azure Blob Storage listing %s: %d: %s", prefix, resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding the blob list of %s: %w", prefix, err)
+		}
+		for _, b := range result.Blobs {
+			names = append(names, b.Name)
+		}
+		for _, p := range result.Prefixes {
+			prefixes = append(prefixes, p.Name)
+		}
+		if marker = result.NextMarker; marker == "" {
+			return names, prefixes, nil
+		}
+	}
+}
+
+func deleteBlob(ctx context.Context, client *http.Client, a *AzureBlobConfig, name string) error {
+	req, err := azureBlobRequest(ctx, client, a, "DELETE", name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code from Azure Blob Storage deleting %s: %d: %s", name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func putBlob(ctx context.Context, client *http.Client, a *AzureBlobConfig, name string, data []byte) error {
+	req, err := azureBlobRequest(ctx, client, a, "PUT", name, nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code from Azure Blob Storage: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
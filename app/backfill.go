@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// BackfillConfig paces scriba backfill, the first collection of an estate
+// too large to be collected in one sync. Clusters are collected one at a
+// time, and those collected are kept in StateFile so an interrupted or
+// budget-limited backfill resumes where it stopped.
+type BackfillConfig struct {
+	StateFile string `json:"stateFile,omitempty"`
+	// Rate limits the Rancher requests per second. Budget is the number of
+	// Rancher requests after which a run stops, 0 for no limit.
+	Rate   float64 `json:"rate,omitempty"`
+	Budget int     `json:"budget,omitempty"`
+	// PublishEvery is the number of clusters collected after which the
+	// inventory collected so far is published.
+	PublishEvery int `json:"publishEvery,omitempty"`
+}
+
+func validateBackfill(b *BackfillConfig) error {
+	if b.Rate <= 0 {
+		return fmt.Errorf("backfill rate must be positive, got %g", b.Rate)
+	}
+	if b.Budget < 0 {
+		return fmt.Errorf("backfill budget must not be negative, got %d", b.Budget)
+	}
+	if b.PublishEvery < 1 {
+		return fmt.Errorf("backfill publish interval must be at least 1 cluster, got %d", b.PublishEvery)
+	}
+	return nil
+}
+
+// rancherLimiter paces the Rancher requests of the process when set, as by
+// scriba backfill.
+var rancherLimiter struct {
+	sync.Mutex
+	limiter *rate.Limiter
+}
+
+// setRancherRateLimit limits subsequent Rancher requests to perSecond, or
+// lifts the limit when it is 0.
+func setRancherRateLimit(perSecond float64) {
+	rancherLimiter.Lock()
+	defer rancherLimiter.Unlock()
+	if perSecond <= 0 {
+		rancherLimiter.limiter = nil
+		return
+	}
+	rancherLimiter.limiter = rate.NewLimiter(rate.Limit(perSecond), 1)
+}
+
+// waitRancherRateLimit blocks until the next Rancher request may be sent.
+func waitRancherRateLimit(ctx context.Context) error {
+	rancherLimiter.Lock()
+	limiter := rancherLimiter.limiter
+	rancherLimiter.Unlock()
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
+
+// backfillState is the progress of a backfill, saved after every cluster.
+type backfillState struct {
+	RancherURL string    `json:"rancherURL"`
+	Collect    []string  `json:"collect"`
+	StartedAt  time.Time `json:"startedAt"`
+	// Clusters holds the data of the collected clusters by cluster ID.
+	Clusters map[string]backfillCluster `json:"clusters"`
+}
+
+type backfillCluster struct {
+	CollectedAt time.Time   `json:"collectedAt"`
+	Projects    []Project   `json:"projects,omitempty"`
+	Namespaces  []Namespace `json:"namespaces,omitempty"`
+	Nodes       []Node      `json:"nodes,omitempty"`
+	ChartRepos  []ChartRepo `json:"chartRepos,omitempty"`
+}
+
+func (c backfillCluster) result() clusterResult {
+	return clusterResult{projects: c.Projects, namespaces: c.Namespaces, nodes: c.Nodes, chartRepos: c.ChartRepos}
+}
+
+// loadBackfillState reads the state of a previous backfill of cfg's
+// Rancher, or starts a new one when the state file does not exist. A
+// state of another Rancher or other collectors is refused, as resuming it
+// would mix inventories.
+func loadBackfillState(cfg *Config) (*backfillState, error) {
+	collect := append([]string(nil), cfg.Collect...)
+	sort.Strings(collect)
+	data, err := os.ReadFile(cfg.Backfill.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return &backfillState{
+			RancherURL: cfg.RancherURL,
+			Collect:    collect,
+			StartedAt:  time.Now().UTC(),
+			Clusters:   make(map[string]backfillCluster),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading backfill state: %w", err)
+	}
+	var state backfillState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing backfill state %s: %w", cfg.Backfill.StateFile, err)
+	}
+	if state.RancherURL != cfg.RancherURL {
+		return nil, fmt.Errorf("backfill state %s is of %s, not %s; remove it to start over", cfg.Backfill.StateFile, state.RancherURL, cfg.RancherURL)
+	}
+	if strings.Join(state.Collect, ",") != strings.Join(collect, ",") {
+		return nil, fmt.Errorf("backfill state %s was collected with the collectors %q, not %q; remove it to start over", cfg.Backfill.StateFile, strings.Join(state.Collect, ","), strings.Join(collect, ","))
+	}
+	if state.Clusters == nil {
+		state.Clusters = make(map[string]backfillCluster)
+	}
+	return &state, nil
+}
+
+// save writes the state to path through a temporary file, so an
+// interrupted backfill never leaves a truncated state behind.
+func (s *backfillState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("saving backfill state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving backfill state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving backfill state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("saving backfill state: %w", err)
+	}
+	return nil
+}
+
+// runBackfill collects the inventory slowly enough for estates of
+// thousands of clusters: Rancher requests are rate limited, clusters are
+// collected one at a time and saved to the state file, and the inventory
+// collected so far is published every few clusters. A run stops once its
+// request budget is spent; running backfill again resumes it. Once every
+// cluster is collected, the full inventory is published and the state file
+// removed, and regular syncs take over.
+func runBackfill(cfg *Config) error {
+	if cfg.Backfill.StateFile == "" {
+		return errors.New("backfill needs a state file, set --backfill-state")
+	}
+	state, err := loadBackfillState(cfg)
+	if err != nil {
+		return err
+	}
+	setRancherRateLimit(cfg.Backfill.Rate)
+	defer setRancherRateLimit(0)
+
+	ctx := context.Background()
+	requestsAtStart := rancherRequestCount()
+	stopped := false
+	collect := func(ctx context.Context, accessToken string, inv *Inventory) ([]clusterResult, []error) {
+		results := make([]clusterResult, len(inv.Clusters))
+		clusterErrs := make([]error, len(inv.Clusters))
+		collected := make([]bool, len(inv.Clusters))
+		for i, cluster := range inv.Clusters {
+			if saved, ok := state.Clusters[cluster.ID]; ok {
+				results[i], collected[i] = saved.result(), true
+			}
+		}
+		log.Printf("Backfilling %d of %d clusters", len(inv.Clusters)-countTrue(collected), len(inv.Clusters))
+
+		unpublished := 0
+		for i, cluster := range inv.Clusters {
+			if collected[i] {
+				continue
+			}
+			if cfg.Backfill.Budget > 0 && rancherRequestCount()-requestsAtStart >= cfg.Backfill.Budget {
+				stopped = true
+				break
+			}
+			started := time.Now()
+			result, err := collectCluster(ctx, cfg, accessToken, cluster)
+			if err != nil {
+				clusterErrs[i] = fmt.Errorf("cluster %s: %w", cluster.ID, err)
+				log.Printf("Warning: backfilling cluster %s failed, it is retried by the next backfill: %v", cluster.ID, err)
+				continue
+			}
+			result.duration = time.Since(started)
+			state.Clusters[cluster.ID] = backfillCluster{
+				CollectedAt: time.Now().UTC(),
+				Projects:    result.projects,
+				Namespaces:  result.namespaces,
+				Nodes:       result.nodes,
+				ChartRepos:  result.chartRepos,
+			}
+			if err := state.save(cfg.Backfill.StateFile); err != nil {
+				clusterErrs[i] = err
+				stopped = true
+				break
+			}
+			results[i], collected[i] = result, true
+			recordBackfillProgress(cfg, countTrue(collected), len(inv.Clusters))
+
+			if unpublished++; unpublished >= cfg.Backfill.PublishEvery && countTrue(collected) < len(inv.Clusters) {
+				publishPartialInventory(ctx, cfg, inv, results, collected)
+				unpublished = 0
+			}
+		}
+		recordBackfillProgress(cfg, countTrue(collected), len(inv.Clusters))
+		if unpublished > 0 && countTrue(collected) < len(inv.Clusters) {
+			publishPartialInventory(ctx, cfg, inv, results, collected)
+		}
+		return results, clusterErrs
+	}
+
+	inv, err := collectInventoryWith(ctx, cfg, collect)
+	if err != nil {
+		return fmt.Errorf("%w; the collected clusters are kept in %s, run backfill again to resume", err, cfg.Backfill.StateFile)
+	}
+	if stopped {
+		log.Printf("Backfill used its budget of %d Rancher requests with %d of %d clusters collected, run it again to resume", cfg.Backfill.Budget, len(state.Clusters), len(inv.Clusters))
+		return nil
+	}
+	if err := publishProfiles(ctx, cfg, nil, inv); err != nil {
+		return err
+	}
+	if err := os.Remove(cfg.Backfill.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing backfill state: %w", err)
+	}
+	log.Printf("Backfill complete: %d clusters, %d projects collected since %s", len(inv.Clusters), len(inv.Projects), state.StartedAt.Format(time.RFC3339))
+	return nil
+}
+
+// publishPartialInventory publishes inv restricted to the clusters
+// collected so far. It leaves out project members, which are only set on
+// the complete inventory. A failure is logged, as the next publish
+// replaces the inventory anyway.
+func publishPartialInventory(ctx context.Context, cfg *Config, inv *Inventory, results []clusterResult, collected []bool) {
+	partial := *inv
+	partial.Clusters = nil
+	partial.ChartRepos = inv.ChartRepos[:len(inv.ChartRepos):len(inv.ChartRepos)]
+	var partialResults []clusterResult
+	ids := make(map[string]bool)
+	for i, cluster := range inv.Clusters {
+		if collected[i] {
+			partial.Clusters = append(partial.Clusters, cluster)
+			partialResults = append(partialResults, results[i])
+			ids[cluster.ID] = true
+		}
+	}
+	partial.Resources = selectResources(inv.Resources, ids, true)
+	addClusterResults(cfg, &partial, partialResults)
+	if err := publishProfiles(ctx, cfg, nil, &partial); err != nil {
+		log.Printf("Error publishing the partial inventory of %d clusters: %v", len(partial.Clusters), err)
+		return
+	}
+	log.Printf("Published the partial inventory of %d of %d clusters", len(partial.Clusters), len(inv.Clusters))
+}
+
+func recordBackfillProgress(cfg *Config, collected, total int) {
+	metrics.setGauge("scriba_backfill_clusters_collected", "Clusters collected by the running backfill, including those of previous runs.", float64(collected), cfg.metricLabels()...)
+	metrics.setGauge("scriba_backfill_clusters", "Clusters to be collected by the running backfill.", float64(total), cfg.metricLabels()...)
+}
+
+func countTrue(values []bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
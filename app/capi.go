@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// CAPIExportConfig configures writing the clusters as Cluster API
+// (cluster.x-k8s.io/v1beta1) Cluster manifests after every sync, for tools
+// that only understand Cluster API inventories.
+type CAPIExportConfig struct {
+	// File is the path the manifests are written to as a multi-document
+	// YAML file.
+	File string `json:"file,omitempty"`
+	// Namespace is the namespace of the manifests.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (c *CAPIExportConfig) enabled() bool {
+	return c.File != ""
+}
+
+func validateCAPIExport(c *CAPIExportConfig) error {
+	if !c.enabled() {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(c.Namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid Cluster API export namespace %q: %s", c.Namespace, errs[0])
+	}
+	return nil
+}
+
+// Annotations of the exported Cluster manifests. The manifests describe
+// clusters managed by Rancher; scriba.rancher.io/read-only marks them as
+// not meant to be applied to a management cluster.
+const (
+	annotationReadOnly          = "scriba.rancher.io/read-only"
+	annotationSource            = "scriba.rancher.io/source"
+	annotationClusterName       = "scriba.rancher.io/cluster-name"
+	annotationState             = "scriba.rancher.io/state"
+	annotationProvider          = "scriba.rancher.io/provider"
+	annotationKubernetesVersion = "scriba.rancher.io/kubernetes-version"
+	annotationGeneratedAt       = "scriba.rancher.io/generated-at"
+)
+
+type capiCluster struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   capiMetadata      `json:"metadata"`
+	Spec       capiClusterSpec   `json:"spec"`
+	Status     capiClusterStatus `json:"status"`
+}
+
+type capiMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type capiClusterSpec struct {
+	// Paused keeps Cluster API controllers from acting on a manifest that
+	// is applied by mistake.
+	Paused               bool             `json:"paused"`
+	ControlPlaneEndpoint *capiAPIEndpoint `json:"controlPlaneEndpoint,omitempty"`
+}
+
+type capiAPIEndpoint struct {
+	Host string `json:"host"`
+	Port int32  `json:"port"`
+}
+
+type capiClusterStatus struct {
+	Phase               string `json:"phase"`
+	ControlPlaneReady   bool   `json:"controlPlaneReady"`
+	InfrastructureReady bool   `json:"infrastructureReady"`
+}
+
+// capiPhase maps a Rancher cluster state to the phase of a Cluster API
+// cluster.
+func capiPhase(state string) string {
+	switch state {
+	case "active":
+		return "Provisioned"
+	case "provisioning", "pending", "waiting", "updating", "upgrading":
+		return "Provisioning"
+	case clusterStateRemoving:
+		return "Deleting"
+	case "error":
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
+// capiEndpoint splits the API endpoint URL reported by Rancher into the
+// host and port of a control plane endpoint.
+func capiEndpoint(apiEndpoint string) *capiAPIEndpoint {
+	u, err := url.Parse(apiEndpoint)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	port := 443
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil
+		}
+	}
+	return &capiAPIEndpoint{Host: u.Hostname(), Port: int32(port)}
+}
+
+// capiClusters renders the clusters of inv as Cluster API Cluster
+// manifests, named after the slugified cluster names. Rancher labels that
+// are not valid Kubernetes labels are left out.
+func capiClusters(cfg *Config, inv *Inventory) []capiCluster {
+	clusters := append([]Cluster(nil), inv.Clusters...)
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ID < clusters[j].ID })
+
+	var manifests []capiCluster
+	used := make(map[string]bool)
+	for _, cluster := range clusters {
+		name := slugify(cluster.Name)
+		if name == "" || used[name] || len(validation.IsDNS1123Label(name)) > 0 {
+			name = cluster.ID
+		}
+		used[name] = true
+
+		labels := map[string]string{
+			labelManagedBy: managedByScriba,
+			labelClusterID: cluster.ID,
+		}
+		for key, value := range cluster.Labels {
+			if len(validation.IsQualifiedName(key)) == 0 && len(validation.IsValidLabelValue(value)) == 0 {
+				labels[key] = value
+			}
+		}
+
+		annotations := map[string]string{
+			annotationReadOnly:    "true",
+			annotationSource:      cfg.RancherURL,
+			annotationClusterName: cluster.Name,
+			annotationState:       cluster.State,
+			annotationGeneratedAt: inv.GeneratedAt.UTC().Format(time.RFC3339),
+		}
+		if cluster.Provider != "" {
+			annotations[annotationProvider] = cluster.Provider
+		}
+		if version := cluster.KubernetesVersion(); version != "" {
+			annotations[annotationKubernetesVersion] = version
+		}
+
+		phase := capiPhase(cluster.State)
+		manifests = append(manifests, capiCluster{
+			APIVersion: "cluster.x-k8s.io/v1beta1",
+			Kind:       "Cluster",
+			Metadata: capiMetadata{
+				Name:        name,
+				Namespace:   cfg.CAPIExport.Namespace,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Spec: capiClusterSpec{
+				Paused:               true,
+				ControlPlaneEndpoint: capiEndpoint(cluster.APIEndpoint),
+			},
+			Status: capiClusterStatus{
+				Phase:               phase,
+				ControlPlaneReady:   phase == "Provisioned",
+				InfrastructureReady: phase == "Provisioned",
+			},
+		})
+	}
+	return manifests
+}
+
+// renderCAPIClusters renders the manifests as a multi-document YAML file.
+func renderCAPIClusters(manifests []capiCluster) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, manifest := range manifests {
+		out, err := yaml.Marshal(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("rendering Cluster %s: %w", manifest.Metadata.Name, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// exportCAPIClusters writes the Cluster API manifests of the clusters of
+// inv to the configured file, encrypted for the age recipients.
+func exportCAPIClusters(cfg *Config, inv *Inventory) error {
+	started := time.Now()
+	manifests := capiClusters(cfg, inv)
+	data, err := renderCAPIClusters(manifests)
+	if err != nil {
+		return err
+	}
+	if data, err = encryptOutput(cfg, data); err != nil {
+		return err
+	}
+	if err := recordSink(cfg, "capi", cfg.CAPIExport.File, started, writeOutput(cfg.CAPIExport.File, data)); err != nil {
+		return fmt.Errorf("writing Cluster API manifests: %w", err)
+	}
+	log.Printf("Wrote %d Cluster API manifests to %s", len(manifests), cfg.CAPIExport.File)
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+)
+
+// Kinds of chart repositories: the catalogs and cluster catalogs of
+// Rancher's legacy apps (/v3) and the ClusterRepos of Rancher 2.5+ apps
+// (catalog.cattle.io), which every cluster has its own of.
+const (
+	chartRepoKindCatalog        = "Catalog"
+	chartRepoKindClusterCatalog = "ClusterCatalog"
+	chartRepoKindClusterRepo    = "ClusterRepo"
+)
+
+// ChartRepo is a Helm chart repository configured in Rancher. Global
+// catalogs have no ClusterID.
+type ChartRepo struct {
+	ClusterID   string `json:"clusterId,omitempty"`
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Branch      string `json:"branch,omitempty"`
+	LastRefresh string `json:"lastRefresh,omitempty"`
+	// RefreshError is the error of the last refresh, when it failed.
+	RefreshError string `json:"refreshError,omitempty"`
+}
+
+type chartRepoCondition struct {
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	Message        string `json:"message"`
+	LastUpdateTime string `json:"lastUpdateTime"`
+}
+
+// refreshError returns the message of the condition of type refreshed
+// when it is false.
+func refreshError(conditions []chartRepoCondition, refreshed string) string {
+	for _, condition := range conditions {
+		if condition.Type == refreshed && condition.Status == "False" {
+			if condition.Message == "" {
+				return "refresh failed"
+			}
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// getCatalogs lists the global catalogs and the cluster catalogs of
+// Rancher's legacy apps. Rancher versions without legacy apps yield an
+// empty list.
+func getCatalogs(ctx context.Context, rancherAPIURL string, accessToken string) ([]ChartRepo, error) {
+	log.Println("Starting getCatalogs function")
+
+	var repos []ChartRepo
+	for kind, collection := range map[string]string{chartRepoKindCatalog: "catalogs", chartRepoKindClusterCatalog: "clustercatalogs"} {
+		var response struct {
+			Data []struct {
+				Name                 string               `json:"name"`
+				ClusterID            string               `json:"clusterId"`
+				URL                  string               `json:"url"`
+				Branch               string               `json:"branch"`
+				LastRefreshTimestamp string               `json:"lastRefreshTimestamp"`
+				Conditions           []chartRepoCondition `json:"conditions"`
+			} `json:"data"`
+		}
+		err := getRancherJSON(ctx, rancherAPIURL+"/"+collection, accessToken, collection, &response)
+		if errors.Is(err, errRancherNotFound) {
+			log.Printf("%s not available from Rancher API, skipping", collection)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range response.Data {
+			repos = append(repos, ChartRepo{
+				ClusterID:    item.ClusterID,
+				Kind:         kind,
+				Name:         item.Name,
+				URL:          item.URL,
+				Branch:       item.Branch,
+				LastRefresh:  item.LastRefreshTimestamp,
+				RefreshError: refreshError(item.Conditions, "Refreshed"),
+			})
+		}
+	}
+	sortChartRepos(repos)
+
+	log.Printf("Fetched %d catalogs", len(repos))
+	return repos, nil
+}
+
+// getClusterRepos lists the ClusterRepos of a cluster through Rancher's
+// proxy to the cluster's Steve API. Clusters without the
+// catalog.cattle.io API yield an empty list.
+func getClusterRepos(ctx context.Context, rancherURL string, accessToken string, clusterID string) ([]ChartRepo, error) {
+	log.Printf("Starting getClusterRepos function for cluster ID: %s", clusterID)
+
+	var response struct {
+		Data []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				URL       string `json:"url"`
+				GitRepo   string `json:"gitRepo"`
+				GitBranch string `json:"gitBranch"`
+			} `json:"spec"`
+			Status struct {
+				DownloadTime string               `json:"downloadTime"`
+				Conditions   []chartRepoCondition `json:"conditions"`
+			} `json:"status"`
+		} `json:"data"`
+	}
+	err := getRancherJSON(ctx, rancherURL+"/k8s/clusters/"+url.PathEscape(clusterID)+"/v1/catalog.cattle.io.clusterrepos", accessToken, "cluster repos", &response)
+	if errors.Is(err, errRancherNotFound) {
+		log.Printf("Cluster repos not available in cluster %s, skipping", clusterID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]ChartRepo, 0, len(response.Data))
+	for _, item := range response.Data {
+		repo := ChartRepo{
+			ClusterID:    clusterID,
+			Kind:         chartRepoKindClusterRepo,
+			Name:         item.Metadata.Name,
+			URL:          item.Spec.URL,
+			LastRefresh:  item.Status.DownloadTime,
+			RefreshError: refreshError(item.Status.Conditions, "Downloaded"),
+		}
+		if item.Spec.GitRepo != "" {
+			repo.URL, repo.Branch = item.Spec.GitRepo, item.Spec.GitBranch
+		}
+		repos = append(repos, repo)
+	}
+	sortChartRepos(repos)
+
+	log.Printf("Fetched %d cluster repos for cluster ID %s", len(repos), clusterID)
+	return repos, nil
+}
+
+func sortChartRepos(repos []ChartRepo) {
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].ClusterID != repos[j].ClusterID {
+			return repos[i].ClusterID < repos[j].ClusterID
+		}
+		if repos[i].Kind != repos[j].Kind {
+			return repos[i].Kind < repos[j].Kind
+		}
+		return repos[i].Name < repos[j].Name
+	})
+}
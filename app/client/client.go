@@ -0,0 +1,164 @@
+// Package client is a Go client for the serve-mode HTTP API of
+// rancher-scriba, as described by its /openapi.json document.
+//
+//	c := client.New("https://scriba.example.com", client.WithToken(token))
+//	inv, err := c.Inventory(ctx)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the API of one rancher-scriba instance.
+type Client struct {
+	baseURL    string
+	token      string
+	profile    string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates requests with a bearer token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithProfile selects the sync profile whose data is requested from a
+// server running several.
+func WithProfile(name string) Option {
+	return func(c *Client) { c.profile = name }
+}
+
+// WithHTTPClient sets the HTTP client requests are sent with, e.g. one
+// with a client certificate for mTLS.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// New returns a client for the API at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is returned for responses with a non-2xx status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("scriba API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Inventory returns the inventory of the latest sync.
+func (c *Client) Inventory(ctx context.Context) (*Inventory, error) {
+	var inv Inventory
+	if err := c.getJSON(ctx, "/inventory", &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Events returns the change events of the latest sync.
+func (c *Client) Events(ctx context.Context) (*SyncEvents, error) {
+	var events SyncEvents
+	if err := c.getJSON(ctx, "/events", &events); err != nil {
+		return nil, err
+	}
+	return &events, nil
+}
+
+// Version returns the build information of the server.
+func (c *Client) Version(ctx context.Context) (*BuildInfo, error) {
+	var info BuildInfo
+	if err := c.getJSON(ctx, "/version", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Report returns the summary report of the latest sync in the given
+// format, markdown or html. An empty format selects the server's default.
+func (c *Client) Report(ctx context.Context, format string) ([]byte, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	resp, err := c.get(ctx, "/report", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// TriggerSync makes the server start its next sync right away, e.g. after
+// creating a cluster. It returns once the sync is queued.
+func (c *Client) TriggerSync(ctx context.Context) error {
+	resp, err := c.do(ctx, "POST", "/sync", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.get(ctx, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// get sends a GET request and returns the response if its status is 2xx.
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", path, query)
+}
+
+// do sends a request and returns the response if its status is 2xx.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	if c.profile != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("profile", c.profile)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+)
+
+// The failure causes of scriba, for programs telling them apart with
+// errors.Is instead of matching messages. The scriba commands wrap their
+// errors with them, and the errors of Client match ErrUnauthorized and
+// ErrRancherUnavailable by the status of the API response.
+var (
+	// ErrUnauthorized is a rejected or missing token: scriba's Rancher
+	// token, or the caller's token of the serve API.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrRancherUnavailable is a Rancher that could not be reached or
+	// answered with a server error.
+	ErrRancherUnavailable = errors.New("Rancher is unavailable")
+
+	// ErrConfigMapTooLarge is an inventory too large for the 1 MiB a
+	// Kubernetes ConfigMap can hold.
+	ErrConfigMapTooLarge = errors.New("ConfigMap exceeds the Kubernetes size limit")
+
+	// ErrPartialSync is a sync that wrote some but not all of its outputs.
+	ErrPartialSync = errors.New("sync partially failed")
+)
+
+// Is reports whether the response status means target: 401 and 403 are
+// ErrUnauthorized, and 502, the Rancher proxy failing to reach Rancher,
+// is ErrRancherUnavailable.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRancherUnavailable:
+		return e.StatusCode == http.StatusBadGateway
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+package client
+
+import "time"
+
+// The types below mirror the schemas of the OpenAPI document.
+
+type Inventory struct {
+	GeneratedAt time.Time   `json:"generatedAt"`
+	Clusters    []Cluster   `json:"clusters"`
+	Projects    []Project   `json:"projects"`
+	Namespaces  []Namespace `json:"namespaces,omitempty"`
+	Nodes       []Node      `json:"nodes,omitempty"`
+
+	MachineConfigs   []MachineConfig                     `json:"machineConfigs,omitempty"`
+	CloudCredentials []CloudCredential                   `json:"cloudCredentials,omitempty"`
+	Notifiers        []Notifier                          `json:"notifiers,omitempty"`
+	AlertGroups      []AlertGroup                        `json:"alertGroups,omitempty"`
+	AuthProviders    []AuthProvider                      `json:"authProviders,omitempty"`
+	Features         []Feature                           `json:"features,omitempty"`
+	Drivers          []Driver                            `json:"drivers,omitempty"`
+	ChartRepos       []ChartRepo                         `json:"chartRepos,omitempty"`
+	Tokens           []APIToken                          `json:"tokens,omitempty"`
+	Orphans          []OrphanedProject                   `json:"orphans,omitempty"`
+	MultiClusterApps []MultiClusterApp                   `json:"multiClusterApps,omitempty"`
+	GlobalDNS        []GlobalDNS                         `json:"globalDNS,omitempty"`
+	Roles            []Role                              `json:"roles,omitempty"`
+	Resources        map[string][]map[string]interface{} `json:"resources,omitempty"`
+	Staleness        *Staleness                          `json:"staleness,omitempty"`
+	RancherEndpoint  *RancherEndpoint                    `json:"rancherEndpoint,omitempty"`
+}
+
+type Staleness struct {
+	AgeSeconds        float64 `json:"ageSeconds"`
+	Stale             bool    `json:"stale"`
+	StaleAfterSeconds float64 `json:"staleAfterSeconds"`
+}
+
+type RancherEndpoint struct {
+	URL          string     `json:"url"`
+	Active       string     `json:"active"`
+	Failovers    int        `json:"failovers"`
+	LastFailover *time.Time `json:"lastFailover,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+type Cluster struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Type            string                 `json:"type"`
+	State           string                 `json:"state"`
+	Internal        bool                   `json:"internal"`
+	Version         *VersionInfo           `json:"version"`
+	Provider        string                 `json:"provider,omitempty"`
+	NodeCount       int                    `json:"nodeCount,omitempty"`
+	Capacity        map[string]string      `json:"capacity,omitempty"`
+	APIEndpoint     string                 `json:"apiEndpoint,omitempty"`
+	Labels          map[string]string      `json:"labels,omitempty"`
+	Connected       *bool                  `json:"connected,omitempty"`
+	LastSeen        *time.Time             `json:"lastSeen,omitempty"`
+	Reachability    *Reachability          `json:"reachability,omitempty"`
+	Created         *time.Time             `json:"created,omitempty"`
+	AgeDays         *int                   `json:"ageDays,omitempty"`
+	Fields          map[string]interface{} `json:"fields,omitempty"`
+	KubernetesEOL   *KubernetesEOL         `json:"kubernetesEol,omitempty"`
+	QuotaCommitment []QuotaCommitment      `json:"quotaCommitment,omitempty"`
+	Provisioning    *ProvisioningInfo      `json:"provisioning,omitempty"`
+	EtcdBackup      *EtcdBackup            `json:"etcdBackup,omitempty"`
+}
+
+type Reachability struct {
+	Reachable      bool      `json:"reachable"`
+	LatencySeconds float64   `json:"latencySeconds,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CheckedAt      time.Time `json:"checkedAt"`
+}
+
+type KubernetesEOL struct {
+	Status string `json:"status"`
+	Date   string `json:"date"`
+}
+
+type VersionInfo struct {
+	GitVersion string `json:"gitVersion"`
+}
+
+type ProvisioningInfo struct {
+	Name                  string        `json:"name"`
+	Namespace             string        `json:"namespace"`
+	KubernetesVersion     string        `json:"kubernetesVersion,omitempty"`
+	CloudCredentialSecret string        `json:"cloudCredentialSecret,omitempty"`
+	KubeconfigSecret      string        `json:"kubeconfigSecret,omitempty"`
+	Ready                 bool          `json:"ready"`
+	MachinePools          []MachinePool `json:"machinePools,omitempty"`
+}
+
+type MachinePool struct {
+	Name              string `json:"name"`
+	Quantity          int    `json:"quantity"`
+	EtcdRole          bool   `json:"etcdRole,omitempty"`
+	ControlPlaneRole  bool   `json:"controlPlaneRole,omitempty"`
+	WorkerRole        bool   `json:"workerRole,omitempty"`
+	MachineConfigKind string `json:"machineConfigKind,omitempty"`
+	MachineConfigName string `json:"machineConfigName,omitempty"`
+}
+
+type Project struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	ClusterID     string                 `json:"clusterId"`
+	Annotations   map[string]string      `json:"annotations"`
+	Created       *time.Time             `json:"created,omitempty"`
+	AgeDays       *int                   `json:"ageDays,omitempty"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+	ResourceQuota *ProjectResourceQuota  `json:"resourceQuota,omitempty"`
+	Quota         map[string]QuotaUsage  `json:"quota,omitempty"`
+	MemberCount   int                    `json:"memberCount,omitempty"`
+	Owners        []string               `json:"owners,omitempty"`
+}
+
+type ProjectResourceQuota struct {
+	Limit map[string]string `json:"limit,omitempty"`
+}
+
+type QuotaCommitment struct {
+	Resource      string  `json:"resource"`
+	Quota         string  `json:"quota"`
+	Capacity      string  `json:"capacity"`
+	Ratio         float64 `json:"ratio"`
+	Overcommitted bool    `json:"overcommitted"`
+	Projects      int     `json:"projects"`
+}
+
+type QuotaUsage struct {
+	Hard        string  `json:"hard"`
+	Used        string  `json:"used"`
+	Utilization float64 `json:"utilizationPercent"`
+}
+
+type Namespace struct {
+	ClusterID string            `json:"clusterId"`
+	Name      string            `json:"name"`
+	ProjectID string            `json:"projectId,omitempty"`
+	QuotaHard map[string]string `json:"quotaHard,omitempty"`
+	QuotaUsed map[string]string `json:"quotaUsed,omitempty"`
+}
+
+type Node struct {
+	ClusterID string            `json:"clusterId"`
+	Name      string            `json:"name"`
+	Roles     []string          `json:"roles,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Taints    []NodeTaint       `json:"taints,omitempty"`
+}
+
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+type MachineConfig struct {
+	Kind         string   `json:"kind"`
+	Namespace    string   `json:"namespace,omitempty"`
+	Name         string   `json:"name"`
+	Provider     string   `json:"provider"`
+	InstanceType string   `json:"instanceType,omitempty"`
+	Image        string   `json:"image,omitempty"`
+	Region       string   `json:"region,omitempty"`
+	Clusters     []string `json:"clusters,omitempty"`
+}
+
+type CloudCredential struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Created  string   `json:"created,omitempty"`
+	Clusters []string `json:"clusters,omitempty"`
+}
+
+type Notifier struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ClusterID string `json:"clusterId"`
+	Type      string `json:"type"`
+	Target    string `json:"target,omitempty"`
+}
+
+type AlertGroup struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	ClusterID string   `json:"clusterId"`
+	ProjectID string   `json:"projectId,omitempty"`
+	Rules     []string `json:"rules,omitempty"`
+	Notifiers []string `json:"notifiers,omitempty"`
+}
+
+type AuthProvider struct {
+	ID                string            `json:"id"`
+	Type              string            `json:"type"`
+	Enabled           bool              `json:"enabled"`
+	AccessMode        string            `json:"accessMode,omitempty"`
+	AllowedPrincipals int               `json:"allowedPrincipals"`
+	Settings          map[string]string `json:"settings,omitempty"`
+}
+
+type Feature struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Default bool   `json:"default"`
+	Locked  bool   `json:"locked,omitempty"`
+}
+
+type Driver struct {
+	Kind             string   `json:"kind"`
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	Active           bool     `json:"active"`
+	Builtin          bool     `json:"builtin"`
+	URL              string   `json:"url,omitempty"`
+	UIURL            string   `json:"uiUrl,omitempty"`
+	WhitelistDomains []string `json:"whitelistDomains,omitempty"`
+}
+
+type EtcdBackup struct {
+	Enabled       bool          `json:"enabled"`
+	Schedule      string        `json:"schedule,omitempty"`
+	IntervalHours int           `json:"intervalHours,omitempty"`
+	Retention     int           `json:"retention,omitempty"`
+	S3            *EtcdS3Target `json:"s3,omitempty"`
+}
+
+type EtcdS3Target struct {
+	Bucket   string `json:"bucket"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Folder   string `json:"folder,omitempty"`
+	Region   string `json:"region,omitempty"`
+}
+
+type ChartRepo struct {
+	ClusterID    string `json:"clusterId,omitempty"`
+	Kind         string `json:"kind"`
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	Branch       string `json:"branch,omitempty"`
+	LastRefresh  string `json:"lastRefresh,omitempty"`
+	RefreshError string `json:"refreshError,omitempty"`
+}
+
+type APIToken struct {
+	ID          string `json:"id"`
+	UserID      string `json:"userId"`
+	Description string `json:"description,omitempty"`
+	ClusterID   string `json:"clusterId,omitempty"`
+	Created     string `json:"created,omitempty"`
+	TTL         string `json:"ttl,omitempty"`
+	ExpiresAt   string `json:"expiresAt,omitempty"`
+	Expired     bool   `json:"expired"`
+	LastUsedAt  string `json:"lastUsedAt,omitempty"`
+}
+
+type OrphanedProject struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ClusterID string `json:"clusterId"`
+	Reason    string `json:"reason"`
+}
+
+type MultiClusterApp struct {
+	Name            string                  `json:"name"`
+	TemplateVersion string                  `json:"templateVersion,omitempty"`
+	State           string                  `json:"state,omitempty"`
+	Targets         []MultiClusterAppTarget `json:"targets,omitempty"`
+}
+
+type MultiClusterAppTarget struct {
+	ProjectID string `json:"projectId"`
+	AppID     string `json:"appId,omitempty"`
+	State     string `json:"state,omitempty"`
+}
+
+type GlobalDNS struct {
+	Name            string   `json:"name"`
+	FQDN            string   `json:"fqdn"`
+	Provider        string   `json:"provider,omitempty"`
+	ProviderType    string   `json:"providerType,omitempty"`
+	MultiClusterApp string   `json:"multiClusterApp,omitempty"`
+	ProjectIDs      []string `json:"projectIds,omitempty"`
+	State           string   `json:"state,omitempty"`
+}
+
+type Role struct {
+	Kind     string       `json:"kind"`
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Builtin  bool         `json:"builtin"`
+	Default  bool         `json:"default,omitempty"`
+	Locked   bool         `json:"locked,omitempty"`
+	Inherits []string     `json:"inherits,omitempty"`
+	Rules    []PolicyRule `json:"rules,omitempty"`
+}
+
+type PolicyRule struct {
+	Verbs           []string `json:"verbs"`
+	APIGroups       []string `json:"apiGroups,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+}
+
+type SyncEvents struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Since       time.Time     `json:"since"`
+	Events      []ChangeEvent `json:"events"`
+}
+
+// ChangeEvent describes a cluster or project that was added, removed or
+// modified between two syncs.
+type ChangeEvent struct {
+	Type      string        `json:"type"`
+	Kind      string        `json:"kind"`
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	ClusterID string        `json:"clusterId,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
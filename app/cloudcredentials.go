@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+)
+
+// CloudCredential is the metadata of a Rancher cloud credential. The
+// credential values themselves are never read into it.
+type CloudCredential struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Created string `json:"created,omitempty"`
+	// Clusters lists the IDs of the clusters provisioned with the
+	// credential. Credentials without clusters are candidates for removal.
+	Clusters []string `json:"clusters,omitempty"`
+}
+
+// getCloudCredentials lists the cloud credentials and finds the clusters
+// using them: provisioned RKE2/K3s clusters, hosted EKS, AKS and GKE
+// clusters, and RKE1 clusters through the node templates of their node
+// pools. clusters must already carry their provisioning details.
+func getCloudCredentials(ctx context.Context, rancherURL string, accessToken string, clusters []Cluster) ([]CloudCredential, error) {
+	log.Println("Starting getCloudCredentials function")
+	rancherAPIURL := rancherURL + "/v3"
+
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/cloudcredentials", accessToken, "cloud credentials", &response); err != nil {
+		return nil, err
+	}
+
+	users := make(map[string][]string)
+	use := func(credentialID, clusterID string) {
+		if credentialID != "" && !containsString(users[credentialID], clusterID) {
+			users[credentialID] = append(users[credentialID], clusterID)
+		}
+	}
+
+	for _, cluster := range clusters {
+		if cluster.Provisioning != nil {
+			use(cluster.Provisioning.CloudCredentialSecret, cluster.ID)
+		}
+	}
+
+	hosted, err := getHostedClusterCredentials(ctx, rancherAPIURL, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	for clusterID, credentialID := range hosted {
+		use(credentialID, clusterID)
+	}
+
+	templates, err := getNodeTemplateCredentials(ctx, rancherAPIURL, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	for clusterID, credentialIDs := range templates {
+		for _, credentialID := range credentialIDs {
+			use(credentialID, clusterID)
+		}
+	}
+
+	credentials := make([]CloudCredential, 0, len(response.Data))
+	for _, item := range response.Data {
+		credential := CloudCredential{
+			ID:      stringField(item, "id"),
+			Name:    stringField(item, "name"),
+			Created: stringField(item, "created"),
+		}
+		// The type is only recorded in the name of the field holding the
+		// credential, e.g. amazonec2credentialConfig.
+		for field := range item {
+			if strings.HasSuffix(field, "credentialConfig") {
+				credential.Type = strings.TrimSuffix(field, "credentialConfig")
+			}
+		}
+		credential.Clusters = users[credential.ID]
+		sort.Strings(credential.Clusters)
+		credentials = append(credentials, credential)
+	}
+	sort.Slice(credentials, func(i, j int) bool { return credentials[i].ID < credentials[j].ID })
+
+	log.Printf("Fetched %d cloud credentials", len(credentials))
+	return credentials, nil
+}
+
+// getHostedClusterCredentials returns the cloud credential of every hosted
+// (EKS, AKS or GKE) cluster, by cluster ID.
+func getHostedClusterCredentials(ctx context.Context, rancherAPIURL string, accessToken string) (map[string]string, error) {
+	var response struct {
+		Data []struct {
+			ID        string `json:"id"`
+			EKSConfig *struct {
+				AmazonCredentialSecret string `json:"amazonCredentialSecret"`
+			} `json:"eksConfig"`
+			AKSConfig *struct {
+				AzureCredentialSecret string `json:"azureCredentialSecret"`
+			} `json:"aksConfig"`
+			GKEConfig *struct {
+				GoogleCredentialSecret string `json:"googleCredentialSecret"`
+			} `json:"gkeConfig"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/clusters", accessToken, "hosted cluster credentials", &response); err != nil {
+		return nil, err
+	}
+
+	credentials := make(map[string]string)
+	for _, cluster := range response.Data {
+		switch {
+		case cluster.EKSConfig != nil && cluster.EKSConfig.AmazonCredentialSecret != "":
+			credentials[cluster.ID] = cluster.EKSConfig.AmazonCredentialSecret
+		case cluster.AKSConfig != nil && cluster.AKSConfig.AzureCredentialSecret != "":
+			credentials[cluster.ID] = cluster.AKSConfig.AzureCredentialSecret
+		case cluster.GKEConfig != nil && cluster.GKEConfig.GoogleCredentialSecret != "":
+			credentials[cluster.ID] = cluster.GKEConfig.GoogleCredentialSecret
+		}
+	}
+	return credentials, nil
+}
+
+// getNodeTemplateCredentials returns the cloud credentials of the node
+// templates used by every RKE1 cluster's node pools, by cluster ID.
+func getNodeTemplateCredentials(ctx context.Context, rancherAPIURL string, accessToken string) (map[string][]string, error) {
+	var templates struct {
+		Data []struct {
+			ID                string `json:"id"`
+			CloudCredentialID string `json:"cloudCredentialId"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/nodetemplates", accessToken, "node templates", &templates); err != nil {
+		return nil, err
+	}
+	byTemplate := make(map[string]string)
+	for _, template := range templates.Data {
+		byTemplate[template.ID] = template.CloudCredentialID
+	}
+
+	var pools struct {
+		Data []struct {
+			ClusterID      string `json:"clusterId"`
+			NodeTemplateID string `json:"nodeTemplateId"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/nodepools", accessToken, "node pools", &pools); err != nil {
+		return nil, err
+	}
+
+	credentials := make(map[string][]string)
+	for _, pool := range pools.Data {
+		if credentialID := byTemplate[pool.NodeTemplateID]; credentialID != "" {
+			credentials[pool.ClusterID] = append(credentials[pool.ClusterID], credentialID)
+		}
+	}
+	return credentials, nil
+}
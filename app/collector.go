@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Document is one object collected by a Collector, as it is written to the
+// inventory. A document with a clusterId belongs to that cluster and is
+// selected along with it by output profiles and tenants; others are
+// Rancher-wide.
+type Document map[string]interface{}
+
+// Collector collects an additional resource type through Rancher. A
+// collector is self-contained: it registers itself with registerCollector
+// from an init function of its own file, is selected with --collect like
+// the built-in collectors and its documents are written to the resources
+// of the inventory under its name.
+type Collector interface {
+	// Name is the collector's name in --collect and in the output.
+	Name() string
+	// Collect returns the collected documents. A failing collector fails
+	// the sync like the built-in collectors do.
+	Collect(ctx context.Context, client *RancherClient) ([]Document, error)
+}
+
+// RancherClient gives collectors access to the Rancher API with scriba's
+// token, through the shared client with its retries, headers and failover.
+type RancherClient struct {
+	// URL is the Rancher URL, e.g. https://rancher.example.com.
+	URL         string
+	accessToken string
+	// Clusters are the clusters of the inventory, for collectors working
+	// per downstream cluster.
+	Clusters []Cluster
+}
+
+// Get fetches path, e.g. /v3/settings or /k8s/clusters/c-abcde/v1/pods,
+// and decodes the JSON response into out.
+func (c *RancherClient) Get(ctx context.Context, path string, out interface{}) error {
+	return getRancherJSON(ctx, c.URL+path, c.accessToken, path, out)
+}
+
+// List returns the objects of the collection at path, following the
+// pagination of the v3 and v1 APIs.
+func (c *RancherClient) List(ctx context.Context, path string) ([]Document, error) {
+	var documents []Document
+	next := c.URL + path
+	for next != "" {
+		var page struct {
+			Data       []Document `json:"data"`
+			Pagination struct {
+				Next string `json:"next"`
+			} `json:"pagination"`
+		}
+		if err := getRancherJSON(ctx, next, c.accessToken, path, &page); err != nil {
+			return nil, err
+		}
+		documents = append(documents, page.Data...)
+		next = page.Pagination.Next
+	}
+	return documents, nil
+}
+
+var (
+	collectorsMu sync.RWMutex
+	collectors   = make(map[string]Collector)
+)
+
+// registerCollector makes c selectable with --collect. It panics when the
+// name is taken, as two collectors writing the same resources are a
+// programming error.
+func registerCollector(c Collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	name := c.Name()
+	if name == "" || containsString(knownCollectors, name) || collectors[name] != nil {
+		panic(fmt.Sprintf("collector %q is already registered", name))
+	}
+	collectors[name] = c
+}
+
+// collectorNames returns the names of the built-in collectors followed by
+// those of the registered ones.
+func collectorNames() []string {
+	collectorsMu.RLock()
+	defer collectorsMu.RUnlock()
+	return append(append([]string(nil), knownCollectors...), sortedKeys(collectors)...)
+}
+
+// runCollectors runs the registered collectors selected with --collect in
+// name order, then those of the configured steve resources, and returns
+// their documents by collector name.
+func runCollectors(ctx context.Context, cfg *Config, accessToken string, clusters []Cluster) (map[string][]Document, error) {
+	collectorsMu.RLock()
+	var selected []Collector
+	for _, name := range sortedKeys(collectors) {
+		if cfg.collects(name) {
+			selected = append(selected, collectors[name])
+		}
+	}
+	collectorsMu.RUnlock()
+	for _, r := range cfg.Steve {
+		selected = append(selected, steveCollector{resource: r, concurrency: cfg.Concurrency})
+	}
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	client := &RancherClient{URL: strings.TrimSuffix(cfg.RancherURL, "/"), accessToken: accessToken, Clusters: clusters}
+	resources := make(map[string][]Document, len(selected))
+	for _, c := range selected {
+		started := time.Now()
+		documents, err := c.Collect(ctx, client)
+		if err != nil {
+			return nil, fmt.Errorf("collector %s: %w", c.Name(), err)
+		}
+		if documents == nil {
+			documents = []Document{}
+		}
+		resources[c.Name()] = documents
+		log.Printf("Collector %s collected %d documents", c.Name(), len(documents))
+		metrics.setGauge("scriba_collector_documents", "Documents collected by a registered collector in the last sync.", float64(len(documents)), cfg.metricLabels("collector", c.Name())...)
+		metrics.setGauge("scriba_collector_duration_seconds", "Time a registered collector took in the last sync.", time.Since(started).Seconds(), cfg.metricLabels("collector", c.Name())...)
+	}
+	return resources, nil
+}
+
+// clusterID returns the cluster the document belongs to, if any.
+func (d Document) clusterID() string {
+	id, _ := d["clusterId"].(string)
+	return id
+}
+
+// selectResources returns the documents of the clusters in ids, along
+// with the Rancher-wide documents when global is set.
+func selectResources(resources map[string][]Document, ids map[string]bool, global bool) map[string][]Document {
+	if resources == nil {
+		return nil
+	}
+	out := make(map[string][]Document, len(resources))
+	for name, documents := range resources {
+		selected := []Document{}
+		for _, d := range documents {
+			if id := d.clusterID(); (id == "" && global) || (id != "" && ids[id]) {
+				selected = append(selected, d)
+			}
+		}
+		out[name] = selected
+	}
+	return out
+}
+
+// renderResources renders the resources key: the documents of every
+// registered collector by collector name, as YAML, ordered by cluster and
+// then as collected so unchanged resources render identically.
+func renderResources(resources map[string][]Document) (string, error) {
+	sorted := make(map[string][]Document, len(resources))
+	for name, documents := range resources {
+		documents = append([]Document(nil), documents...)
+		sort.SliceStable(documents, func(i, j int) bool { return documents[i].clusterID() < documents[j].clusterID() })
+		sorted[name] = documents
+	}
+	out, err := yaml.Marshal(sorted)
+	if err != nil {
+		return "", fmt.Errorf("rendering resources: %w", err)
+	}
+	return string(out), nil
+}
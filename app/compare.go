@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// snapshotComparison is the difference between two saved inventories, as
+// printed by the compare command.
+type snapshotComparison struct {
+	Old     snapshotInfo      `json:"old"`
+	New     snapshotInfo      `json:"new"`
+	Summary comparisonSummary `json:"summary"`
+	// Events are the added, removed and modified clusters and projects,
+	// as in the change events of a sync.
+	Events []ChangeEvent `json:"events"`
+}
+
+type snapshotInfo struct {
+	Path        string    `json:"path"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Clusters    int       `json:"clusters"`
+	Projects    int       `json:"projects"`
+}
+
+type comparisonSummary struct {
+	ClustersAdded    int `json:"clustersAdded"`
+	ClustersRemoved  int `json:"clustersRemoved"`
+	ClustersModified int `json:"clustersModified"`
+	VersionChanges   int `json:"versionChanges"`
+	ProjectsAdded    int `json:"projectsAdded"`
+	ProjectsRemoved  int `json:"projectsRemoved"`
+	ProjectsModified int `json:"projectsModified"`
+}
+
+// runCompare prints the differences between two snapshots as saved from
+// /inventory, e.g. for quarterly reviews.
+func runCompare(cfg *Config) error {
+	if len(cfg.positional) != 2 {
+		return errors.New("usage: scriba compare [flags] <old.json> <new.json>")
+	}
+	old, err := readSnapshot(cfg.positional[0])
+	if err != nil {
+		return err
+	}
+	cur, err := readSnapshot(cfg.positional[1])
+	if err != nil {
+		return err
+	}
+	return printComparison(os.Stdout, compareSnapshots(cfg.positional[0], old, cfg.positional[1], cur), cfg.DiffFormat)
+}
+
+func compareSnapshots(oldPath string, old *Inventory, newPath string, cur *Inventory) *snapshotComparison {
+	c := &snapshotComparison{
+		Old:    snapshotInfo{Path: oldPath, GeneratedAt: old.GeneratedAt, Clusters: len(old.Clusters), Projects: len(old.Projects)},
+		New:    snapshotInfo{Path: newPath, GeneratedAt: cur.GeneratedAt, Clusters: len(cur.Clusters), Projects: len(cur.Projects)},
+		Events: diffInventories(old, cur),
+	}
+	for _, event := range c.Events {
+		switch {
+		case event.Kind == kindCluster && event.Type == eventAdded:
+			c.Summary.ClustersAdded++
+		case event.Kind == kindCluster && event.Type == eventRemoved:
+			c.Summary.ClustersRemoved++
+		case event.Kind == kindCluster:
+			c.Summary.ClustersModified++
+			if versionChange(event) != nil {
+				c.Summary.VersionChanges++
+			}
+		case event.Type == eventAdded:
+			c.Summary.ProjectsAdded++
+		case event.Type == eventRemoved:
+			c.Summary.ProjectsRemoved++
+		default:
+			c.Summary.ProjectsModified++
+		}
+	}
+	return c
+}
+
+// versionChange returns the Kubernetes version change of a modified
+// cluster, if any.
+func versionChange(event ChangeEvent) *FieldChange {
+	for i := range event.Changes {
+		if event.Changes[i].Field == "kubernetesVersion" {
+			return &event.Changes[i]
+		}
+	}
+	return nil
+}
+
+func printComparison(w io.Writer, c *snapshotComparison, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	case "text", "":
+	default:
+		return fmt.Errorf("unsupported diff format %q", format)
+	}
+
+	fmt.Fprintf(w, "Comparing %s (%s) with %s (%s), %s apart.\n\n",
+		c.Old.Path, c.Old.GeneratedAt.Format(time.RFC3339), c.New.Path, c.New.GeneratedAt.Format(time.RFC3339),
+		formatSpan(c.New.GeneratedAt.Sub(c.Old.GeneratedAt)))
+	fmt.Fprintf(w, "Clusters: %d -> %d (%d added, %d removed, %d Kubernetes version changes)\n",
+		c.Old.Clusters, c.New.Clusters, c.Summary.ClustersAdded, c.Summary.ClustersRemoved, c.Summary.VersionChanges)
+	fmt.Fprintf(w, "Projects: %d -> %d (%d added, %d removed, %d modified)\n",
+		c.Old.Projects, c.New.Projects, c.Summary.ProjectsAdded, c.Summary.ProjectsRemoved, c.Summary.ProjectsModified)
+
+	if len(c.Events) == 0 {
+		fmt.Fprintln(w, "\nNo changes.")
+		return nil
+	}
+
+	printSection := func(title string, match func(ChangeEvent) bool) {
+		printed := false
+		for _, event := range c.Events {
+			if !match(event) {
+				continue
+			}
+			if !printed {
+				fmt.Fprintf(w, "\n%s:\n", title)
+				printed = true
+			}
+			name := event.Name + " (" + event.ID + ")"
+			switch event.Type {
+			case eventAdded:
+				fmt.Fprintf(w, "  + %s\n", name)
+			case eventRemoved:
+				fmt.Fprintf(w, "  - %s\n", name)
+			default:
+				fmt.Fprintf(w, "  ~ %s\n", name)
+				for _, change := range event.Changes {
+					fmt.Fprintf(w, "      %s: %q -> %q\n", change.Field, change.Old, change.New)
+				}
+			}
+		}
+	}
+	printSection("Clusters", func(e ChangeEvent) bool { return e.Kind == kindCluster })
+	printSection("Projects", func(e ChangeEvent) bool { return e.Kind == kindProject })
+	return nil
+}
+
+// formatSpan formats the time between two snapshots in days once it is
+// longer than a day, as snapshots compared in reviews are months apart.
+func formatSpan(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	if days := int(d / (24 * time.Hour)); days > 0 {
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	return d.Round(time.Minute).String()
+}
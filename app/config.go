@@ -0,0 +1,889 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is assembled from defaults, an optional YAML config file
+// (--config), environment variables and flags, in increasing order of
+// precedence. The JSON field names are the keys of the config file.
+type Config struct {
+	RancherURL   string `json:"rancherURL,omitempty"`
+	RancherToken string `json:"rancherToken,omitempty"`
+	// RancherFallbackURLs are further URLs of the same Rancher
+	// installation, e.g. its external load balancer, tried in order when
+	// RancherURL cannot be reached.
+	RancherFallbackURLs []string `json:"rancherFallbackURLs,omitempty"`
+
+	CredentialSource CredentialSource `json:"credentialSource,omitempty"`
+
+	// UserAgent and RequestHeaders are sent with every Rancher request.
+	// UserAgent defaults to scriba/<version>.
+	UserAgent      string            `json:"userAgent,omitempty"`
+	RequestHeaders map[string]string `json:"requestHeaders,omitempty"`
+
+	// DebugHTTP logs every Rancher request with its status and duration,
+	// and the headers and the first DebugHTTPBody bytes of the bodies when
+	// set, with credentials scrubbed.
+	DebugHTTP     bool `json:"debugHTTP,omitempty"`
+	DebugHTTPBody int  `json:"debugHTTPBody,omitempty"`
+
+	// StrictTokenPrivileges refuses Rancher tokens of users with an admin
+	// global role instead of only warning about them.
+	StrictTokenPrivileges bool `json:"strictTokenPrivileges,omitempty"`
+
+	// Exclusive makes scriba the sole owner of the target ConfigMap: keys
+	// outside managedKeys are removed on every update instead of preserved.
+	Exclusive bool `json:"exclusive,omitempty"`
+
+	// Adopt takes over existing ConfigMaps that lack scriba's managed-by
+	// label instead of refusing to write them.
+	Adopt bool `json:"adopt,omitempty"`
+
+	// KeyPrefix enables shared mode: keys are written with the prefix, only
+	// prefixed keys are ever removed and the ConfigMap need not be owned
+	// by scriba.
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+
+	ReportFormat string `json:"reportFormat,omitempty"`
+	ReportOutput string `json:"reportOutput,omitempty"`
+
+	// DeadLetterDir is where the payloads of sinks that failed after all
+	// retries are saved for scriba replay. Unset, they are dropped.
+	DeadLetterDir string `json:"deadLetterDir,omitempty"`
+
+	// RunReport is the file the JSON run report is written to at the end
+	// of a command, - for stdout. No report is written when empty.
+	RunReport string `json:"runReport,omitempty"`
+
+	// AgeRecipients and AgeRecipientsFile select the age recipients that
+	// written outputs are encrypted for. Outputs are plain text without.
+	AgeRecipients     []string `json:"ageRecipients,omitempty"`
+	AgeRecipientsFile string   `json:"ageRecipientsFile,omitempty"`
+
+	ListenAddress string          `json:"listenAddress,omitempty"`
+	Interval      metav1.Duration `json:"interval,omitempty"`
+
+	// SyncTimeout bounds the wall-clock time of a sync, including retries.
+	// Zero means no limit.
+	SyncTimeout metav1.Duration `json:"syncTimeout,omitempty"`
+
+	// DifferentialSync makes serve mode only collect the projects,
+	// namespaces, nodes and chart repositories of clusters that changed
+	// since the previous sync, and of every cluster once FullSyncInterval
+	// has passed since the last full sync. 0 disables full syncs.
+	DifferentialSync bool            `json:"differentialSync,omitempty"`
+	FullSyncInterval metav1.Duration `json:"fullSyncInterval,omitempty"`
+
+	// Concurrency limits how many clusters are collected in parallel.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// Collect lists the optional collectors to run in addition to the
+	// cluster and project inventory.
+	Collect []string `json:"collect,omitempty"`
+
+	// ResolvePrincipals looks up the names of the principals listed by the
+	// members collector in the Rancher principals API, caching them for
+	// PrincipalCacheTTL.
+	ResolvePrincipals bool            `json:"resolvePrincipals,omitempty"`
+	PrincipalCacheTTL metav1.Duration `json:"principalCacheTTL,omitempty"`
+
+	ExcludeLocal bool `json:"excludeLocal,omitempty"`
+	// ClusterStates restricts the inventory to clusters in one of the
+	// given Rancher states (e.g. active). Empty means all states.
+	ClusterStates []string `json:"clusterStates,omitempty"`
+
+	KubernetesEOL KubernetesEOLConfig `json:"kubernetesEol,omitempty"`
+
+	// OvercommitFactor is the multiple of a cluster's CPU or memory
+	// capacity its projects' quotas may add up to before the cluster is
+	// reported as overcommitted.
+	OvercommitFactor float64 `json:"overcommitFactor,omitempty"`
+
+	// FieldMappings promote annotations to typed fields. Config file only.
+	FieldMappings []FieldMapping `json:"fieldMappings,omitempty"`
+
+	// ProbeEndpoints connects to the API endpoint of every cluster during
+	// a sync, giving up after ProbeTimeout, to record whether it is
+	// reachable independent of Rancher.
+	ProbeEndpoints bool            `json:"probeEndpoints,omitempty"`
+	ProbeTimeout   metav1.Duration `json:"probeTimeout,omitempty"`
+
+	DiffFormat string `json:"diffFormat,omitempty"`
+
+	// KeyScheme selects how ConfigMap entries are keyed: by Rancher ID,
+	// display name or both. Slugify normalizes the display names.
+	KeyScheme string `json:"keyScheme,omitempty"`
+	Slugify   bool   `json:"slugify,omitempty"`
+
+	// Layout is either flat (separate clusters and projects keys) or
+	// nested (projects grouped under their cluster in one inventory key).
+	Layout string `json:"layout,omitempty"`
+	// CompatibilityMode writes the keys of both layouts, so consumers of
+	// either keep working while they migrate to the other.
+	CompatibilityMode bool `json:"compatibilityMode,omitempty"`
+
+	Kubeconfig    string `json:"kubeconfig,omitempty"`
+	KubeContext   string `json:"context,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	ConfigMapName string `json:"configMap,omitempty"`
+	// ConfigMapMode writes the inventory to a single ConfigMap or to one
+	// ConfigMap per project.
+	ConfigMapMode string `json:"configMapMode,omitempty"`
+
+	// Profiles render audience-specific views of the inventory into their
+	// own ConfigMaps. They can only be set in the config file.
+	Profiles []Profile `json:"profiles,omitempty"`
+
+	// Steve lists the Kubernetes resources collected through Rancher's
+	// steve API, each as a collector of its own. Config file only.
+	Steve []SteveResource `json:"steve,omitempty"`
+
+	// Groups maps group names to cluster label selectors. Each group is
+	// written to its own ConfigMap per profile. Config file only.
+	Groups map[string]string `json:"groups,omitempty"`
+
+	// TargetKubeconfig and TargetContext select the cluster the ConfigMap
+	// is written to when it differs from the one scriba runs in.
+	TargetKubeconfig string `json:"targetKubeconfig,omitempty"`
+	TargetContext    string `json:"targetContext,omitempty"`
+
+	Email EmailConfig `json:"email,omitempty"`
+
+	GCS GCSConfig `json:"gcs,omitempty"`
+
+	AzureBlob AzureBlobConfig `json:"azureBlob,omitempty"`
+
+	Redis RedisConfig `json:"redis,omitempty"`
+
+	MQTT MQTTConfig `json:"mqtt,omitempty"`
+
+	StatsD StatsDConfig `json:"statsd,omitempty"`
+
+	KubeconfigExport KubeconfigExportConfig `json:"kubeconfigExport,omitempty"`
+
+	CAPIExport CAPIExportConfig `json:"capiExport,omitempty"`
+
+	// WebhookURL receives the change events of every sync with changes in
+	// serve mode.
+	WebhookURL string `json:"webhookURL,omitempty"`
+
+	// TeamsWebhookURL is a Microsoft Teams incoming webhook notified of
+	// changes and failed syncs.
+	TeamsWebhookURL string `json:"teamsWebhookURL,omitempty"`
+
+	Alerting AlertingConfig `json:"alerting,omitempty"`
+
+	API APIConfig `json:"api,omitempty"`
+
+	Proxy ProxyConfig `json:"proxy,omitempty"`
+
+	Backfill BackfillConfig `json:"backfill,omitempty"`
+
+	OutputBudgets OutputBudgets `json:"outputBudgets,omitempty"`
+
+	Propagation PropagationConfig `json:"propagation,omitempty"`
+
+	// ConfigConfigMap names a ConfigMap in scriba's own namespace holding
+	// a config file under the config.yaml key, for GitOps-managed settings.
+	ConfigConfigMap string `json:"-"`
+
+	// Syncs are sync profiles run by the same process, each with its own
+	// settings on top of the others. Config file only.
+	Syncs []SyncProfile `json:"syncs,omitempty"`
+
+	// SyncProfile selects a single sync profile to run.
+	SyncProfile string `json:"-"`
+
+	// syncProfiles holds the assembled configuration of each of Syncs, and
+	// syncProfile the name of the profile a configuration belongs to.
+	syncProfiles []*Config
+	syncProfile  string
+
+	// outputLabels are set on the ConfigMap written with this
+	// configuration, e.g. the group of a group ConfigMap.
+	outputLabels map[string]string
+
+	// args and configFile record where the configuration was loaded from,
+	// so serve mode can reload it.
+	args       []string
+	configFile string
+
+	// positional holds the arguments following the flags, e.g. the schema
+	// name of the schema command.
+	positional []string
+}
+
+// CredentialSource selects where the Rancher token is read from. When Type
+// is empty it is inferred from whichever source is configured.
+type CredentialSource struct {
+	Type      string      `json:"type,omitempty"`
+	TokenFile string      `json:"tokenFile,omitempty"`
+	OIDC      OIDCSource  `json:"oidc,omitempty"`
+	Vault     VaultSource `json:"vault,omitempty"`
+	AWS       AWSSource   `json:"aws,omitempty"`
+}
+
+type OIDCSource struct {
+	TokenURL     string   `json:"tokenURL,omitempty"`
+	ClientID     string   `json:"clientID,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+type VaultSource struct {
+	Addr       string          `json:"addr,omitempty"`
+	AuthPath   string          `json:"authPath,omitempty"`
+	Role       string          `json:"role,omitempty"`
+	SecretPath string          `json:"secretPath,omitempty"`
+	Refresh    metav1.Duration `json:"refresh,omitempty"`
+}
+
+// AWSSource reads the token from AWS Secrets Manager (SecretID) or SSM
+// Parameter Store (Parameter). Field names the JSON key holding the token
+// when the secret is a JSON document.
+type AWSSource struct {
+	Region    string          `json:"region,omitempty"`
+	SecretID  string          `json:"secretId,omitempty"`
+	Parameter string          `json:"parameter,omitempty"`
+	Field     string          `json:"field,omitempty"`
+	Refresh   metav1.Duration `json:"refresh,omitempty"`
+}
+
+// Credential source types.
+const (
+	credentialStatic            = "static"
+	credentialFile              = "file"
+	credentialOIDC              = "oidc"
+	credentialVault             = "vault"
+	credentialAWSSecretsManager = "awsSecretsManager"
+	credentialAWSSSM            = "awsSSM"
+	credentialKeyring           = "keyring"
+)
+
+var knownCredentialSources = []string{credentialStatic, credentialFile, credentialOIDC, credentialVault, credentialAWSSecretsManager, credentialAWSSSM, credentialKeyring}
+
+// Optional collectors selectable with --collect.
+const (
+	collectorNamespaces       = "namespaces"
+	collectorNodes            = "nodes"
+	collectorMachineConfigs   = "machineconfigs"
+	collectorCloudCredentials = "cloudcredentials"
+	collectorNotifiers        = "notifiers"
+	collectorAuthProviders    = "authproviders"
+	collectorFeatures         = "features"
+	collectorDrivers          = "drivers"
+	collectorEtcdBackups      = "etcdbackups"
+	collectorChartRepos       = "chartrepos"
+	collectorTokens           = "tokens"
+	collectorOrphans          = "orphans"
+	collectorMultiClusterApps = "multiclusterapps"
+	collectorRoles            = "roles"
+	collectorMembers          = "members"
+)
+
+var knownCollectors = []string{collectorNamespaces, collectorNodes, collectorMachineConfigs, collectorCloudCredentials, collectorNotifiers, collectorAuthProviders, collectorFeatures, collectorDrivers, collectorEtcdBackups, collectorChartRepos, collectorTokens, collectorOrphans, collectorMultiClusterApps, collectorRoles, collectorMembers}
+
+// collects reports whether the named optional collector is enabled.
+func (c *Config) collects(name string) bool {
+	return containsString(c.Collect, name)
+}
+
+func defaultConfig() *Config {
+	cfg := &Config{
+		ReportFormat:      "markdown",
+		ReportOutput:      "-",
+		ListenAddress:     ":8080",
+		Proxy:             ProxyConfig{TTL: metav1.Duration{Duration: 30 * time.Second}},
+		Backfill:          BackfillConfig{Rate: 5, PublishEvery: 25},
+		Interval:          metav1.Duration{Duration: 5 * time.Minute},
+		FullSyncInterval:  metav1.Duration{Duration: time.Hour},
+		PrincipalCacheTTL: metav1.Duration{Duration: time.Hour},
+		ProbeTimeout:      metav1.Duration{Duration: 5 * time.Second},
+		OvercommitFactor:  1,
+		Concurrency:       4,
+		DiffFormat:        "text",
+		KeyScheme:         keySchemeID,
+		Layout:            layoutFlat,
+		Namespace:         "kube-system",
+		ConfigMapName:     "rancher-data",
+		ConfigMapMode:     configMapModeSingle,
+		Email: EmailConfig{
+			SMTPPort: 587,
+			Subject:  "Rancher inventory report",
+			Format:   "html",
+			Interval: metav1.Duration{Duration: 24 * time.Hour},
+		},
+		GCS: GCSConfig{
+			Endpoint: "https://storage.googleapis.com",
+		},
+		Redis: RedisConfig{
+			KeyPrefix: "scriba:",
+		},
+		MQTT: MQTTConfig{
+			ClientID:    "rancher-scriba",
+			TopicPrefix: "scriba/",
+		},
+		StatsD: StatsDConfig{
+			Prefix: "scriba.",
+		},
+		CAPIExport: CAPIExportConfig{
+			Namespace: "default",
+		},
+		KubernetesEOL: KubernetesEOLConfig{
+			Warning: metav1.Duration{Duration: 90 * 24 * time.Hour},
+		},
+		Alerting: AlertingConfig{
+			PagerDutyURL:     "https://events.pagerduty.com/v2/enqueue",
+			OpsgenieURL:      "https://api.opsgenie.com",
+			FailureThreshold: 3,
+		},
+	}
+	cfg.CredentialSource.Vault.AuthPath = "kubernetes"
+	cfg.CredentialSource.Vault.Refresh.Duration = 10 * time.Minute
+	cfg.CredentialSource.AWS.Refresh.Duration = 10 * time.Minute
+	return cfg
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set.
+func (c *Config) applyEnv() {
+	c.RancherURL = envString("RANCHER_SERVER_URL", c.RancherURL)
+	c.RancherToken = envString("RANCHER_TOKEN_KEY", c.RancherToken)
+	c.RancherFallbackURLs = envList("RANCHER_FALLBACK_URLS", c.RancherFallbackURLs)
+	c.UserAgent = envString("SCRIBA_USER_AGENT", c.UserAgent)
+	c.RequestHeaders = envHeaders("SCRIBA_REQUEST_HEADERS", c.RequestHeaders)
+	c.DebugHTTP = envBool("SCRIBA_DEBUG_HTTP", c.DebugHTTP)
+	c.DebugHTTPBody = envInt("SCRIBA_DEBUG_HTTP_BODY", c.DebugHTTPBody)
+
+	cs := &c.CredentialSource
+	cs.Type = envString("SCRIBA_CREDENTIAL_SOURCE", cs.Type)
+	cs.TokenFile = envString("RANCHER_TOKEN_FILE", cs.TokenFile)
+	cs.OIDC.TokenURL = envString("RANCHER_OIDC_TOKEN_URL", cs.OIDC.TokenURL)
+	cs.OIDC.ClientID = envString("RANCHER_OIDC_CLIENT_ID", cs.OIDC.ClientID)
+	cs.OIDC.ClientSecret = envString("RANCHER_OIDC_CLIENT_SECRET", cs.OIDC.ClientSecret)
+	cs.OIDC.Scopes = envList("RANCHER_OIDC_SCOPES", cs.OIDC.Scopes)
+	cs.Vault.Addr = envString("VAULT_ADDR", cs.Vault.Addr)
+	cs.Vault.AuthPath = envString("VAULT_AUTH_PATH", cs.Vault.AuthPath)
+	cs.Vault.Role = envString("VAULT_ROLE", cs.Vault.Role)
+	cs.Vault.SecretPath = envString("VAULT_SECRET_PATH", cs.Vault.SecretPath)
+	cs.Vault.Refresh.Duration = envDuration("VAULT_REFRESH", cs.Vault.Refresh.Duration)
+	if cs.AWS.Region == "" {
+		cs.AWS.Region = envString("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION"))
+	}
+
+	c.StrictTokenPrivileges = envBool("SCRIBA_STRICT_TOKEN_PRIVILEGES", c.StrictTokenPrivileges)
+	c.Exclusive = envBool("SCRIBA_EXCLUSIVE", c.Exclusive)
+	c.Adopt = envBool("SCRIBA_ADOPT", c.Adopt)
+	c.KeyPrefix = envString("SCRIBA_KEY_PREFIX", c.KeyPrefix)
+	c.ReportFormat = envString("SCRIBA_REPORT_FORMAT", c.ReportFormat)
+	c.ReportOutput = envString("SCRIBA_REPORT_OUTPUT", c.ReportOutput)
+	c.RunReport = envString("SCRIBA_RUN_REPORT", c.RunReport)
+	c.DeadLetterDir = envString("SCRIBA_DEAD_LETTER_DIR", c.DeadLetterDir)
+	c.AgeRecipients = envList("SCRIBA_AGE_RECIPIENTS", c.AgeRecipients)
+	c.AgeRecipientsFile = envString("SCRIBA_AGE_RECIPIENTS_FILE", c.AgeRecipientsFile)
+	c.ListenAddress = envString("SCRIBA_LISTEN_ADDRESS", c.ListenAddress)
+	c.Proxy.Enabled = envBool("SCRIBA_PROXY", c.Proxy.Enabled)
+	c.Proxy.TTL.Duration = envDuration("SCRIBA_PROXY_TTL", c.Proxy.TTL.Duration)
+	c.Propagation.Annotations = envList("SCRIBA_PROPAGATE_ANNOTATIONS", c.Propagation.Annotations)
+	c.Propagation.Labels = envList("SCRIBA_PROPAGATE_LABELS", c.Propagation.Labels)
+	c.OutputBudgets.Total = envInt("SCRIBA_OUTPUT_BUDGET", c.OutputBudgets.Total)
+	c.Backfill.StateFile = envString("SCRIBA_BACKFILL_STATE", c.Backfill.StateFile)
+	c.Backfill.Rate = envFloat("SCRIBA_BACKFILL_RATE", c.Backfill.Rate)
+	c.Backfill.Budget = envInt("SCRIBA_BACKFILL_BUDGET", c.Backfill.Budget)
+	c.Backfill.PublishEvery = envInt("SCRIBA_BACKFILL_PUBLISH_EVERY", c.Backfill.PublishEvery)
+	c.Interval.Duration = envDuration("SCRIBA_INTERVAL", c.Interval.Duration)
+	c.SyncTimeout.Duration = envDuration("SCRIBA_SYNC_TIMEOUT", c.SyncTimeout.Duration)
+	c.DifferentialSync = envBool("SCRIBA_DIFFERENTIAL_SYNC", c.DifferentialSync)
+	c.FullSyncInterval.Duration = envDuration("SCRIBA_FULL_SYNC_INTERVAL", c.FullSyncInterval.Duration)
+	c.Concurrency = envInt("SCRIBA_CONCURRENCY", c.Concurrency)
+	c.Collect = envList("SCRIBA_COLLECT", c.Collect)
+	c.ResolvePrincipals = envBool("SCRIBA_RESOLVE_PRINCIPALS", c.ResolvePrincipals)
+	c.PrincipalCacheTTL.Duration = envDuration("SCRIBA_PRINCIPAL_CACHE_TTL", c.PrincipalCacheTTL.Duration)
+	c.ExcludeLocal = envBool("SCRIBA_EXCLUDE_LOCAL", c.ExcludeLocal)
+	c.ClusterStates = envList("SCRIBA_CLUSTER_STATES", c.ClusterStates)
+	c.KubernetesEOL.File = envString("SCRIBA_KUBERNETES_EOL_FILE", c.KubernetesEOL.File)
+	c.KubernetesEOL.Warning.Duration = envDuration("SCRIBA_KUBERNETES_EOL_WARNING", c.KubernetesEOL.Warning.Duration)
+	c.OvercommitFactor = envFloat("SCRIBA_OVERCOMMIT_FACTOR", c.OvercommitFactor)
+	c.ProbeEndpoints = envBool("SCRIBA_PROBE_ENDPOINTS", c.ProbeEndpoints)
+	c.ProbeTimeout.Duration = envDuration("SCRIBA_PROBE_TIMEOUT", c.ProbeTimeout.Duration)
+	c.DiffFormat = envString("SCRIBA_DIFF_FORMAT", c.DiffFormat)
+	c.KeyScheme = envString("SCRIBA_KEY_SCHEME", c.KeyScheme)
+	c.Slugify = envBool("SCRIBA_SLUGIFY", c.Slugify)
+	c.Layout = envString("SCRIBA_LAYOUT", c.Layout)
+	c.CompatibilityMode = envBool("SCRIBA_COMPATIBILITY_MODE", c.CompatibilityMode)
+	c.KubeContext = envString("SCRIBA_CONTEXT", c.KubeContext)
+	c.Namespace = envString("SCRIBA_NAMESPACE", c.Namespace)
+	c.ConfigMapName = envString("SCRIBA_CONFIGMAP", c.ConfigMapName)
+	c.ConfigMapMode = envString("SCRIBA_CONFIGMAP_MODE", c.ConfigMapMode)
+	c.TargetKubeconfig = envString("SCRIBA_TARGET_KUBECONFIG", c.TargetKubeconfig)
+	c.TargetContext = envString("SCRIBA_TARGET_CONTEXT", c.TargetContext)
+	c.WebhookURL = envString("SCRIBA_WEBHOOK_URL", c.WebhookURL)
+	c.TeamsWebhookURL = envString("SCRIBA_TEAMS_WEBHOOK_URL", c.TeamsWebhookURL)
+	c.Email.SMTPHost = envString("SCRIBA_SMTP_HOST", c.Email.SMTPHost)
+	c.Email.SMTPPort = envInt("SCRIBA_SMTP_PORT", c.Email.SMTPPort)
+	c.Email.Username = envString("SCRIBA_SMTP_USERNAME", c.Email.Username)
+	c.Email.Password = envString("SCRIBA_SMTP_PASSWORD", c.Email.Password)
+	c.Email.From = envString("SCRIBA_EMAIL_FROM", c.Email.From)
+	c.Email.To = envList("SCRIBA_EMAIL_TO", c.Email.To)
+	c.Email.Subject = envString("SCRIBA_EMAIL_SUBJECT", c.Email.Subject)
+	c.Email.Format = envString("SCRIBA_EMAIL_FORMAT", c.Email.Format)
+	c.Email.Interval.Duration = envDuration("SCRIBA_EMAIL_INTERVAL", c.Email.Interval.Duration)
+	c.GCS.Bucket = envString("SCRIBA_GCS_BUCKET", c.GCS.Bucket)
+	c.GCS.Prefix = envString("SCRIBA_GCS_PREFIX", c.GCS.Prefix)
+	c.GCS.Endpoint = envString("SCRIBA_GCS_ENDPOINT", c.GCS.Endpoint)
+	c.AzureBlob.Account = envString("SCRIBA_AZURE_STORAGE_ACCOUNT", c.AzureBlob.Account)
+	c.AzureBlob.Container = envString("SCRIBA_AZURE_CONTAINER", c.AzureBlob.Container)
+	c.AzureBlob.Prefix = envString("SCRIBA_AZURE_PREFIX", c.AzureBlob.Prefix)
+	c.AzureBlob.Endpoint = envString("SCRIBA_AZURE_BLOB_ENDPOINT", c.AzureBlob.Endpoint)
+	c.AzureBlob.SASToken = envString("SCRIBA_AZURE_SAS_TOKEN", c.AzureBlob.SASToken)
+	c.AzureBlob.Retention = envRetention("SCRIBA_AZURE_RETENTION", c.AzureBlob.Retention)
+	c.Redis.Addr = envString("SCRIBA_REDIS_ADDR", c.Redis.Addr)
+	c.Redis.Username = envString("SCRIBA_REDIS_USERNAME", c.Redis.Username)
+	c.Redis.Password = envString("SCRIBA_REDIS_PASSWORD", c.Redis.Password)
+	c.Redis.DB = envInt("SCRIBA_REDIS_DB", c.Redis.DB)
+	c.Redis.TLS = envBool("SCRIBA_REDIS_TLS", c.Redis.TLS)
+	c.Redis.KeyPrefix = envString("SCRIBA_REDIS_KEY_PREFIX", c.Redis.KeyPrefix)
+	c.Redis.TTL.Duration = envDuration("SCRIBA_REDIS_TTL", c.Redis.TTL.Duration)
+	c.Redis.Channel = envString("SCRIBA_REDIS_CHANNEL", c.Redis.Channel)
+	c.MQTT.Broker = envString("SCRIBA_MQTT_BROKER", c.MQTT.Broker)
+	c.MQTT.ClientID = envString("SCRIBA_MQTT_CLIENT_ID", c.MQTT.ClientID)
+	c.MQTT.Username = envString("SCRIBA_MQTT_USERNAME", c.MQTT.Username)
+	c.MQTT.Password = envString("SCRIBA_MQTT_PASSWORD", c.MQTT.Password)
+	c.MQTT.TopicPrefix = envString("SCRIBA_MQTT_TOPIC_PREFIX", c.MQTT.TopicPrefix)
+	c.MQTT.QoS = envInt("SCRIBA_MQTT_QOS", c.MQTT.QoS)
+	c.MQTT.CAFile = envString("SCRIBA_MQTT_CA_FILE", c.MQTT.CAFile)
+	c.StatsD.Addr = envString("SCRIBA_STATSD_ADDR", c.StatsD.Addr)
+	c.StatsD.Prefix = envString("SCRIBA_STATSD_PREFIX", c.StatsD.Prefix)
+	c.StatsD.Tags = envList("SCRIBA_STATSD_TAGS", c.StatsD.Tags)
+	c.KubeconfigExport.File = envString("SCRIBA_KUBECONFIG_EXPORT_FILE", c.KubeconfigExport.File)
+	c.KubeconfigExport.Secret = envString("SCRIBA_KUBECONFIG_EXPORT_SECRET", c.KubeconfigExport.Secret)
+	c.KubeconfigExport.EmbedToken = envBool("SCRIBA_KUBECONFIG_EXPORT_EMBED_TOKEN", c.KubeconfigExport.EmbedToken)
+	c.CAPIExport.File = envString("SCRIBA_CAPI_EXPORT_FILE", c.CAPIExport.File)
+	c.CAPIExport.Namespace = envString("SCRIBA_CAPI_EXPORT_NAMESPACE", c.CAPIExport.Namespace)
+	c.API.Tokens = envList("SCRIBA_API_TOKENS", c.API.Tokens)
+	c.API.TokenFile = envString("SCRIBA_API_TOKEN_FILE", c.API.TokenFile)
+	c.API.ClientCAFile = envString("SCRIBA_TLS_CLIENT_CA_FILE", c.API.ClientCAFile)
+	c.API.TLSCertFile = envString("SCRIBA_TLS_CERT_FILE", c.API.TLSCertFile)
+	c.API.TLSKeyFile = envString("SCRIBA_TLS_KEY_FILE", c.API.TLSKeyFile)
+	c.API.TLSSecret = envString("SCRIBA_TLS_SECRET", c.API.TLSSecret)
+	c.Alerting.PagerDutyRoutingKey = envString("SCRIBA_PAGERDUTY_ROUTING_KEY", c.Alerting.PagerDutyRoutingKey)
+	c.Alerting.PagerDutyURL = envString("SCRIBA_PAGERDUTY_URL", c.Alerting.PagerDutyURL)
+	c.Alerting.OpsgenieAPIKey = envString("SCRIBA_OPSGENIE_API_KEY", c.Alerting.OpsgenieAPIKey)
+	c.Alerting.OpsgenieURL = envString("SCRIBA_OPSGENIE_URL", c.Alerting.OpsgenieURL)
+	c.Alerting.FailureThreshold = envInt("SCRIBA_ALERT_FAILURE_THRESHOLD", c.Alerting.FailureThreshold)
+	c.Alerting.MaxStaleness.Duration = envDuration("SCRIBA_ALERT_MAX_STALENESS", c.Alerting.MaxStaleness.Duration)
+	c.ConfigConfigMap = envString("SCRIBA_CONFIG_CONFIGMAP", c.ConfigConfigMap)
+	c.SyncProfile = envString("SCRIBA_SYNC_PROFILE", c.SyncProfile)
+}
+
+// loadConfigFile overlays the YAML config file at path onto cfg. Unknown
+// keys are rejected so typos do not go unnoticed.
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// configFileArg returns the value of the --config flag, which has to be
+// known before the other flags are parsed.
+func configFileArg(args []string) string {
+	path := os.Getenv("SCRIBA_CONFIG")
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+		case name == "config" && i+1 < len(args):
+			path = args[i+1]
+			i++
+		case strings.HasPrefix(name, "config="):
+			path = strings.TrimPrefix(name, "config=")
+		}
+	}
+	return path
+}
+
+// loadConfig assembles the configuration from args, the config file and
+// the environment. When a config ConfigMap is named, the configuration is
+// assembled a second time with the ConfigMap's settings layered between the
+// config file and the environment.
+func loadConfig(args []string) (*Config, error) {
+	cfg, err := parseConfig(args, nil)
+	if err != nil || cfg.ConfigConfigMap == "" {
+		return cfg, err
+	}
+
+	data, err := readConfigConfigMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(args, data)
+}
+
+func parseConfig(args []string, configMapData []byte) (*Config, error) {
+	cfg, err := parseConfigLayers(args, configMapData, SyncProfile{})
+	if err != nil {
+		return nil, err
+	}
+	if err := loadSyncProfiles(cfg, configMapData); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseConfigLayers assembles the configuration from the defaults, config
+// file, config ConfigMap, environment and flags, and the settings of the
+// sync profile, if any.
+func parseConfigLayers(args []string, configMapData []byte, syncProfile SyncProfile) (*Config, error) {
+	cfg := defaultConfig()
+	cfg.args = args
+	configFile := configFileArg(args)
+	cfg.configFile = configFile
+	if configFile != "" {
+		if err := loadConfigFile(configFile, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if configMapData != nil {
+		if err := yaml.UnmarshalStrict(configMapData, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config ConfigMap: %w", err)
+		}
+	}
+	cfg.applyEnv()
+
+	cs := &cfg.CredentialSource
+	fs := flag.NewFlagSet("scriba", flag.ContinueOnError)
+	fs.String("config", configFile, "YAML config file; environment variables and flags override its settings (env SCRIBA_CONFIG)")
+	fs.StringVar(&cfg.SyncProfile, "sync-profile", cfg.SyncProfile, "run only the named sync profile; required by commands other than sync and serve when several are defined (env SCRIBA_SYNC_PROFILE)")
+	fs.StringVar(&cfg.ConfigConfigMap, "config-configmap", cfg.ConfigConfigMap, "ConfigMap in scriba's namespace with a config file under the config.yaml key, applied on top of --config (env SCRIBA_CONFIG_CONFIGMAP)")
+	fs.StringVar(&cs.Type, "credential-source", cs.Type, "where the Rancher token is read from: "+strings.Join(knownCredentialSources, ", ")+"; inferred when empty (env SCRIBA_CREDENTIAL_SOURCE)")
+	fs.StringVar(&cs.TokenFile, "rancher-token-file", cs.TokenFile, "file holding the Rancher token, re-read on every sync (env RANCHER_TOKEN_FILE)")
+	fs.StringVar(&cs.OIDC.TokenURL, "oidc-token-url", cs.OIDC.TokenURL, "OIDC token endpoint used to obtain a Rancher token with the client credentials grant (env RANCHER_OIDC_TOKEN_URL)")
+	fs.StringVar(&cs.OIDC.ClientID, "oidc-client-id", cs.OIDC.ClientID, "OIDC client ID (env RANCHER_OIDC_CLIENT_ID); the secret is read from RANCHER_OIDC_CLIENT_SECRET")
+	fs.Var((*listFlag)(&cs.OIDC.Scopes), "oidc-scopes", "comma-separated OIDC scopes to request (env RANCHER_OIDC_SCOPES)")
+	fs.StringVar(&cs.Vault.Addr, "vault-addr", cs.Vault.Addr, "Vault address (env VAULT_ADDR)")
+	fs.StringVar(&cs.Vault.AuthPath, "vault-auth-path", cs.Vault.AuthPath, "mount path of Vault's Kubernetes auth method (env VAULT_AUTH_PATH)")
+	fs.StringVar(&cs.Vault.Role, "vault-role", cs.Vault.Role, "Vault role to log in as (env VAULT_ROLE)")
+	fs.StringVar(&cs.Vault.SecretPath, "vault-secret-path", cs.Vault.SecretPath, "Vault KV path of the Rancher token, e.g. secret/data/scriba (env VAULT_SECRET_PATH)")
+	fs.DurationVar(&cs.Vault.Refresh.Duration, "vault-refresh", cs.Vault.Refresh.Duration, "how often the token is re-read from Vault (env VAULT_REFRESH)")
+	fs.StringVar(&cfg.UserAgent, "user-agent", cfg.UserAgent, "User-Agent of Rancher requests, defaults to scriba/<version> (env SCRIBA_USER_AGENT)")
+	fs.BoolVar(&cfg.DebugHTTP, "debug-http", cfg.DebugHTTP, "log every Rancher request with its status and duration, with credentials scrubbed (env SCRIBA_DEBUG_HTTP)")
+	fs.IntVar(&cfg.DebugHTTPBody, "debug-http-body", cfg.DebugHTTPBody, "with --debug-http, also log the headers and up to this many bytes of every request and response body (env SCRIBA_DEBUG_HTTP_BODY)")
+	fs.Var((*headersFlag)(&cfg.RequestHeaders), "request-headers", "comma-separated Name=value headers added to every Rancher request, e.g. X-Request-Source=scriba (env SCRIBA_REQUEST_HEADERS)")
+	fs.BoolVar(&cfg.StrictTokenPrivileges, "strict-token-privileges", cfg.StrictTokenPrivileges, "refuse to run with a Rancher token of a user with an admin global role (env SCRIBA_STRICT_TOKEN_PRIVILEGES)")
+	fs.BoolVar(&cfg.Exclusive, "exclusive", cfg.Exclusive, "remove ConfigMap keys not managed by scriba (env SCRIBA_EXCLUSIVE)")
+	fs.BoolVar(&cfg.Adopt, "adopt", cfg.Adopt, "take over existing ConfigMaps not labeled as managed by scriba (env SCRIBA_ADOPT)")
+	fs.StringVar(&cfg.KeyPrefix, "key-prefix", cfg.KeyPrefix, "share the ConfigMap with other tools, only writing and removing keys with this prefix (env SCRIBA_KEY_PREFIX)")
+	fs.StringVar(&cfg.ReportFormat, "report-format", cfg.ReportFormat, "report format: markdown or html (env SCRIBA_REPORT_FORMAT)")
+	fs.StringVar(&cfg.ReportOutput, "report-output", cfg.ReportOutput, "file the report is written to, - for stdout (env SCRIBA_REPORT_OUTPUT)")
+	fs.StringVar(&cfg.DeadLetterDir, "dead-letter-dir", cfg.DeadLetterDir, "directory the payloads of sinks failing after all retries are saved to, for scriba replay (env SCRIBA_DEAD_LETTER_DIR)")
+	fs.StringVar(&cfg.RunReport, "run-report", cfg.RunReport, "file a JSON report of the run's durations, requests, sink results and errors is written to, - for stdout (env SCRIBA_RUN_REPORT)")
+	fs.Var((*listFlag)(&cfg.AgeRecipients), "age-recipients", "comma-separated age public keys written outputs are encrypted for (env SCRIBA_AGE_RECIPIENTS)")
+	fs.StringVar(&cfg.AgeRecipientsFile, "age-recipients-file", cfg.AgeRecipientsFile, "file with age public keys, one per line, written outputs are encrypted for (env SCRIBA_AGE_RECIPIENTS_FILE)")
+	fs.StringVar(&cfg.ListenAddress, "listen-address", cfg.ListenAddress, "address the serve command listens on (env SCRIBA_LISTEN_ADDRESS)")
+	fs.BoolVar(&cfg.Proxy.Enabled, "proxy", cfg.Proxy.Enabled, "serve the Rancher clusters and projects API under /proxy from a read-through cache; requires API authentication (env SCRIBA_PROXY)")
+	fs.DurationVar(&cfg.Proxy.TTL.Duration, "proxy-ttl", cfg.Proxy.TTL.Duration, "time responses of the Rancher proxy are cached for (env SCRIBA_PROXY_TTL)")
+	fs.Var((*listFlag)(&cfg.Propagation.Annotations), "propagate-annotations", "comma-separated project annotations, or prefixes ending in *, copied onto the project's namespaces after every sync (env SCRIBA_PROPAGATE_ANNOTATIONS)")
+	fs.Var((*listFlag)(&cfg.Propagation.Labels), "propagate-labels", "comma-separated project labels, or prefixes ending in *, copied onto the project's namespaces after every sync (env SCRIBA_PROPAGATE_LABELS)")
+	fs.IntVar(&cfg.OutputBudgets.Total, "output-budget", cfg.OutputBudgets.Total, "most bytes of rendered ConfigMap data; over it, the least important keys are dropped, 0 for no limit (env SCRIBA_OUTPUT_BUDGET)")
+	fs.StringVar(&cfg.Backfill.StateFile, "backfill-state", cfg.Backfill.StateFile, "file the backfill command keeps the collected clusters in, so it can resume (env SCRIBA_BACKFILL_STATE)")
+	fs.Float64Var(&cfg.Backfill.Rate, "backfill-rate", cfg.Backfill.Rate, "Rancher requests per second of the backfill command (env SCRIBA_BACKFILL_RATE)")
+	fs.IntVar(&cfg.Backfill.Budget, "backfill-budget", cfg.Backfill.Budget, "Rancher requests after which a backfill run stops, to be resumed by the next, 0 for no limit (env SCRIBA_BACKFILL_BUDGET)")
+	fs.IntVar(&cfg.Backfill.PublishEvery, "backfill-publish-every", cfg.Backfill.PublishEvery, "number of clusters after which the backfill command publishes the inventory collected so far (env SCRIBA_BACKFILL_PUBLISH_EVERY)")
+	fs.StringVar(&cfg.API.TokenFile, "api-token-file", cfg.API.TokenFile, "file with bearer tokens accepted by the serve API, one per line (env SCRIBA_API_TOKEN_FILE); tokens can also be set in SCRIBA_API_TOKENS")
+	fs.StringVar(&cfg.API.ClientCAFile, "tls-client-ca-file", cfg.API.ClientCAFile, "CA whose client certificates are accepted by the serve API (env SCRIBA_TLS_CLIENT_CA_FILE)")
+	fs.StringVar(&cfg.API.TLSCertFile, "tls-cert-file", cfg.API.TLSCertFile, "serving certificate of the serve API (env SCRIBA_TLS_CERT_FILE)")
+	fs.StringVar(&cfg.API.TLSKeyFile, "tls-key-file", cfg.API.TLSKeyFile, "key of the serving certificate (env SCRIBA_TLS_KEY_FILE)")
+	fs.StringVar(&cfg.API.TLSSecret, "tls-secret", cfg.API.TLSSecret, "kubernetes.io/tls Secret in scriba's namespace holding the serving certificate (env SCRIBA_TLS_SECRET)")
+	fs.DurationVar(&cfg.Interval.Duration, "interval", cfg.Interval.Duration, "time between syncs in serve mode (env SCRIBA_INTERVAL)")
+	fs.DurationVar(&cfg.SyncTimeout.Duration, "sync-timeout", cfg.SyncTimeout.Duration, "wall-clock budget of a sync across all Rancher and Kubernetes requests and retries, 0 for no limit (env SCRIBA_SYNC_TIMEOUT)")
+	fs.BoolVar(&cfg.DifferentialSync, "differential-sync", cfg.DifferentialSync, "in serve mode, only collect the projects, namespaces, nodes and chart repositories of clusters changed since the previous sync (env SCRIBA_DIFFERENTIAL_SYNC)")
+	fs.DurationVar(&cfg.FullSyncInterval.Duration, "full-sync-interval", cfg.FullSyncInterval.Duration, "with --differential-sync, time after which every cluster is collected again, 0 for never (env SCRIBA_FULL_SYNC_INTERVAL)")
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "number of clusters collected in parallel (env SCRIBA_CONCURRENCY)")
+	fs.Var((*listFlag)(&cfg.Collect), "collect", "comma-separated optional collectors to run: "+strings.Join(collectorNames(), ", ")+" (env SCRIBA_COLLECT)")
+	fs.BoolVar(&cfg.ResolvePrincipals, "resolve-principals", cfg.ResolvePrincipals, "resolve the principal IDs listed by the members collector to names in the Rancher principals API (env SCRIBA_RESOLVE_PRINCIPALS)")
+	fs.DurationVar(&cfg.PrincipalCacheTTL.Duration, "principal-cache-ttl", cfg.PrincipalCacheTTL.Duration, "time resolved principal names are cached for (env SCRIBA_PRINCIPAL_CACHE_TTL)")
+	fs.BoolVar(&cfg.ExcludeLocal, "exclude-local", cfg.ExcludeLocal, "skip the local (management) cluster (env SCRIBA_EXCLUDE_LOCAL)")
+	fs.Var((*listFlag)(&cfg.ClusterStates), "cluster-states", "comma-separated cluster states to include, e.g. active (env SCRIBA_CLUSTER_STATES)")
+	fs.StringVar(&cfg.KubernetesEOL.File, "kubernetes-eol-file", cfg.KubernetesEOL.File, "YAML file mapping Kubernetes minor releases to their end of life, replacing the embedded upstream calendar (env SCRIBA_KUBERNETES_EOL_FILE)")
+	fs.DurationVar(&cfg.KubernetesEOL.Warning.Duration, "kubernetes-eol-warning", cfg.KubernetesEOL.Warning.Duration, "how long before its end of life a Kubernetes release is reported as nearing it (env SCRIBA_KUBERNETES_EOL_WARNING)")
+	fs.Float64Var(&cfg.OvercommitFactor, "overcommit-factor", cfg.OvercommitFactor, "multiple of a cluster's CPU or memory capacity its project quotas may add up to before it is reported as overcommitted (env SCRIBA_OVERCOMMIT_FACTOR)")
+	fs.BoolVar(&cfg.ProbeEndpoints, "probe-endpoints", cfg.ProbeEndpoints, "connect to the API endpoint of every cluster during a sync to record whether it is reachable (env SCRIBA_PROBE_ENDPOINTS)")
+	fs.DurationVar(&cfg.ProbeTimeout.Duration, "probe-timeout", cfg.ProbeTimeout.Duration, "timeout of the TCP connection and TLS handshake of an endpoint probe (env SCRIBA_PROBE_TIMEOUT)")
+	fs.StringVar(&cfg.DiffFormat, "diff-format", cfg.DiffFormat, "diff and compare output format: text or json (env SCRIBA_DIFF_FORMAT)")
+	fs.StringVar(&cfg.KeyScheme, "key-scheme", cfg.KeyScheme, "key ConfigMap entries by id, name or both (env SCRIBA_KEY_SCHEME)")
+	fs.BoolVar(&cfg.Slugify, "slugify", cfg.Slugify, "normalize display names used in entry keys to lowercase slugs (env SCRIBA_SLUGIFY)")
+	fs.StringVar(&cfg.Layout, "layout", cfg.Layout, "output layout: flat or nested (env SCRIBA_LAYOUT)")
+	fs.BoolVar(&cfg.CompatibilityMode, "compatibility-mode", cfg.CompatibilityMode, "write the keys of both the flat and the nested layout, e.g. while consumers migrate (env SCRIBA_COMPATIBILITY_MODE)")
+	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", cfg.Kubeconfig, "path to a kubeconfig, defaults to $KUBECONFIG, ~/.kube/config or the in-cluster config")
+	fs.StringVar(&cfg.KubeContext, "context", cfg.KubeContext, "kubeconfig context to use instead of the current context (env SCRIBA_CONTEXT)")
+	fs.StringVar(&cfg.Namespace, "namespace", cfg.Namespace, "namespace of the output ConfigMap (env SCRIBA_NAMESPACE)")
+	fs.StringVar(&cfg.ConfigMapName, "configmap", cfg.ConfigMapName, "name of the output ConfigMap (env SCRIBA_CONFIGMAP)")
+	fs.StringVar(&cfg.ConfigMapMode, "configmap-mode", cfg.ConfigMapMode, "single ConfigMap or one ConfigMap per project: single or per-project (env SCRIBA_CONFIGMAP_MODE)")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", cfg.WebhookURL, "URL the change events of each sync are posted to in serve mode (env SCRIBA_WEBHOOK_URL)")
+	fs.StringVar(&cfg.TeamsWebhookURL, "teams-webhook-url", cfg.TeamsWebhookURL, "Microsoft Teams incoming webhook notified of changes and failed syncs (env SCRIBA_TEAMS_WEBHOOK_URL)")
+	fs.StringVar(&cfg.Email.SMTPHost, "smtp-host", cfg.Email.SMTPHost, "SMTP server the report email is sent through (env SCRIBA_SMTP_HOST)")
+	fs.IntVar(&cfg.Email.SMTPPort, "smtp-port", cfg.Email.SMTPPort, "SMTP port; 465 uses implicit TLS, others STARTTLS (env SCRIBA_SMTP_PORT)")
+	fs.StringVar(&cfg.Email.Username, "smtp-username", cfg.Email.Username, "SMTP username (env SCRIBA_SMTP_USERNAME); the password is read from SCRIBA_SMTP_PASSWORD")
+	fs.StringVar(&cfg.Email.From, "email-from", cfg.Email.From, "sender of the report email (env SCRIBA_EMAIL_FROM)")
+	fs.Var((*listFlag)(&cfg.Email.To), "email-to", "comma-separated recipients of the report email (env SCRIBA_EMAIL_TO)")
+	fs.StringVar(&cfg.Email.Subject, "email-subject", cfg.Email.Subject, "subject of the report email (env SCRIBA_EMAIL_SUBJECT)")
+	fs.StringVar(&cfg.Email.Format, "email-format", cfg.Email.Format, "report email format: markdown or html (env SCRIBA_EMAIL_FORMAT)")
+	fs.DurationVar(&cfg.Email.Interval.Duration, "email-interval", cfg.Email.Interval.Duration, "time between report emails in serve mode (env SCRIBA_EMAIL_INTERVAL)")
+	fs.StringVar(&cfg.GCS.Bucket, "gcs-bucket", cfg.GCS.Bucket, "Google Cloud Storage bucket the rendered ConfigMap data is uploaded to (env SCRIBA_GCS_BUCKET)")
+	fs.StringVar(&cfg.GCS.Prefix, "gcs-prefix", cfg.GCS.Prefix, "prefix of the uploaded object names, e.g. rancher/ (env SCRIBA_GCS_PREFIX)")
+	fs.StringVar(&cfg.GCS.Endpoint, "gcs-endpoint", cfg.GCS.Endpoint, "Cloud Storage JSON API endpoint (env SCRIBA_GCS_ENDPOINT)")
+	fs.StringVar(&cfg.AzureBlob.Account, "azure-storage-account", cfg.AzureBlob.Account, "Azure storage account snapshots are written to (env SCRIBA_AZURE_STORAGE_ACCOUNT)")
+	fs.StringVar(&cfg.AzureBlob.Container, "azure-container", cfg.AzureBlob.Container, "Azure Blob container snapshots are written to (env SCRIBA_AZURE_CONTAINER); a SAS token can be set in SCRIBA_AZURE_SAS_TOKEN")
+	fs.StringVar(&cfg.AzureBlob.Prefix, "azure-prefix", cfg.AzureBlob.Prefix, "prefix of the snapshot blob names, e.g. rancher/ (env SCRIBA_AZURE_PREFIX)")
+	fs.StringVar(&cfg.AzureBlob.Endpoint, "azure-blob-endpoint", cfg.AzureBlob.Endpoint, "Blob service endpoint, defaults to https://<account>.blob.core.windows.net (env SCRIBA_AZURE_BLOB_ENDPOINT)")
+	fs.Var((*retentionFlag)(&cfg.AzureBlob.Retention), "azure-retention", "Azure Blob snapshots kept after every write, e.g. last=10,daily=30,weekly=52,monthly=12; unset keeps all (env SCRIBA_AZURE_RETENTION)")
+	fs.StringVar(&cfg.Redis.Addr, "redis-addr", cfg.Redis.Addr, "host:port of the Redis server clusters and projects are written to (env SCRIBA_REDIS_ADDR); the password is read from SCRIBA_REDIS_PASSWORD")
+	fs.StringVar(&cfg.Redis.Username, "redis-username", cfg.Redis.Username, "Redis ACL username (env SCRIBA_REDIS_USERNAME)")
+	fs.IntVar(&cfg.Redis.DB, "redis-db", cfg.Redis.DB, "Redis database (env SCRIBA_REDIS_DB)")
+	fs.BoolVar(&cfg.Redis.TLS, "redis-tls", cfg.Redis.TLS, "connect to Redis over TLS (env SCRIBA_REDIS_TLS)")
+	fs.StringVar(&cfg.Redis.KeyPrefix, "redis-key-prefix", cfg.Redis.KeyPrefix, "prefix of the Redis keys (env SCRIBA_REDIS_KEY_PREFIX)")
+	fs.DurationVar(&cfg.Redis.TTL.Duration, "redis-ttl", cfg.Redis.TTL.Duration, "time the Redis keys live unless refreshed by a sync, 0 for no expiry (env SCRIBA_REDIS_TTL)")
+	fs.StringVar(&cfg.Redis.Channel, "redis-channel", cfg.Redis.Channel, "Redis pub/sub channel change events are published to (env SCRIBA_REDIS_CHANNEL)")
+	fs.StringVar(&cfg.MQTT.Broker, "mqtt-broker", cfg.MQTT.Broker, "MQTT broker cluster documents and change events are published to, e.g. ssl://broker:8883 (env SCRIBA_MQTT_BROKER); the password is read from SCRIBA_MQTT_PASSWORD")
+	fs.StringVar(&cfg.MQTT.ClientID, "mqtt-client-id", cfg.MQTT.ClientID, "MQTT client ID (env SCRIBA_MQTT_CLIENT_ID)")
+	fs.StringVar(&cfg.MQTT.Username, "mqtt-username", cfg.MQTT.Username, "MQTT username (env SCRIBA_MQTT_USERNAME)")
+	fs.StringVar(&cfg.MQTT.TopicPrefix, "mqtt-topic-prefix", cfg.MQTT.TopicPrefix, "prefix of the MQTT topics (env SCRIBA_MQTT_TOPIC_PREFIX)")
+	fs.IntVar(&cfg.MQTT.QoS, "mqtt-qos", cfg.MQTT.QoS, "MQTT QoS level: 0, 1 or 2 (env SCRIBA_MQTT_QOS)")
+	fs.StringVar(&cfg.MQTT.CAFile, "mqtt-ca-file", cfg.MQTT.CAFile, "CA verifying the MQTT broker certificate (env SCRIBA_MQTT_CA_FILE)")
+	fs.StringVar(&cfg.StatsD.Addr, "statsd-addr", cfg.StatsD.Addr, "host:port of the StatsD server or Datadog agent sync metrics are pushed to (env SCRIBA_STATSD_ADDR)")
+	fs.StringVar(&cfg.StatsD.Prefix, "statsd-prefix", cfg.StatsD.Prefix, "prefix of the StatsD metric names (env SCRIBA_STATSD_PREFIX)")
+	fs.Var((*listFlag)(&cfg.StatsD.Tags), "statsd-tags", "comma-separated DogStatsD tags added to every metric, e.g. env:prod (env SCRIBA_STATSD_TAGS)")
+	fs.StringVar(&cfg.KubeconfigExport.File, "kubeconfig-export-file", cfg.KubeconfigExport.File, "file a merged kubeconfig with a context per cluster is written to after every sync (env SCRIBA_KUBECONFIG_EXPORT_FILE)")
+	fs.StringVar(&cfg.KubeconfigExport.Secret, "kubeconfig-export-secret", cfg.KubeconfigExport.Secret, "Secret in the output namespace the merged kubeconfig is written to (env SCRIBA_KUBECONFIG_EXPORT_SECRET)")
+	fs.BoolVar(&cfg.KubeconfigExport.EmbedToken, "kubeconfig-export-embed-token", cfg.KubeconfigExport.EmbedToken, "write scriba's Rancher token into the exported kubeconfig (env SCRIBA_KUBECONFIG_EXPORT_EMBED_TOKEN)")
+	fs.StringVar(&cfg.CAPIExport.File, "capi-export-file", cfg.CAPIExport.File, "file the clusters are written to as Cluster API Cluster manifests after every sync (env SCRIBA_CAPI_EXPORT_FILE)")
+	fs.StringVar(&cfg.CAPIExport.Namespace, "capi-export-namespace", cfg.CAPIExport.Namespace, "namespace of the exported Cluster API manifests (env SCRIBA_CAPI_EXPORT_NAMESPACE)")
+	fs.StringVar(&cfg.Alerting.PagerDutyURL, "pagerduty-url", cfg.Alerting.PagerDutyURL, "PagerDuty Events API v2 endpoint (env SCRIBA_PAGERDUTY_URL); the routing key is read from SCRIBA_PAGERDUTY_ROUTING_KEY")
+	fs.StringVar(&cfg.Alerting.OpsgenieURL, "opsgenie-url", cfg.Alerting.OpsgenieURL, "Opsgenie API URL, e.g. https://api.eu.opsgenie.com (env SCRIBA_OPSGENIE_URL); the API key is read from SCRIBA_OPSGENIE_API_KEY")
+	fs.IntVar(&cfg.Alerting.FailureThreshold, "alert-failure-threshold", cfg.Alerting.FailureThreshold, "consecutive failed syncs that open an alert in serve mode, 0 to disable (env SCRIBA_ALERT_FAILURE_THRESHOLD)")
+	fs.DurationVar(&cfg.Alerting.MaxStaleness.Duration, "alert-max-staleness", cfg.Alerting.MaxStaleness.Duration, "time without a successful sync that opens an alert in serve mode, 0 to disable (env SCRIBA_ALERT_MAX_STALENESS)")
+	fs.StringVar(&cfg.TargetKubeconfig, "target-kubeconfig", cfg.TargetKubeconfig, "kubeconfig of the cluster the ConfigMap is written to, defaults to the cluster scriba runs in (env SCRIBA_TARGET_KUBECONFIG)")
+	fs.StringVar(&cfg.TargetContext, "target-context", cfg.TargetContext, "context within --target-kubeconfig (env SCRIBA_TARGET_CONTEXT)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.positional = fs.Args()
+	if err := syncProfile.applySettings(cfg); err != nil {
+		return nil, err
+	}
+	cfg.syncProfile = syncProfile.Name
+	if cs.Type != "" && !containsString(knownCredentialSources, cs.Type) {
+		return nil, fmt.Errorf("unknown credential source %q (expected one of %s)", cs.Type, strings.Join(knownCredentialSources, ", "))
+	}
+	if err := validateRancherFallbackURLs(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.DebugHTTPBody < 0 {
+		return nil, fmt.Errorf("HTTP debug body limit must not be negative, got %d", cfg.DebugHTTPBody)
+	}
+	if err := validateRequestHeaders(cfg.RequestHeaders); err != nil {
+		return nil, err
+	}
+	if err := validateOwnership(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateKeyScheme(cfg.KeyScheme); err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.Collect {
+		if names := collectorNames(); !containsString(names, name) {
+			return nil, fmt.Errorf("unknown collector %q (expected one of %s)", name, strings.Join(names, ", "))
+		}
+	}
+	if err := validateLayout(cfg.Layout); err != nil {
+		return nil, err
+	}
+	if err := validateConfigMapMode(cfg.ConfigMapMode); err != nil {
+		return nil, err
+	}
+	if err := validateEmail(&cfg.Email); err != nil {
+		return nil, err
+	}
+	if err := validateGCS(&cfg.GCS); err != nil {
+		return nil, err
+	}
+	if err := validateAzureBlob(&cfg.AzureBlob); err != nil {
+		return nil, err
+	}
+	if err := validateRedis(&cfg.Redis); err != nil {
+		return nil, err
+	}
+	if err := validateMQTT(&cfg.MQTT); err != nil {
+		return nil, err
+	}
+	if err := validateStatsD(&cfg.StatsD); err != nil {
+		return nil, err
+	}
+	if err := validateKubeconfigExport(&cfg.KubeconfigExport); err != nil {
+		return nil, err
+	}
+	if err := validateCAPIExport(&cfg.CAPIExport); err != nil {
+		return nil, err
+	}
+	if err := validateKubernetesEOL(&cfg.KubernetesEOL); err != nil {
+		return nil, err
+	}
+	if err := validateFieldMappings(cfg.FieldMappings); err != nil {
+		return nil, err
+	}
+	if err := validateAPI(&cfg.API); err != nil {
+		return nil, err
+	}
+	if err := validateAlerting(&cfg.Alerting); err != nil {
+		return nil, err
+	}
+	if err := validateProfiles(cfg.Profiles, cfg.Namespace); err != nil {
+		return nil, err
+	}
+	if err := validateSteveResources(cfg.Steve); err != nil {
+		return nil, err
+	}
+	if err := validateGroups(cfg.Groups); err != nil {
+		return nil, err
+	}
+	if err := validateSyncProfiles(cfg.Syncs); err != nil {
+		return nil, err
+	}
+	if _, err := ageRecipients(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.FullSyncInterval.Duration < 0 {
+		return nil, fmt.Errorf("full sync interval must not be negative, got %s", cfg.FullSyncInterval.Duration)
+	}
+	if cfg.PrincipalCacheTTL.Duration < 0 {
+		return nil, fmt.Errorf("principal cache TTL must not be negative, got %s", cfg.PrincipalCacheTTL.Duration)
+	}
+	if err := validateProxy(&cfg.Proxy); err != nil {
+		return nil, err
+	}
+	if err := validateBackfill(&cfg.Backfill); err != nil {
+		return nil, err
+	}
+	if err := validateOutputBudgets(&cfg.OutputBudgets); err != nil {
+		return nil, err
+	}
+	if err := validatePropagation(&cfg.Propagation); err != nil {
+		return nil, err
+	}
+	if cfg.OvercommitFactor <= 0 {
+		return nil, fmt.Errorf("overcommit factor must be positive, got %g", cfg.OvercommitFactor)
+	}
+	if cfg.ProbeEndpoints && cfg.ProbeTimeout.Duration <= 0 {
+		return nil, fmt.Errorf("probe timeout must be positive, got %s", cfg.ProbeTimeout.Duration)
+	}
+	if cfg.SyncTimeout.Duration < 0 {
+		return nil, fmt.Errorf("sync timeout must not be negative, got %s", cfg.SyncTimeout.Duration)
+	}
+	if cfg.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", cfg.Concurrency)
+	}
+
+	return cfg, nil
+}
+
+func envString(name string, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
+
+func envList(name string, def []string) []string {
+	if v, ok := os.LookupEnv(name); ok {
+		return splitList(v)
+	}
+	return def
+}
+
+// envHeaders parses a comma-separated list of Name=value headers. An
+// unparsable value is logged and ignored.
+func envHeaders(name string, def map[string]string) map[string]string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	headers, err := splitHeaders(v)
+	if err != nil {
+		log.Printf("Ignoring %s: %v", name, err)
+		return def
+	}
+	return headers
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listFlag is a comma-separated list flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = splitList(s)
+	return nil
+}
+
+func envBool(name string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// clusterCondition is a condition of a /v3 cluster.
+type clusterCondition struct {
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	LastUpdateTime string `json:"lastUpdateTime"`
+}
+
+// setConnectivity sets whether the cluster agent is connected from the
+// Connected condition Rancher maintains for it, falling back to the
+// connected status field of Rancher versions reporting only that. A
+// connected cluster was last seen at now; a disconnected one when the
+// condition last changed, i.e. when its agent went away. Clusters
+// reporting neither are left unknown.
+func (c *Cluster) setConnectivity(conditions []clusterCondition, now time.Time) {
+	for _, condition := range conditions {
+		if condition.Type != "Connected" {
+			continue
+		}
+		connected := condition.Status == "True"
+		c.Connected = &connected
+		if !connected {
+			if t, err := time.Parse(time.RFC3339, condition.LastUpdateTime); err == nil {
+				c.LastSeen = &t
+			}
+		}
+		break
+	}
+	if c.Connected != nil && *c.Connected {
+		c.LastSeen = &now
+	}
+}
+
+// recordConnectivity exports the agent connectivity of clusters as metrics
+// and warns about disconnected clusters.
+func recordConnectivity(cfg *Config, clusters []Cluster) {
+	for _, cluster := range clusters {
+		if cluster.Connected == nil {
+			continue
+		}
+
+		connected := 0.0
+		if *cluster.Connected {
+			connected = 1
+		} else {
+			log.Printf("Warning: the agent of cluster %s is disconnected", cluster.ID)
+		}
+		metrics.setGauge("rancher_cluster_connected", "Whether the cluster agent is connected to Rancher (1) or not (0).", connected, cfg.metricLabels("cluster", cluster.ID)...)
+		if cluster.LastSeen != nil {
+			metrics.setGauge("rancher_cluster_last_seen_timestamp_seconds", "When the cluster agent was last seen connected, as a Unix timestamp.", float64(cluster.LastSeen.Unix()), cfg.metricLabels("cluster", cluster.ID)...)
+		}
+	}
+}
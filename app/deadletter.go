@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// deadLetter is a sink payload whose write failed after all retries,
+// saved for scriba replay.
+type deadLetter struct {
+	Sink      string    `json:"sink"`
+	Profile   string    `json:"profile,omitempty"`
+	Namespace string    `json:"namespace"`
+	ConfigMap string    `json:"configMap"`
+	FailedAt  time.Time `json:"failedAt"`
+	Error     string    `json:"error"`
+	sinkPayload
+}
+
+// writeDeadLetter saves the payload that s failed to write to the dead
+// letter directory and returns the file's path. The file holds the
+// unencrypted inventory, so it is only readable by its owner.
+func writeDeadLetter(cfg *Config, s sink, p *sinkPayload, failure error) (string, error) {
+	letter := deadLetter{
+		Sink:      s.name,
+		Profile:   cfg.syncProfile,
+		Namespace: cfg.Namespace,
+		ConfigMap: cfg.ConfigMapName,
+		FailedAt:  time.Now().UTC(),
+		Error:     failure.Error(),
+		sinkPayload: sinkPayload{
+			Inventory: p.Inventory,
+			Events:    p.Events,
+		},
+	}
+	if s.rendered {
+		letter.Rendered = p.Rendered
+	}
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(cfg.DeadLetterDir, 0o700); err != nil {
+		return "", err
+	}
+
+	name := []string{letter.FailedAt.Format("20060102T150405.000Z")}
+	if letter.Profile != "" {
+		name = append(name, letter.Profile)
+	}
+	name = append(name, letter.Namespace, letter.ConfigMap, letter.Sink)
+	path := filepath.Join(cfg.DeadLetterDir, strings.Join(name, "_")+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readDeadLetters returns the dead letters in dir, oldest first, by path.
+func readDeadLetters(dir string) (map[string]*deadLetter, []string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+	letters := make(map[string]*deadLetter, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var letter deadLetter
+		if err := json.Unmarshal(data, &letter); err != nil {
+			return nil, nil, fmt.Errorf("parsing dead letter %s: %w", path, err)
+		}
+		if letter.Inventory == nil {
+			return nil, nil, fmt.Errorf("dead letter %s holds no inventory", path)
+		}
+		letters[path] = &letter
+	}
+	return letters, paths, nil
+}
+
+// runReplay writes the dead letters of every sync profile to their sinks
+// again, oldest first, and removes those written successfully. Letters
+// are written with the current sink settings, so a sink whose outage
+// required a configuration change can be replayed after fixing it.
+func runReplay(cfg *Config) error {
+	configs, err := cfg.syncConfigs()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+
+	var replayed, dirs int
+	var errs []error
+	for _, pcfg := range configs {
+		if pcfg.DeadLetterDir == "" {
+			continue
+		}
+		dirs++
+		letters, paths, err := readDeadLetters(pcfg.DeadLetterDir)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			letter := letters[path]
+			if letter.Profile != pcfg.syncProfile {
+				continue
+			}
+			if err := replayDeadLetter(ctx, pcfg, letter); err != nil {
+				log.Printf("Error replaying %s: %v", path, err)
+				errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), err))
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			log.Printf("Replayed %s", path)
+			replayed++
+		}
+	}
+	if dirs == 0 {
+		return errors.New("no dead letter directory configured, set --dead-letter-dir")
+	}
+	if replayed == 0 && len(errs) == 0 {
+		log.Println("No dead letters to replay")
+		return nil
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("replayed %d dead letters, %d failed: %w", replayed, len(errs), errors.Join(errs...))
+	}
+	log.Printf("Replayed %d dead letters", replayed)
+	return nil
+}
+
+func replayDeadLetter(ctx context.Context, cfg *Config, letter *deadLetter) error {
+	s := findSink(letter.Sink)
+	if s == nil {
+		return fmt.Errorf("unknown sink %q", letter.Sink)
+	}
+	// The ConfigMap target names the objects, keys and topics written.
+	lcfg := *cfg
+	lcfg.Namespace, lcfg.ConfigMapName = letter.Namespace, letter.ConfigMap
+	if !s.enabled(&lcfg) {
+		return fmt.Errorf("the %s sink is not configured", s.title)
+	}
+	started := time.Now()
+	return recordSink(&lcfg, s.name, letter.Namespace+"/"+letter.ConfigMap, started, s.write(ctx, &lcfg, &letter.sinkPayload))
+}
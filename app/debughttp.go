@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpDebug holds the --debug-http settings: whether Rancher requests are
+// logged, and how many bytes of their headers and bodies, none when 0. It
+// is set from the configuration at startup and on reload.
+var (
+	httpDebugMu sync.RWMutex
+	httpDebug   struct {
+		enabled bool
+		body    int
+	}
+)
+
+// setHTTPDebug applies the HTTP debug logging settings of cfg to
+// subsequent Rancher requests.
+func setHTTPDebug(cfg *Config) {
+	httpDebugMu.Lock()
+	httpDebug.enabled, httpDebug.body = cfg.DebugHTTP, cfg.DebugHTTPBody
+	httpDebugMu.Unlock()
+}
+
+// redacted replaces scrubbed secrets in the debug log.
+const redacted = "[REDACTED]"
+
+// secretHeaders are logged as redacted.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Auth-Header", "X-Vault-Token"}
+
+// secretPatterns match token-like strings in URLs and bodies: bearer
+// credentials, Rancher API keys, JWTs and the values of JSON fields and
+// query parameters named like credentials.
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[^\s"',]+`), "$1 " + redacted},
+	{regexp.MustCompile(`\btoken-[a-z0-9]{5}:[a-z0-9]{20,}`), redacted},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	{regexp.MustCompile(`(?i)("[a-z_]*(token|password|secret|privatekey|accesskey|secretkey|credential)[a-z_]*"\s*:\s*)"(?:[^"\\]|\\.)*"`), `$1"` + redacted + `"`},
+	{regexp.MustCompile(`(?i)([?&][a-z_]*(token|password|secret|key)[a-z_]*=)[^&\s]*`), "${1}" + redacted},
+}
+
+// scrubSecrets replaces credentials and token-like strings in s.
+func scrubSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// scrubURL returns u without user info and with credentials scrubbed.
+func scrubURL(u *url.URL) string {
+	if u.User != nil {
+		u = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery}
+	}
+	return scrubSecrets(u.String())
+}
+
+// formatHeaders renders header sorted by name, with the values of
+// secretHeaders redacted and credentials scrubbed from the others.
+func formatHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		value := scrubSecrets(strings.Join(header[name], ", "))
+		for _, secret := range secretHeaders {
+			if strings.EqualFold(name, secret) {
+				value = redacted
+			}
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// peekBody returns up to limit bytes of *body and replaces *body with a
+// reader that still yields all of it.
+func peekBody(body *io.ReadCloser, limit int) string {
+	if *body == nil || *body == http.NoBody {
+		return ""
+	}
+	head := make([]byte, limit+1)
+	n, err := io.ReadFull(*body, head)
+	head = head[:n]
+	rest := *body
+	*body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), errReader{err}, rest), rest}
+
+	s := string(head)
+	if len(head) > limit {
+		s = string(head[:limit]) + "... (truncated)"
+	}
+	return scrubSecrets(s)
+}
+
+// errReader returns err once the peeked bytes of a body are read, unless
+// the peek simply hit the end of the body or the limit.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err == nil || r.err == io.EOF || r.err == io.ErrUnexpectedEOF {
+		return 0, io.EOF
+	}
+	return 0, r.err
+}
+
+// debugRoundTrip sends req with base and logs it when HTTP debug logging
+// is enabled.
+func debugRoundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	httpDebugMu.RLock()
+	enabled, limit := httpDebug.enabled, httpDebug.body
+	httpDebugMu.RUnlock()
+	if !enabled {
+		return base.RoundTrip(req)
+	}
+
+	var reqBody string
+	if limit > 0 && req.Body != nil {
+		reqBody = peekBody(&req.Body, limit)
+	}
+	started := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("HTTP %s %s failed after %s: %s", req.Method, scrubURL(req.URL), elapsed, scrubSecrets(err.Error()))
+		return resp, err
+	}
+	log.Printf("HTTP %s %s -> %d in %s", req.Method, scrubURL(req.URL), resp.StatusCode, elapsed)
+	if limit > 0 {
+		log.Printf("HTTP request headers: %s", formatHeaders(req.Header))
+		if reqBody != "" {
+			log.Printf("HTTP request body: %s", reqBody)
+		}
+		log.Printf("HTTP response headers: %s", formatHeaders(resp.Header))
+		if respBody := peekBody(&resp.Body, limit); respBody != "" {
+			log.Printf("HTTP response body: %s", respBody)
+		}
+	}
+	return resp, err
+}
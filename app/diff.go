@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errDriftDetected is returned by the diff command when the stored
+// ConfigMap does not match the live Rancher inventory.
+var errDriftDetected = errors.New("drift detected")
+
+type entryChange struct {
+	ID     string   `json:"id"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+type keyDiff struct {
+	Key     string        `json:"key"`
+	Added   []string      `json:"added,omitempty"`
+	Removed []string      `json:"removed,omitempty"`
+	Changed []entryChange `json:"changed,omitempty"`
+}
+
+func (d keyDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func runDiff(cfg *Config) error {
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+	inv, err := collectInventory(ctx, cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	var diffs []keyDiff
+	profiles := outputProfiles(cfg)
+	for _, p := range profiles {
+		pcfg := profileConfig(cfg, p)
+		if pcfg.ConfigMapMode == configMapModePerProject {
+			return fmt.Errorf("diff does not support the %s ConfigMap mode (profile %s)", configMapModePerProject, p.Name)
+		}
+		cm, err := getConfigMap(pcfg)
+		if err != nil {
+			return err
+		}
+		stored := map[string]string{}
+		if cm != nil {
+			stored = unprefixKeys(cm.Data, pcfg.KeyPrefix)
+		}
+
+		rendered, err := renderInventory(pcfg, p.filterInventory(inv))
+		if err != nil {
+			return err
+		}
+
+		for _, d := range diffConfigMapData(stored, rendered) {
+			// Qualify keys with their ConfigMap once several are compared.
+			if len(profiles) > 1 {
+				d.Key = pcfg.ConfigMapName + "/" + d.Key
+			}
+			diffs = append(diffs, d)
+		}
+	}
+
+	if err := printDiff(os.Stdout, diffs, cfg.DiffFormat); err != nil {
+		return err
+	}
+
+	if len(diffs) > 0 {
+		return errDriftDetected
+	}
+	return nil
+}
+
+// diffConfigMapData compares the stored and desired values of every managed
+// key entry by entry. Only keys that differ are returned.
+func diffConfigMapData(stored, desired map[string]string) []keyDiff {
+	var diffs []keyDiff
+
+	for _, key := range managedKeys {
+		// Change events describe the last sync rather than the inventory.
+		if key == "events" {
+			continue
+		}
+		before := parseEntries(stored[key])
+		after := parseEntries(desired[key])
+		d := keyDiff{Key: key}
+
+		for _, id := range sortedKeys(after) {
+			old, ok := before[id]
+			switch {
+			case !ok:
+				d.Added = append(d.Added, id)
+			case old != after[id]:
+				d.Changed = append(d.Changed, entryChange{
+					ID:     id,
+					Before: strings.Split(old, "\n"),
+					After:  strings.Split(after[id], "\n"),
+				})
+			}
+		}
+		for _, id := range sortedKeys(before) {
+			if _, ok := after[id]; !ok {
+				d.Removed = append(d.Removed, id)
+			}
+		}
+
+		if !d.empty() {
+			diffs = append(diffs, d)
+		}
+	}
+
+	return diffs
+}
+
+// parseEntries splits a rendered document into its top-level entries. Each
+// entry starts with an unindented "<id>:" line, the key quoted when it is a
+// display name that is not a plain YAML scalar, followed by indented fields.
+func parseEntries(doc string) map[string]string {
+	entries := make(map[string]string)
+
+	var id string
+	var fields []string
+	flush := func() {
+		if id != "" {
+			entries[id] = strings.Join(fields, "\n")
+		}
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			flush()
+			id, fields = strings.TrimSuffix(line, ":"), nil
+			if unquoted, err := strconv.Unquote(id); err == nil {
+				id = unquoted
+			}
+			continue
+		}
+		fields = append(fields, strings.TrimSpace(line))
+	}
+	flush()
+
+	return entries
+}
+
+func printDiff(w io.Writer, diffs []keyDiff, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if diffs == nil {
+			diffs = []keyDiff{}
+		}
+		return enc.Encode(diffs)
+	case "text", "":
+	default:
+		return fmt.Errorf("unsupported diff format %q", format)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No drift detected.")
+		return nil
+	}
+
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s:\n", d.Key)
+		for _, id := range d.Added {
+			fmt.Fprintf(w, "  + %s\n", id)
+		}
+		for _, id := range d.Removed {
+			fmt.Fprintf(w, "  - %s\n", id)
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "  ~ %s\n", c.ID)
+			for _, line := range c.Before {
+				fmt.Fprintf(w, "      - %s\n", line)
+			}
+			for _, line := range c.After {
+				fmt.Fprintf(w, "      + %s\n", line)
+			}
+		}
+	}
+	return nil
+}
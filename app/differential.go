@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// clusterRevision fingerprints the cluster as listed by Rancher. The v3
+// API has no resource versions, so the fields scriba reads stand in for
+// one: a cluster whose name, state, version, labels, node count or
+// capacity changed gets a new revision.
+func clusterRevision(c Cluster) string {
+	c.Revision = ""
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// clusterCache holds what the previous syncs of a serve loop collected for
+// every cluster, so differential sync only collects the projects,
+// namespaces, nodes and chart repositories of clusters whose revision
+// changed since. It is only used by the sync loop.
+type clusterCache struct {
+	entries  map[string]clusterCacheEntry
+	lastFull time.Time
+}
+
+type clusterCacheEntry struct {
+	revision string
+	result   clusterResult
+}
+
+func newClusterCache() *clusterCache {
+	return &clusterCache{entries: make(map[string]clusterCacheEntry)}
+}
+
+// fullSyncDue reports whether every cluster has to be collected again
+// regardless of its revision: projects and namespaces are not part of the
+// cluster, so changes to them alone go unnoticed until the next full sync.
+func (c *clusterCache) fullSyncDue(cfg *Config, now time.Time) bool {
+	if c.lastFull.IsZero() {
+		return true
+	}
+	return cfg.FullSyncInterval.Duration > 0 && now.Sub(c.lastFull) >= cfg.FullSyncInterval.Duration
+}
+
+// lookup returns the cached result of cluster if its revision is
+// unchanged.
+func (c *clusterCache) lookup(cluster Cluster) (clusterResult, bool) {
+	entry, ok := c.entries[cluster.ID]
+	if !ok || cluster.Revision == "" || entry.revision != cluster.Revision {
+		return clusterResult{}, false
+	}
+	return entry.result, true
+}
+
+// update replaces the cache with the results of the collected clusters.
+// Clusters that failed are left out so the next sync collects them again.
+func (c *clusterCache) update(clusters []Cluster, results []clusterResult, errs []error, full bool, now time.Time) {
+	entries := make(map[string]clusterCacheEntry, len(clusters))
+	for i, cluster := range clusters {
+		if errs[i] != nil {
+			continue
+		}
+		entries[cluster.ID] = clusterCacheEntry{revision: cluster.Revision, result: results[i]}
+	}
+	c.entries = entries
+	if full {
+		c.lastFull = now
+	}
+}
+
+// recordDifferentialSync exports how many clusters the last sync collected
+// and how many it took from the cache.
+func recordDifferentialSync(cfg *Config, collected, reused int) {
+	metrics.setGauge("scriba_differential_sync_clusters", "Clusters collected or reused unchanged from the previous sync by the last differential sync.", float64(collected), cfg.metricLabels("result", "collected")...)
+	metrics.setGauge("scriba_differential_sync_clusters", "Clusters collected or reused unchanged from the previous sync by the last differential sync.", float64(reused), cfg.metricLabels("result", "reused")...)
+	log.Printf("Differential sync collected %d clusters and reused %d unchanged clusters", collected, reused)
+}
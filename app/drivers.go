@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+// Driver kinds: cluster drivers (kontainer drivers) provision hosted
+// clusters, node drivers the machines of RKE1 node pools.
+const (
+	driverKindCluster = "cluster"
+	driverKindNode    = "node"
+)
+
+// Driver is a Rancher cluster or node driver. URL, the driver binary, and
+// UIURL, its UI extension, are what custom drivers are downloaded from.
+type Driver struct {
+	Kind             string   `json:"kind"`
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	Active           bool     `json:"active"`
+	Builtin          bool     `json:"builtin"`
+	URL              string   `json:"url,omitempty"`
+	UIURL            string   `json:"uiUrl,omitempty"`
+	WhitelistDomains []string `json:"whitelistDomains,omitempty"`
+}
+
+// getDrivers lists the cluster and node drivers, active or not.
+func getDrivers(ctx context.Context, rancherAPIURL string, accessToken string) ([]Driver, error) {
+	log.Println("Starting getDrivers function")
+
+	var drivers []Driver
+	for kind, collection := range map[string]string{driverKindCluster: "kontainerdrivers", driverKindNode: "nodedrivers"} {
+		var response struct {
+			Data []struct {
+				ID               string   `json:"id"`
+				Name             string   `json:"name"`
+				Active           bool     `json:"active"`
+				Builtin          bool     `json:"builtin"`
+				BuiltIn          bool     `json:"builtIn"`
+				URL              string   `json:"url"`
+				UIURL            string   `json:"uiUrl"`
+				WhitelistDomains []string `json:"whitelistDomains"`
+			} `json:"data"`
+		}
+		if err := getRancherJSON(ctx, rancherAPIURL+"/"+collection, accessToken, kind+" drivers", &response); err != nil {
+			return nil, err
+		}
+
+		for _, item := range response.Data {
+			drivers = append(drivers, Driver{
+				Kind:   kind,
+				ID:     item.ID,
+				Name:   item.Name,
+				Active: item.Active,
+				// Node drivers spell it builtin, cluster drivers builtIn.
+				Builtin:          item.Builtin || item.BuiltIn,
+				URL:              item.URL,
+				UIURL:            item.UIURL,
+				WhitelistDomains: item.WhitelistDomains,
+			})
+		}
+	}
+	sort.Slice(drivers, func(i, j int) bool {
+		if drivers[i].Kind != drivers[j].Kind {
+			return drivers[i].Kind < drivers[j].Kind
+		}
+		return drivers[i].ID < drivers[j].ID
+	})
+
+	log.Printf("Fetched %d drivers", len(drivers))
+	return drivers, nil
+}
+
+// activeDrivers returns the drivers that are active.
+func activeDrivers(drivers []Driver) []Driver {
+	var active []Driver
+	for _, driver := range drivers {
+		if driver.Active {
+			active = append(active, driver)
+		}
+	}
+	return active
+}
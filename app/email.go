@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EmailConfig configures the email sink, which sends the summary report to
+// a distribution list.
+type EmailConfig struct {
+	SMTPHost string   `json:"smtpHost,omitempty"`
+	SMTPPort int      `json:"smtpPort,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Subject  string   `json:"subject,omitempty"`
+	Format   string   `json:"format,omitempty"`
+
+	// Interval is the time between emails in serve mode.
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+func (e *EmailConfig) enabled() bool {
+	return e.SMTPHost != "" && len(e.To) > 0
+}
+
+func validateEmail(e *EmailConfig) error {
+	if !e.enabled() {
+		return nil
+	}
+	if e.From == "" {
+		return errors.New("an email sender (--email-from) is required to send the report")
+	}
+	if e.Format != "markdown" && e.Format != "html" {
+		return fmt.Errorf("unsupported email format %q (expected markdown or html)", e.Format)
+	}
+	return nil
+}
+
+func runEmail(cfg *Config) error {
+	if !cfg.Email.enabled() {
+		return errors.New("--smtp-host and --email-to are required by the email command")
+	}
+
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+	inv, err := collectInventory(ctx, cfg, nil)
+	if err != nil {
+		return err
+	}
+	return sendReportEmail(cfg, inv, nil)
+}
+
+// sendReportEmail renders the report of inv in the email format and sends
+// it. events, when given, are appended as the changes since the previous
+// email.
+func sendReportEmail(cfg *Config, inv *Inventory, events *SyncEvents) error {
+	report, err := renderReport(inv, cfg.Email.Format)
+	if err != nil {
+		return err
+	}
+	if events != nil {
+		report, err = appendChanges(report, cfg.Email.Format, events)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Sending report email to %s", strings.Join(cfg.Email.To, ", "))
+	if err := sendMail(&cfg.Email, report); err != nil {
+		return fmt.Errorf("sending report email: %w", err)
+	}
+	return nil
+}
+
+const markdownChangesTemplate = `
+## Changes since {{ .Since.Format "2006-01-02 15:04:05 MST" }}
+{{ range .Lines }}
+- {{ md . }}
+{{- else }}
+No changes.
+{{- end }}
+`
+
+const htmlChangesTemplate = `<h2>Changes since {{ .Since.Format "2006-01-02 15:04:05 MST" }}</h2>
+{{- if .Lines }}
+<ul>
+{{- range .Lines }}
+<li>{{ . }}</li>
+{{- end }}
+</ul>
+{{- else }}
+<p>No changes.</p>
+{{- end }}
+`
+
+var (
+	markdownChanges = template.Must(template.New("changes").Funcs(reportFuncs).Parse(markdownChangesTemplate))
+	htmlChanges     = htmltemplate.Must(htmltemplate.New("changes").Parse(htmlChangesTemplate))
+)
+
+// appendChanges adds a section listing events to a rendered report.
+func appendChanges(report []byte, format string, events *SyncEvents) ([]byte, error) {
+	data := struct {
+		Since time.Time
+		Lines []string
+	}{events.Since, eventLines(events.Events)}
+
+	var buf bytes.Buffer
+	if format == "html" {
+		if err := htmlChanges.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		i := bytes.LastIndex(report, []byte("</body>"))
+		if i < 0 {
+			return append(report, buf.Bytes()...), nil
+		}
+		return append(append(append([]byte(nil), report[:i]...), buf.Bytes()...), report[i:]...), nil
+	}
+
+	if err := markdownChanges.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return append(report, buf.Bytes()...), nil
+}
+
+// eventLines describes each change event in one line.
+func eventLines(events []ChangeEvent) []string {
+	var lines []string
+	for _, e := range events {
+		line := fmt.Sprintf("%s %s %s (%s)", e.Kind, e.Name, e.Type, e.ID)
+		var changes []string
+		for _, c := range e.Changes {
+			changes = append(changes, fmt.Sprintf("%s: %q → %q", c.Field, c.Old, c.New))
+		}
+		if len(changes) > 0 {
+			line += ": " + strings.Join(changes, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// sendMail sends body as the report email. Port 465 uses implicit TLS;
+// other ports upgrade with STARTTLS when the server offers it.
+func sendMail(e *EmailConfig, body []byte) error {
+	contentType := "text/plain; charset=utf-8"
+	if e.Format == "html" {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.Write(bytes.ReplaceAll(bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n")))
+
+	addr := net.JoinHostPort(e.SMTPHost, strconv.Itoa(e.SMTPPort))
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.SMTPHost)
+	}
+	if e.SMTPPort != 465 {
+		return smtp.SendMail(addr, auth, e.From, e.To, msg.Bytes())
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: e.SMTPHost})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, e.SMTPHost)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
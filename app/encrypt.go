@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageRecipients parses the configured age recipients, given inline or one
+// per line in a recipients file as accepted by age -R.
+func ageRecipients(cfg *Config) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	if len(cfg.AgeRecipients) > 0 {
+		parsed, err := age.ParseRecipients(strings.NewReader(strings.Join(cfg.AgeRecipients, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("parsing age recipients: %w", err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	if cfg.AgeRecipientsFile != "" {
+		f, err := os.Open(cfg.AgeRecipientsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		parsed, err := age.ParseRecipients(f)
+		if err != nil {
+			return nil, fmt.Errorf("parsing age recipients file %s: %w", cfg.AgeRecipientsFile, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	return recipients, nil
+}
+
+// encryptOutput encrypts rendered output for the configured age
+// recipients before it is written out. The result is ASCII armored so it
+// can be committed and diffed like any other text file. Without
+// recipients data is returned unchanged.
+func encryptOutput(cfg *Config, data []byte) ([]byte, error) {
+	recipients, err := ageRecipients(cfg)
+	if err != nil || len(recipients) == 0 {
+		return data, err
+	}
+
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
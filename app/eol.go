@@ -0,0 +1,133 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Support states of a cluster's Kubernetes minor release.
+const (
+	eolSupported = "supported"
+	eolNearing   = "nearingEol"
+	eolReached   = "eol"
+)
+
+// defaultEOLCalendar is the embedded end-of-life calendar of the upstream
+// Kubernetes minor releases.
+//
+//go:embed kubernetes-eol.yaml
+var defaultEOLCalendar []byte
+
+// KubernetesEOLConfig configures the end-of-life tracking of the clusters'
+// Kubernetes versions.
+type KubernetesEOLConfig struct {
+	// File is a YAML file mapping minor releases ("1.27") to their end of
+	// life (2024-06-28), replacing the embedded upstream calendar.
+	File string `json:"file,omitempty"`
+	// Warning is how long before its end of life a release is nearing it.
+	Warning metav1.Duration `json:"warning,omitempty"`
+
+	// calendar is the loaded calendar.
+	calendar map[string]time.Time
+}
+
+// KubernetesEOL is the support state of a cluster's Kubernetes minor
+// release.
+type KubernetesEOL struct {
+	Status string `json:"status"`
+	// Date is the release's end of life.
+	Date string `json:"date"`
+}
+
+func validateKubernetesEOL(c *KubernetesEOLConfig) error {
+	if c.Warning.Duration < 0 {
+		return fmt.Errorf("Kubernetes end-of-life warning must not be negative, got %s", c.Warning.Duration)
+	}
+	data, source := defaultEOLCalendar, "built-in"
+	if c.File != "" {
+		var err error
+		if data, err = os.ReadFile(c.File); err != nil {
+			return fmt.Errorf("reading Kubernetes end-of-life calendar: %w", err)
+		}
+		source = c.File
+	}
+	calendar, err := parseEOLCalendar(data)
+	if err != nil {
+		return fmt.Errorf("parsing Kubernetes end-of-life calendar %s: %w", source, err)
+	}
+	c.calendar = calendar
+	return nil
+}
+
+var minorReleasePattern = regexp.MustCompile(`^\d+\.\d+$`)
+
+func parseEOLCalendar(data []byte) (map[string]time.Time, error) {
+	var entries map[string]string
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	calendar := make(map[string]time.Time, len(entries))
+	for release, date := range entries {
+		if !minorReleasePattern.MatchString(release) {
+			return nil, fmt.Errorf("invalid minor release %q, expected e.g. 1.27", release)
+		}
+		t, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of life %q of %s, expected e.g. 2024-06-28", date, release)
+		}
+		calendar[release] = t
+	}
+	return calendar, nil
+}
+
+var kubernetesVersionPattern = regexp.MustCompile(`^v?(\d+\.\d+)\.`)
+
+// kubernetesEOL returns the support state of version at now, or nil for
+// versions missing from the calendar.
+func (c *KubernetesEOLConfig) kubernetesEOL(version string, now time.Time) *KubernetesEOL {
+	m := kubernetesVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return nil
+	}
+	date, ok := c.calendar[m[1]]
+	if !ok {
+		return nil
+	}
+	eol := &KubernetesEOL{Status: eolSupported, Date: date.Format(time.DateOnly)}
+	switch {
+	case !now.Before(date):
+		eol.Status = eolReached
+	case now.Add(c.Warning.Duration).After(date):
+		eol.Status = eolNearing
+	}
+	return eol
+}
+
+// setKubernetesEOL sets the support state of the clusters' Kubernetes
+// versions, exports it as metrics and warns about clusters past their end
+// of life.
+func setKubernetesEOL(cfg *Config, clusters []Cluster, now time.Time) {
+	for i := range clusters {
+		cluster := &clusters[i]
+		cluster.KubernetesEOL = cfg.KubernetesEOL.kubernetesEOL(cluster.KubernetesVersion(), now)
+		if cluster.KubernetesEOL == nil {
+			continue
+		}
+
+		eol := 0.0
+		if cluster.KubernetesEOL.Status == eolReached {
+			eol = 1
+			log.Printf("Warning: Kubernetes %s of cluster %s reached its end of life on %s", cluster.KubernetesVersion(), cluster.ID, cluster.KubernetesEOL.Date)
+		}
+		date, _ := time.Parse(time.DateOnly, cluster.KubernetesEOL.Date)
+		metrics.setGauge("rancher_cluster_kubernetes_eol", "Whether the cluster's Kubernetes minor release reached its end of life (1) or not (0).", eol, cfg.metricLabels("cluster", cluster.ID)...)
+		metrics.setGauge("rancher_cluster_kubernetes_eol_timestamp_seconds", "End of life of the cluster's Kubernetes minor release, as a Unix timestamp.", float64(date.Unix()), cfg.metricLabels("cluster", cluster.ID)...)
+	}
+}
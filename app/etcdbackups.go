@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// EtcdBackup is the etcd snapshot configuration of an RKE1 or RKE2/K3s
+// cluster. Clusters without an S3 target only keep their snapshots on the
+// etcd nodes themselves.
+type EtcdBackup struct {
+	Enabled bool `json:"enabled"`
+	// Schedule is the cron schedule of RKE2/K3s snapshots, IntervalHours
+	// the interval of RKE1 snapshots. Either is empty when the
+	// distribution's default applies.
+	Schedule      string `json:"schedule,omitempty"`
+	IntervalHours int    `json:"intervalHours,omitempty"`
+	Retention     int    `json:"retention,omitempty"`
+	// S3 is the off-site target snapshots are uploaded to. Its credentials
+	// are never read into it.
+	S3 *EtcdS3Target `json:"s3,omitempty"`
+}
+
+type EtcdS3Target struct {
+	Bucket   string `json:"bucket"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Folder   string `json:"folder,omitempty"`
+	Region   string `json:"region,omitempty"`
+}
+
+// Offsite reports whether snapshots are taken and uploaded to S3.
+func (b *EtcdBackup) Offsite() bool {
+	return b != nil && b.Enabled && b.S3 != nil
+}
+
+type rkeEtcdConfig struct {
+	DisableSnapshots     bool   `json:"disableSnapshots"`
+	SnapshotScheduleCron string `json:"snapshotScheduleCron"`
+	SnapshotRetention    int    `json:"snapshotRetention"`
+	S3                   *struct {
+		Bucket   string `json:"bucket"`
+		Endpoint string `json:"endpoint"`
+		Folder   string `json:"folder"`
+		Region   string `json:"region"`
+	} `json:"s3"`
+}
+
+func (c *rkeEtcdConfig) backup() *EtcdBackup {
+	if c == nil {
+		// RKE2 and K3s take local snapshots by default.
+		return &EtcdBackup{Enabled: true}
+	}
+	backup := &EtcdBackup{
+		Enabled:   !c.DisableSnapshots,
+		Schedule:  c.SnapshotScheduleCron,
+		Retention: c.SnapshotRetention,
+	}
+	if c.S3 != nil && c.S3.Bucket != "" {
+		backup.S3 = &EtcdS3Target{Bucket: c.S3.Bucket, Endpoint: c.S3.Endpoint, Folder: c.S3.Folder, Region: c.S3.Region}
+	}
+	return backup
+}
+
+// getEtcdBackups attaches the etcd snapshot configuration to clusters: of
+// RKE1 clusters from the /v3 API, of RKE2/K3s clusters from their
+// provisioning clusters. Other clusters, e.g. imported or hosted ones,
+// have no configuration managed by Rancher and are left without one.
+func getEtcdBackups(ctx context.Context, rancherAPIURL string, accessToken string, clusters []Cluster, provisioning []provisioningCluster) error {
+	log.Println("Starting getEtcdBackups function")
+
+	var response struct {
+		Data []struct {
+			ID        string `json:"id"`
+			RKEConfig *struct {
+				Services struct {
+					Etcd struct {
+						BackupConfig *struct {
+							Enabled        *bool `json:"enabled"`
+							IntervalHours  int   `json:"intervalHours"`
+							Retention      int   `json:"retention"`
+							S3BackupConfig *struct {
+								BucketName string `json:"bucketName"`
+								Endpoint   string `json:"endpoint"`
+								Folder     string `json:"folder"`
+								Region     string `json:"region"`
+							} `json:"s3BackupConfig"`
+						} `json:"backupConfig"`
+					} `json:"etcd"`
+				} `json:"services"`
+			} `json:"rancherKubernetesEngineConfig"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/clusters", accessToken, "RKE cluster etcd backups", &response); err != nil {
+		return err
+	}
+
+	backups := make(map[string]*EtcdBackup)
+	for _, item := range response.Data {
+		if item.RKEConfig == nil {
+			continue
+		}
+		config := item.RKEConfig.Services.Etcd.BackupConfig
+		if config == nil {
+			backups[item.ID] = &EtcdBackup{}
+			continue
+		}
+		// RKE1 snapshots are enabled unless disabled explicitly.
+		backup := &EtcdBackup{Enabled: config.Enabled == nil || *config.Enabled, IntervalHours: config.IntervalHours, Retention: config.Retention}
+		if s3 := config.S3BackupConfig; s3 != nil && s3.BucketName != "" {
+			backup.S3 = &EtcdS3Target{Bucket: s3.BucketName, Endpoint: s3.Endpoint, Folder: s3.Folder, Region: s3.Region}
+		}
+		backups[item.ID] = backup
+	}
+
+	for _, pc := range provisioning {
+		if pc.Status.ClusterName != "" && pc.Spec.RKEConfig != nil {
+			backups[pc.Status.ClusterName] = pc.Spec.RKEConfig.Etcd.backup()
+		}
+	}
+
+	for i := range clusters {
+		backup, ok := backups[clusters[i].ID]
+		if !ok {
+			continue
+		}
+		clusters[i].EtcdBackup = backup
+	}
+	return nil
+}
+
+// recordEtcdBackups exports whether the clusters upload their etcd
+// snapshots offsite as metrics.
+func recordEtcdBackups(cfg *Config, clusters []Cluster) {
+	for _, cluster := range clusters {
+		if cluster.EtcdBackup == nil {
+			continue
+		}
+		offsite := 0.0
+		if cluster.EtcdBackup.Offsite() {
+			offsite = 1
+		}
+		metrics.setGauge("scriba_cluster_etcd_offsite_backup", "Whether the cluster uploads its etcd snapshots to S3 (1) or not (0).", offsite, cfg.metricLabels("cluster", cluster.ID)...)
+	}
+}
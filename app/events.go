@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Change event types and kinds.
+const (
+	eventAdded    = "added"
+	eventRemoved  = "removed"
+	eventModified = "modified"
+
+	kindCluster = "cluster"
+	kindProject = "project"
+)
+
+// ChangeEvent describes a cluster or project that was added, removed or
+// modified between two syncs. For modifications, Changes lists the fields
+// that differ.
+type ChangeEvent struct {
+	Type      string        `json:"type"`
+	Kind      string        `json:"kind"`
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	ClusterID string        `json:"clusterId,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// SyncEvents is the change event list of one sync, as served at /events,
+// posted to webhooks and written to the events output key.
+type SyncEvents struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Since       time.Time     `json:"since"`
+	Events      []ChangeEvent `json:"events"`
+}
+
+// newSyncEvents compares the inventories of two consecutive syncs. It
+// returns nil without a previous inventory.
+func newSyncEvents(prev, cur *Inventory) *SyncEvents {
+	if prev == nil {
+		return nil
+	}
+	return &SyncEvents{
+		GeneratedAt: cur.GeneratedAt,
+		Since:       prev.GeneratedAt,
+		Events:      diffInventories(prev, cur),
+	}
+}
+
+// diffInventories returns the change events between prev and cur, ordered
+// by kind, ID and type.
+func diffInventories(prev, cur *Inventory) []ChangeEvent {
+	events := []ChangeEvent{}
+
+	prevClusters := make(map[string]Cluster)
+	for _, c := range prev.Clusters {
+		prevClusters[c.ID] = c
+	}
+	curClusters := make(map[string]Cluster)
+	for _, c := range cur.Clusters {
+		curClusters[c.ID] = c
+		old, ok := prevClusters[c.ID]
+		if !ok {
+			events = append(events, ChangeEvent{Type: eventAdded, Kind: kindCluster, ID: c.ID, Name: c.Name})
+			continue
+		}
+		if changes := clusterChanges(old, c); len(changes) > 0 {
+			events = append(events, ChangeEvent{Type: eventModified, Kind: kindCluster, ID: c.ID, Name: c.Name, Changes: changes})
+		}
+	}
+	for _, c := range prev.Clusters {
+		if _, ok := curClusters[c.ID]; !ok {
+			events = append(events, ChangeEvent{Type: eventRemoved, Kind: kindCluster, ID: c.ID, Name: c.Name})
+		}
+	}
+
+	prevProjects := make(map[string]Project)
+	for _, p := range prev.Projects {
+		prevProjects[p.ID] = p
+	}
+	curProjects := make(map[string]Project)
+	for _, p := range cur.Projects {
+		curProjects[p.ID] = p
+		old, ok := prevProjects[p.ID]
+		if !ok {
+			events = append(events, ChangeEvent{Type: eventAdded, Kind: kindProject, ID: p.ID, Name: p.Name, ClusterID: p.ClusterID})
+			continue
+		}
+		if changes := projectChanges(old, p); len(changes) > 0 {
+			events = append(events, ChangeEvent{Type: eventModified, Kind: kindProject, ID: p.ID, Name: p.Name, ClusterID: p.ClusterID, Changes: changes})
+		}
+	}
+	for _, p := range prev.Projects {
+		if _, ok := curProjects[p.ID]; !ok {
+			events = append(events, ChangeEvent{Type: eventRemoved, Kind: kindProject, ID: p.ID, Name: p.Name, ClusterID: p.ClusterID})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Kind != events[j].Kind {
+			return events[i].Kind == kindCluster
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events
+}
+
+func clusterChanges(old, cur Cluster) []FieldChange {
+	var changes []FieldChange
+	changes = appendChange(changes, "name", old.Name, cur.Name)
+	changes = appendChange(changes, "state", old.State, cur.State)
+	changes = appendChange(changes, "kubernetesVersion", old.KubernetesVersion(), cur.KubernetesVersion())
+	return changes
+}
+
+func projectChanges(old, cur Project) []FieldChange {
+	var changes []FieldChange
+	changes = appendChange(changes, "name", old.Name, cur.Name)
+
+	keys := make(map[string]bool)
+	for key := range old.Annotations {
+		keys[key] = true
+	}
+	for key := range cur.Annotations {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		changes = appendChange(changes, "annotations."+key, old.Annotations[key], cur.Annotations[key])
+	}
+	return changes
+}
+
+func appendChange(changes []FieldChange, field, old, cur string) []FieldChange {
+	if old == cur {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, Old: old, New: cur})
+}
+
+// renderEvents renders the events output key.
+func renderEvents(events *SyncEvents) (string, error) {
+	out, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("rendering change events: %w", err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/wrkode/rancher-scriba/client"
+)
+
+// Exit codes of the scriba commands, so wrapping scripts and pipelines can
+// tell failure modes apart. diff and validate exit with exitFailure when
+// they find drift or a failed check.
+const (
+	exitOK              = 0
+	exitFailure         = 1
+	exitPartial         = 2
+	exitRancherAuth     = 3
+	exitKubernetesWrite = 4
+	exitConfig          = 5
+	exitInvalidOutput   = 6
+)
+
+// The errors below also match the failure causes exported by the client
+// package, so errors.Is(err, client.ErrUnauthorized) holds for an error
+// wrapping errRancherAuth.
+var (
+	// errRancherAuth marks errors caused by a Rancher token that could not
+	// be obtained or was rejected. They are not retried.
+	errRancherAuth = newCauseError("Rancher authentication failed", client.ErrUnauthorized)
+
+	// errRancherUnavailable marks Rancher requests that got no response or
+	// a server error.
+	errRancherUnavailable = newCauseError("Rancher is unavailable", client.ErrRancherUnavailable)
+
+	// errKubernetesWrite marks errors writing the output ConfigMaps.
+	errKubernetesWrite = errors.New("writing to Kubernetes failed")
+
+	// errConfigMapTooLarge marks a rendered ConfigMap over the size limit
+	// of Kubernetes, which is refused without sending it.
+	errConfigMapTooLarge = newCauseError("ConfigMap too large", client.ErrConfigMapTooLarge)
+
+	// errPartialSync marks a sync that wrote some but not all outputs.
+	errPartialSync = client.ErrPartialSync
+
+	// errInvalidOutput marks rendered output that does not match its
+	// schema and was therefore not published.
+	errInvalidOutput = errors.New("rendered output does not match its schema")
+)
+
+// exitCode maps the error returned by a command to its exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errRancherAuth):
+		return exitRancherAuth
+	case errors.Is(err, errPartialSync):
+		return exitPartial
+	case errors.Is(err, errKubernetesWrite):
+		return exitKubernetesWrite
+	case errors.Is(err, errInvalidOutput):
+		return exitInvalidOutput
+	default:
+		return exitFailure
+	}
+}
+
+// isRancherAuthStatus reports whether a Rancher API status code means the
+// token was rejected.
+func isRancherAuthStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+func rancherAuthError(what string, status int) error {
+	return fmt.Errorf("%w: status code %d from Rancher API for %s", errRancherAuth, status, what)
+}
+
+// isRancherUnavailableStatus reports whether a Rancher API status code is
+// a server error, e.g. of a Rancher that is restarting.
+func isRancherUnavailableStatus(status int) bool {
+	return status >= http.StatusInternalServerError
+}
+
+func rancherUnavailableError(what string, status int) error {
+	return fmt.Errorf("%w: status code %d from Rancher API for %s", errRancherUnavailable, status, what)
+}
+
+// rancherRequestError marks the error of a Rancher request that got no
+// response as Rancher being unavailable, unless ctx ended.
+func rancherRequestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errRancherUnavailable, err)
+}
+
+// causeError is a sentinel with its own message that matches cause, one
+// of the failure causes of the client package, with errors.Is.
+type causeError struct {
+	msg   string
+	cause error
+}
+
+func newCauseError(msg string, cause error) error {
+	return &causeError{msg: msg, cause: cause}
+}
+
+func (e *causeError) Error() string { return e.msg }
+func (e *causeError) Unwrap() error { return e.cause }
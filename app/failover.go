@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rancherEndpoint is a Rancher installation reachable at several URLs,
+// primary first. Requests built from any of them are sent to the active
+// one.
+type rancherEndpoint struct {
+	urls         []string
+	active       int
+	failovers    int
+	lastFailover time.Time
+	lastError    string
+}
+
+// RancherEndpointStatus reports which URL of a Rancher installation with
+// fallback URLs is in use.
+type RancherEndpointStatus struct {
+	URL    string `json:"url"`
+	Active string `json:"active"`
+	// Failovers counts the switches between the URLs since scriba started,
+	// including those back to the primary URL.
+	Failovers    int        `json:"failovers"`
+	LastFailover *time.Time `json:"lastFailover,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+// rancherEndpoints holds the Rancher installations with fallback URLs by
+// primary URL. Every sync profile can use its own.
+var rancherEndpoints struct {
+	sync.Mutex
+	byURL map[string]*rancherEndpoint
+}
+
+// directRequestKey marks the context of a request that must be sent to
+// its URL even when that is not the active one, as by the health check.
+type directRequestKey struct{}
+
+func validateRancherFallbackURLs(cfg *Config) error {
+	for _, raw := range cfg.RancherFallbackURLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid Rancher fallback URL %q", raw)
+		}
+	}
+	return nil
+}
+
+// registerRancherEndpoints registers the fallback URLs of every sync
+// profile of cfg.
+func registerRancherEndpoints(cfg *Config) {
+	configs, err := cfg.syncConfigs()
+	if err != nil {
+		return
+	}
+	for _, pcfg := range configs {
+		registerRancherEndpoint(pcfg)
+	}
+}
+
+// registerRancherEndpoint registers the URLs of cfg's Rancher installation
+// and returns it, or nil when it has no fallback URLs. The active URL is
+// kept when it is still configured, e.g. on reload.
+func registerRancherEndpoint(cfg *Config) *rancherEndpoint {
+	if cfg.RancherURL == "" {
+		return nil
+	}
+	urls := []string{strings.TrimSuffix(cfg.RancherURL, "/")}
+	for _, u := range cfg.RancherFallbackURLs {
+		urls = append(urls, strings.TrimSuffix(u, "/"))
+	}
+
+	rancherEndpoints.Lock()
+	defer rancherEndpoints.Unlock()
+	if len(urls) == 1 {
+		delete(rancherEndpoints.byURL, urls[0])
+		return nil
+	}
+	if rancherEndpoints.byURL == nil {
+		rancherEndpoints.byURL = make(map[string]*rancherEndpoint)
+	}
+	e := rancherEndpoints.byURL[urls[0]]
+	if e == nil {
+		e = &rancherEndpoint{urls: urls}
+		rancherEndpoints.byURL[urls[0]] = e
+		setActiveEndpointGauges(e)
+		return e
+	}
+	active := e.urls[e.active]
+	e.urls, e.active = urls, 0
+	for i, u := range urls {
+		if u == active {
+			e.active = i
+		}
+	}
+	setActiveEndpointGauges(e)
+	return e
+}
+
+// matchRancherEndpoint returns the Rancher installation one of whose URLs
+// rawURL starts with, and the remainder of rawURL after it.
+func matchRancherEndpoint(rawURL string) (*rancherEndpoint, string) {
+	rancherEndpoints.Lock()
+	defer rancherEndpoints.Unlock()
+	for _, e := range rancherEndpoints.byURL {
+		for _, u := range e.urls {
+			rest, ok := strings.CutPrefix(rawURL, u)
+			if ok && (rest == "" || rest[0] == '/' || rest[0] == '?') {
+				return e, rest
+			}
+		}
+	}
+	return nil, ""
+}
+
+// current returns the index of the active URL, the URL and the number of
+// URLs.
+func (e *rancherEndpoint) current() (int, string, int) {
+	rancherEndpoints.Lock()
+	defer rancherEndpoints.Unlock()
+	return e.active, e.urls[e.active], len(e.urls)
+}
+
+// switchTo makes the URL with index to the active one, unless another
+// request already switched away from the URL with index from.
+func (e *rancherEndpoint) switchTo(from, to int, reason error) {
+	rancherEndpoints.Lock()
+	defer rancherEndpoints.Unlock()
+	if e.active != from || from == to || to >= len(e.urls) {
+		return
+	}
+	e.active = to
+	e.failovers++
+	e.lastFailover = time.Now().UTC()
+	if reason != nil {
+		e.lastError = reason.Error()
+		log.Printf("Warning: Rancher endpoint %s is unreachable, failing over to %s: %v", e.urls[from], e.urls[to], reason)
+	} else {
+		log.Printf("Rancher endpoint %s is reachable again, switching back from %s", e.urls[to], e.urls[from])
+	}
+	metrics.addCounter("scriba_rancher_failovers_total", "Switches of the Rancher endpoint in use between the configured URLs.", 1, "rancher", e.urls[0], "endpoint", e.urls[to])
+	setActiveEndpointGauges(e)
+}
+
+func setActiveEndpointGauges(e *rancherEndpoint) {
+	for i, u := range e.urls {
+		var active float64
+		if i == e.active {
+			active = 1
+		}
+		metrics.setGauge("scriba_rancher_endpoint_active", "Whether the Rancher endpoint is the one in use (1) or not (0).", active, "rancher", e.urls[0], "endpoint", u)
+	}
+}
+
+// sendRancherRequest sends req to the active URL of its Rancher
+// installation. When that cannot be reached the request fails over to the
+// next URL, trying each at most once; requests with a body that cannot be
+// replayed are not retried.
+func sendRancherRequest(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	e, rest := matchRancherEndpoint(req.URL.String())
+	if e == nil || req.Context().Value(directRequestKey{}) != nil {
+		resp, err := debugRoundTrip(base, req)
+		recordRequest(req, resp, err)
+		return resp, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		active, target, n := e.current()
+		r, err := retarget(req, target+rest, attempt > 1)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := debugRoundTrip(base, r)
+		recordRequest(r, resp, err)
+		if err == nil || req.Context().Err() != nil || attempt == n {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+		e.switchTo(active, (active+1)%n, err)
+	}
+}
+
+// retarget returns a copy of req for rawURL, with a fresh body on retries.
+func retarget(req *http.Request, rawURL string, retry bool) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL, r.Host = u, u.Host
+	if retry && req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// checkRancherEndpoints makes the first URL of cfg's Rancher installation
+// that answers its ping the active one before a sync, so syncs return to
+// the primary URL once it is back. When none answers, the active URL is
+// kept and the sync fails over as far as it can.
+func checkRancherEndpoints(ctx context.Context, cfg *Config) {
+	e := registerRancherEndpoint(cfg)
+	if e == nil {
+		return
+	}
+	rancherEndpoints.Lock()
+	urls, active := append([]string(nil), e.urls...), e.active
+	rancherEndpoints.Unlock()
+
+	var activeErr error
+	for i, u := range urls {
+		err := pingRancher(ctx, u)
+		if err != nil {
+			log.Printf("Rancher endpoint %s did not answer its health check: %v", u, err)
+			if i == active {
+				activeErr = err
+			}
+			continue
+		}
+		if i < active {
+			e.switchTo(active, i, nil)
+		} else if i > active {
+			e.switchTo(active, i, fmt.Errorf("health check: %w", activeErr))
+		}
+		return
+	}
+}
+
+func pingRancher(ctx context.Context, rancherURL string) error {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, directRequestKey{}, true), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", rancherURL+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// rancherEndpointStatus returns the status of the Rancher installation
+// with the primary URL rancherURL, or nil when it has no fallback URLs.
+func rancherEndpointStatus(rancherURL string) *RancherEndpointStatus {
+	rancherEndpoints.Lock()
+	defer rancherEndpoints.Unlock()
+	e := rancherEndpoints.byURL[strings.TrimSuffix(rancherURL, "/")]
+	if e == nil {
+		return nil
+	}
+	return e.status()
+}
+
+// rancherEndpointStatuses returns the status of every Rancher installation
+// with fallback URLs, by primary URL.
+func rancherEndpointStatuses() []RancherEndpointStatus {
+	rancherEndpoints.Lock()
+	defer rancherEndpoints.Unlock()
+	var statuses []RancherEndpointStatus
+	for _, key := range sortedKeys(rancherEndpoints.byURL) {
+		statuses = append(statuses, *rancherEndpoints.byURL[key].status())
+	}
+	return statuses
+}
+
+func (e *rancherEndpoint) status() *RancherEndpointStatus {
+	status := &RancherEndpointStatus{
+		URL:       e.urls[0],
+		Active:    e.urls[e.active],
+		Failovers: e.failovers,
+		LastError: e.lastError,
+	}
+	if !e.lastFailover.IsZero() {
+		last := e.lastFailover
+		status.LastFailover = &last
+	}
+	return status
+}
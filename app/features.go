@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Feature is a Rancher feature flag (/v3/features) with its effective
+// state.
+type Feature struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Default is the state the flag has unless it is set or locked.
+	Default bool `json:"default"`
+	Locked  bool `json:"locked,omitempty"`
+}
+
+type rancherFeature struct {
+	Name   string `json:"name"`
+	Value  *bool  `json:"value"`
+	Status struct {
+		Default     bool  `json:"default"`
+		LockedValue *bool `json:"lockedValue"`
+	} `json:"status"`
+}
+
+// getFeatures lists Rancher's feature flags. A locked value takes
+// precedence over the set value, which takes precedence over the default.
+func getFeatures(ctx context.Context, rancherAPIURL string, accessToken string) ([]Feature, error) {
+	log.Println("Starting getFeatures function")
+
+	var response struct {
+		Data []rancherFeature `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/features", accessToken, "features", &response); err != nil {
+		return nil, err
+	}
+
+	features := make([]Feature, 0, len(response.Data))
+	for _, item := range response.Data {
+		feature := Feature{Name: item.Name, Enabled: item.Status.Default, Default: item.Status.Default}
+		switch {
+		case item.Status.LockedValue != nil:
+			feature.Enabled, feature.Locked = *item.Status.LockedValue, true
+		case item.Value != nil:
+			feature.Enabled = *item.Value
+		}
+		features = append(features, feature)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i].Name < features[j].Name })
+
+	log.Printf("Fetched %d features", len(features))
+	return features, nil
+}
+
+// renderFeatures renders the features key: every feature flag by name with
+// whether it is enabled, so the key of two Rancher servers can be diffed.
+func renderFeatures(features []Feature) (string, error) {
+	enabled := make(map[string]bool, len(features))
+	for _, feature := range features {
+		enabled[feature.Name] = feature.Enabled
+	}
+	out, err := yaml.Marshal(enabled)
+	if err != nil {
+		return "", fmt.Errorf("rendering features: %w", err)
+	}
+	return string(out), nil
+}
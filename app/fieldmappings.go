@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Types of mapped fields.
+const (
+	fieldTypeString = "string"
+	fieldTypeInt    = "int"
+	fieldTypeBool   = "bool"
+	fieldTypeList   = "list"
+)
+
+// FieldMapping promotes an annotation of clusters and projects to a typed
+// field of the output, e.g. field.cattle.io/owner to owner. Mappings are
+// configured in the config file only.
+type FieldMapping struct {
+	Annotation string `json:"annotation"`
+	Field      string `json:"field"`
+	// Type is string (the default), int, bool or list, a comma-separated
+	// list of strings. Values that do not parse as the type are left out.
+	Type string `json:"type,omitempty"`
+	// MetricLabel also exports the field as a label of the
+	// scriba_cluster_info and scriba_project_info metrics.
+	MetricLabel bool `json:"metricLabel,omitempty"`
+}
+
+var fieldNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedFieldLabels are the labels the info metrics already have.
+var reservedFieldLabels = []string{"cluster", "project", "name", "profile"}
+
+func validateFieldMappings(mappings []FieldMapping) error {
+	fields := make(map[string]bool, len(mappings))
+	for _, m := range mappings {
+		if m.Annotation == "" {
+			return errors.New("every field mapping needs an annotation")
+		}
+		if !fieldNamePattern.MatchString(m.Field) {
+			return fmt.Errorf("field mapping of %s: invalid field name %q, expected letters, digits and underscores", m.Annotation, m.Field)
+		}
+		if fields[m.Field] {
+			return fmt.Errorf("duplicate mapped field %q", m.Field)
+		}
+		fields[m.Field] = true
+		switch m.Type {
+		case "", fieldTypeString, fieldTypeInt, fieldTypeBool, fieldTypeList:
+		default:
+			return fmt.Errorf("field mapping of %s: unsupported type %q, expected string, int, bool or list", m.Annotation, m.Type)
+		}
+		if m.MetricLabel && containsString(reservedFieldLabels, m.Field) {
+			return fmt.Errorf("field %q cannot be a metric label, it is one already", m.Field)
+		}
+	}
+	return nil
+}
+
+// mapFields returns the mapped fields of an object with the given
+// annotations, or nil if it has none of the mapped annotations.
+func mapFields(mappings []FieldMapping, annotations map[string]string, object string) map[string]interface{} {
+	var fields map[string]interface{}
+	for _, m := range mappings {
+		raw, ok := annotations[m.Annotation]
+		if !ok {
+			continue
+		}
+		var value interface{}
+		var err error
+		switch m.Type {
+		case fieldTypeInt:
+			value, err = strconv.Atoi(strings.TrimSpace(raw))
+		case fieldTypeBool:
+			value, err = strconv.ParseBool(strings.TrimSpace(raw))
+		case fieldTypeList:
+			value = splitList(raw)
+		default:
+			value = raw
+		}
+		if err != nil {
+			log.Printf("Warning: annotation %s of %s is not a valid %s: %q", m.Annotation, object, m.Type, raw)
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+		fields[m.Field] = value
+	}
+	return fields
+}
+
+// applyFieldMappings sets the mapped fields of the clusters and projects of
+// inv and exports those mapped to metric labels.
+func applyFieldMappings(cfg *Config, inv *Inventory) {
+	if len(cfg.FieldMappings) == 0 {
+		return
+	}
+	for i := range inv.Clusters {
+		cluster := &inv.Clusters[i]
+		cluster.Fields = mapFields(cfg.FieldMappings, cluster.annotations, "cluster "+cluster.ID)
+		labels := append([]string{"cluster", cluster.ID, "name", cluster.Name}, fieldLabels(cfg.FieldMappings, cluster.Fields)...)
+		metrics.setGauge("scriba_cluster_info", "Mapped fields of the cluster, as labels.", 1, cfg.metricLabels(labels...)...)
+	}
+	for i := range inv.Projects {
+		project := &inv.Projects[i]
+		project.Fields = mapFields(cfg.FieldMappings, project.Annotations, "project "+project.ID)
+		clusterID, _ := splitProjectID(*project)
+		labels := append([]string{"cluster", clusterID, "project", project.ID, "name", project.Name}, fieldLabels(cfg.FieldMappings, project.Fields)...)
+		metrics.setGauge("scriba_project_info", "Mapped fields of the project, as labels.", 1, cfg.metricLabels(labels...)...)
+	}
+}
+
+// fieldLabels returns the fields mapped to metric labels as alternating
+// label names and values. Missing fields get empty values so every series
+// has the same labels.
+func fieldLabels(mappings []FieldMapping, fields map[string]interface{}) []string {
+	var labels []string
+	for _, m := range mappings {
+		if !m.MetricLabel {
+			continue
+		}
+		value := ""
+		switch v := fields[m.Field].(type) {
+		case nil:
+		case []string:
+			value = strings.Join(v, ",")
+		default:
+			value = fmt.Sprint(v)
+		}
+		labels = append(labels, m.Field, value)
+	}
+	return labels
+}
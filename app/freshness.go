@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Staleness tells clients of the serve API how old the served inventory
+// is, so a sync loop that keeps failing shows in the data rather than only
+// in the logs.
+type Staleness struct {
+	// AgeSeconds is the time since the inventory was collected.
+	AgeSeconds float64 `json:"ageSeconds"`
+	// Stale is whether the inventory is older than StaleAfterSeconds,
+	// i.e. at least one sync failed or is overdue.
+	Stale             bool    `json:"stale"`
+	StaleAfterSeconds float64 `json:"staleAfterSeconds"`
+}
+
+// staleAfter is the age after which the served inventory is stale: the
+// alert's maximum staleness when set, otherwise two sync intervals.
+func staleAfter(cfg *Config) time.Duration {
+	if cfg.Alerting.MaxStaleness.Duration > 0 {
+		return cfg.Alerting.MaxStaleness.Duration
+	}
+	return 2 * cfg.Interval.Duration
+}
+
+func newStaleness(cfg *Config, inv *Inventory, now time.Time) *Staleness {
+	age := now.Sub(inv.GeneratedAt)
+	return &Staleness{
+		AgeSeconds:        age.Round(time.Second).Seconds(),
+		Stale:             age > staleAfter(cfg),
+		StaleAfterSeconds: staleAfter(cfg).Seconds(),
+	}
+}
+
+// serveSnapshot writes body, a rendering of the inventory collected at
+// generatedAt, with Last-Modified and ETag headers and answers conditional
+// requests. The ETag is the hash of version, the rendering without parts
+// that change between requests such as the staleness, so it is weak.
+func serveSnapshot(w http.ResponseWriter, r *http.Request, contentType string, generatedAt time.Time, version, body []byte) {
+	sum := sha256.Sum256(version)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `W/"`+hex.EncodeToString(sum[:16])+`"`)
+	// Clients may keep the snapshot but must revalidate it, since the next
+	// sync can replace it at any time.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", generatedAt, bytes.NewReader(body))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GCSConfig configures the Google Cloud Storage sink, which uploads the
+// rendered ConfigMap data to a bucket after every sync. Objects are named
+// <prefix><namespace>/<configMap>/<key>.
+type GCSConfig struct {
+	Bucket string `json:"bucket,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint is the Cloud Storage JSON API endpoint, e.g. a Private
+	// Service Connect endpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+func (g *GCSConfig) enabled() bool {
+	return g.Bucket != ""
+}
+
+func validateGCS(g *GCSConfig) error {
+	if !g.enabled() {
+		return nil
+	}
+	if strings.Contains(g.Bucket, "/") {
+		return fmt.Errorf("GCS bucket %q must be a bucket name, not a path; set the path with --gcs-prefix", g.Bucket)
+	}
+	if strings.HasPrefix(g.Prefix, "/") {
+		return fmt.Errorf("GCS prefix %q must not start with a slash", g.Prefix)
+	}
+	if _, err := url.ParseRequestURI(g.Endpoint); err != nil {
+		return fmt.Errorf("invalid GCS endpoint %q: %w", g.Endpoint, err)
+	}
+	return nil
+}
+
+// gcsToken caches the access token of the pod's Google service account
+// until shortly before it expires.
+var gcsToken struct {
+	sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// gcsAccessToken returns an access token from the GKE metadata server,
+// which with Workload Identity issues tokens of the Google service account
+// bound to scriba's Kubernetes service account. GCE_METADATA_HOST
+// overrides the metadata server as in Google's client libraries.
+func gcsAccessToken(ctx context.Context, client *http.Client) (string, error) {
+	gcsToken.Lock()
+	defer gcsToken.Unlock()
+	if gcsToken.value != "" && time.Now().Before(gcsToken.expires) {
+		return gcsToken.value, nil
+	}
+
+	host := envString("GCE_METADATA_HOST", "metadata.google.internal")
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting a token from the metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("metadata server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding the metadata server token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("metadata server returned no access token")
+	}
+
+	gcsToken.value = token.AccessToken
+	gcsToken.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return gcsToken.value, nil
+}
+
+// uploadToGCS uploads every rendered key as an object, encrypted for the
+// configured age recipients.
+func uploadToGCS(ctx context.Context, cfg *Config, rendered map[string]string) error {
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}, Timeout: 30 * time.Second}
+
+	keys := make([]string, 0, len(rendered))
+	for key := range rendered {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		data, err := encryptOutput(cfg, []byte(rendered[key]))
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", key, err)
+		}
+		object := cfg.GCS.Prefix + cfg.Namespace + "/" + cfg.ConfigMapName + "/" + key
+		if err := withRetry(ctx, func() error { return putGCSObject(ctx, client, &cfg.GCS, object, data) }); err != nil {
+			return fmt.Errorf("uploading gs://%s/%s: %w", cfg.GCS.Bucket, object, err)
+		}
+	}
+	log.Printf("Uploaded %d objects to gs://%s/%s%s/%s/", len(keys), cfg.GCS.Bucket, cfg.GCS.Prefix, cfg.Namespace, cfg.ConfigMapName)
+	return nil
+}
+
+func putGCSObject(ctx context.Context, client *http.Client, g *GCSConfig, object string, data []byte) error {
+	token, err := gcsAccessToken(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(g.Endpoint, "/") + "/upload/storage/v1/b/" + url.PathEscape(g.Bucket) + "/o?uploadType=media&name=" + url.QueryEscape(object)
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code from Cloud Storage: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Groups split the inventory into named sets of clusters selected by their
+// Rancher labels, e.g. prod: "env=prod". Every group is written to its own
+// ConfigMap next to each output profile's, named <configMap>-<group>, so a
+// consumer interested in one environment reads only that ConfigMap.
+
+// groupProfiles returns a profile per group derived from p, restricted to
+// the clusters matching the group's selector. Groups do not apply to the
+// per-project ConfigMap mode, whose ConfigMaps are already scoped.
+func groupProfiles(cfg *Config, p Profile) []Profile {
+	if profileConfig(cfg, p).ConfigMapMode == configMapModePerProject {
+		return nil
+	}
+
+	names := sortedKeys(cfg.Groups)
+	profiles := make([]Profile, 0, len(names))
+	for _, name := range names {
+		gp := p
+		gp.Name = p.Name + "/" + name
+		gp.ConfigMap = p.ConfigMap + "-" + name
+		gp.ClusterSelector = cfg.Groups[name]
+		gp.group, gp.groupOutput = name, p.ConfigMap
+		profiles = append(profiles, gp)
+	}
+	return profiles
+}
+
+// matchesSelector reports whether the cluster's labels match selector. An
+// empty selector matches every cluster.
+func (c Cluster) matchesSelector(selector string) bool {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		// Selectors are validated when the configuration is loaded.
+		return false
+	}
+	return sel.Matches(labels.Set(c.Labels))
+}
+
+func validateGroups(groups map[string]string) error {
+	for _, name := range sortedKeys(groups) {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return fmt.Errorf("invalid group name %q: %s", name, errs[0])
+		}
+		if groups[name] == "" {
+			return fmt.Errorf("group %q needs a label selector", name)
+		}
+		if _, err := labels.Parse(groups[name]); err != nil {
+			return fmt.Errorf("group %q: invalid label selector: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// clusterIDs returns the set of cluster IDs in inv.
+func (inv *Inventory) clusterIDs() map[string]bool {
+	ids := make(map[string]bool, len(inv.Clusters))
+	for _, cluster := range inv.Clusters {
+		ids[cluster.ID] = true
+	}
+	return ids
+}
+
+// labelGroup is set on group ConfigMaps, together with labelOutput holding
+// the ConfigMap of the profile they were derived from, so the ConfigMaps
+// of groups removed from the configuration can be found.
+const labelGroup = "scriba.rancher.io/group"
+
+// pruneGroupConfigMaps deletes the group ConfigMaps that scriba wrote for
+// the output profiles of cfg and whose group is no longer configured. The
+// ConfigMaps of per-project profiles are pruned by writeProjectConfigMaps.
+func pruneGroupConfigMaps(ctx context.Context, cfg *Config) error {
+	profiles := cfg.Profiles
+	if len(profiles) == 0 {
+		profiles = []Profile{{Name: "default", ConfigMap: cfg.ConfigMapName}}
+	}
+
+	var errs []error
+	for _, p := range profiles {
+		pcfg := profileConfig(cfg, p)
+		if pcfg.ConfigMapMode == configMapModePerProject || pcfg.KeyPrefix != "" {
+			continue
+		}
+		clientset, err := getTargetKubeClient(pcfg)
+		if err != nil {
+			return err
+		}
+
+		hasGroup, err := labels.NewRequirement(labelGroup, selection.Exists, nil)
+		if err != nil {
+			return err
+		}
+		selector := labels.SelectorFromSet(labels.Set{labelManagedBy: managedByScriba, labelOutput: p.ConfigMap}).Add(*hasGroup)
+
+		cmClient := clientset.CoreV1().ConfigMaps(pcfg.Namespace)
+		list, err := cmClient.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing group ConfigMaps of %s/%s: %w", pcfg.Namespace, p.ConfigMap, err))
+			continue
+		}
+		for _, cm := range list.Items {
+			group := cm.Labels[labelGroup]
+			if _, ok := cfg.Groups[group]; ok {
+				continue
+			}
+			log.Printf("Deleting ConfigMap '%s/%s' of removed group %s", pcfg.Namespace, cm.Name, group)
+			if err := cmClient.Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("deleting ConfigMap %s/%s: %w", pcfg.Namespace, cm.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rancherHeaders holds the User-Agent and extra headers sent with every
+// Rancher request, so Rancher audit logs and API gateways can attribute
+// scriba's traffic. They are set from the configuration at startup and on
+// reload.
+var (
+	rancherHeadersMu sync.RWMutex
+	rancherHeaders   = http.Header{"User-Agent": {defaultUserAgent()}}
+)
+
+func defaultUserAgent() string {
+	return "scriba/" + version
+}
+
+// setRancherHeaders applies the User-Agent and request headers of cfg to
+// subsequent Rancher requests.
+func setRancherHeaders(cfg *Config) {
+	header := make(http.Header)
+	for name, value := range cfg.RequestHeaders {
+		header.Set(name, value)
+	}
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	header.Set("User-Agent", userAgent)
+
+	rancherHeadersMu.Lock()
+	rancherHeaders = header
+	rancherHeadersMu.Unlock()
+}
+
+// headerTransport adds the Rancher request headers to every request it
+// sends, paces it with the rate limit of scriba backfill, fails over to
+// the fallback URLs of the Rancher installation, logs the request with
+// --debug-http and counts it for the run report. Headers set on the
+// request itself take precedence.
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rancherHeadersMu.RLock()
+	header := rancherHeaders
+	rancherHeadersMu.RUnlock()
+
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	for name, values := range header {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+	if err := waitRancherRateLimit(req.Context()); err != nil {
+		return nil, err
+	}
+	return sendRancherRequest(t.base, req)
+}
+
+func validateRequestHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid request header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for request header %s", name)
+		}
+	}
+	return nil
+}
+
+// splitHeaders parses a comma-separated list of Name=value request headers.
+func splitHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, item := range splitList(s) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid request header %q (expected Name=value)", item)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// headersFlag is a comma-separated Name=value request header flag.
+type headersFlag map[string]string
+
+func (h *headersFlag) String() string {
+	var items []string
+	for name, value := range *h {
+		items = append(items, name+"="+value)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (h *headersFlag) Set(s string) error {
+	headers, err := splitHeaders(s)
+	if err != nil {
+		return err
+	}
+	*h = headers
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// runImport writes a saved inventory, as served at /inventory, to the
+// ConfigMaps and sinks without contacting Rancher, e.g. to seed a new
+// environment or to restore a deleted ConfigMap while Rancher is down.
+func runImport(cfg *Config) error {
+	if len(cfg.positional) != 1 {
+		return errors.New("usage: scriba import [flags] <snapshot.json>, - reads the snapshot from stdin")
+	}
+	inv, err := readSnapshot(cfg.positional[0])
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Importing the inventory collected at %s (%s ago): %d clusters, %d projects",
+		inv.GeneratedAt.Format(time.RFC3339), time.Since(inv.GeneratedAt).Round(time.Second), len(inv.Clusters), len(inv.Projects))
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+	return publishProfiles(ctx, cfg, nil, inv)
+}
+
+// readSnapshot reads a JSON inventory from path, or from stdin for "-".
+func readSnapshot(path string) (*Inventory, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("parsing snapshot %s: %w", path, err)
+	}
+	// An inventory always records when it was collected; without it the
+	// file is not a snapshot, e.g. the data of a single ConfigMap key.
+	if inv.GeneratedAt.IsZero() {
+		return nil, fmt.Errorf("snapshot %s is not an inventory: generatedAt is missing", path)
+	}
+	return &inv, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+	"golang.org/x/term"
+)
+
+// keyringService names the OS keychain entries of scriba login, which are
+// keyed by Rancher URL: the macOS Keychain, the Windows Credential Manager
+// or the Secret Service (GNOME Keyring, KWallet) on Linux.
+const keyringService = "rancher-scriba"
+
+func keyringAccount(rancherURL string) string {
+	return strings.TrimSuffix(rancherURL, "/")
+}
+
+// keyringTokenSource returns the token stored by scriba login for the
+// Rancher URL. It is read once: every keychain access may prompt the user.
+func keyringTokenSource(rancherURL string) (oauth2.TokenSource, error) {
+	token, err := keyring.Get(keyringService, keyringAccount(rancherURL))
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no Rancher token stored in the OS keychain for %s, run scriba login", rancherURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the Rancher token from the OS keychain: %w", err)
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+}
+
+// hasKeyringToken reports whether scriba login stored a token for the
+// Rancher URL. Keychains that cannot be reached, e.g. in a container, have
+// none.
+func hasKeyringToken(rancherURL string) bool {
+	if rancherURL == "" {
+		return false
+	}
+	_, err := keyring.Get(keyringService, keyringAccount(rancherURL))
+	return err == nil
+}
+
+// runLogin stores a Rancher API token in the OS keychain, so commands run
+// from a workstation find it without RANCHER_TOKEN_KEY. The token is taken
+// from RANCHER_TOKEN_KEY when set, otherwise read from stdin, and checked
+// against Rancher before it is stored.
+func runLogin(cfg *Config) error {
+	if cfg.RancherURL == "" {
+		return errors.New("RANCHER_SERVER_URL is not set")
+	}
+	token := cfg.RancherToken
+	if token == "" {
+		var err error
+		if token, err = readToken(fmt.Sprintf("Rancher API token for %s: ", cfg.RancherURL)); err != nil {
+			return err
+		}
+	}
+
+	user, err := currentUsername(cfg, token)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(keyringService, keyringAccount(cfg.RancherURL), token); err != nil {
+		return fmt.Errorf("storing the Rancher token in the OS keychain: %w", err)
+	}
+	log.Printf("Logged in to %s as %s, the token is stored in the OS keychain", cfg.RancherURL, user)
+	return nil
+}
+
+// runLogout removes the token stored by scriba login.
+func runLogout(cfg *Config) error {
+	if cfg.RancherURL == "" {
+		return errors.New("RANCHER_SERVER_URL is not set")
+	}
+	err := keyring.Delete(keyringService, keyringAccount(cfg.RancherURL))
+	if errors.Is(err, keyring.ErrNotFound) {
+		log.Printf("No Rancher token stored for %s", cfg.RancherURL)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("removing the Rancher token from the OS keychain: %w", err)
+	}
+	log.Printf("Removed the Rancher token for %s from the OS keychain", cfg.RancherURL)
+	return nil
+}
+
+// readToken reads a token from stdin, without echoing it when stdin is a
+// terminal.
+func readToken(prompt string) (string, error) {
+	var token string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		data, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("reading the token: %w", err)
+		}
+		token = string(data)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading the token from stdin: %w", err)
+		}
+		token = line
+	}
+	if token = strings.TrimSpace(token); token == "" {
+		return "", errors.New("no token given")
+	}
+	return token, nil
+}
+
+// currentUsername returns the name of the user token belongs to, failing
+// when Rancher rejects the token.
+func currentUsername(cfg *Config, token string) (string, error) {
+	req, err := http.NewRequest("GET", cfg.RancherURL+"/v3/users?me=true", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if isRancherAuthStatus(resp.StatusCode) {
+		return "", rancherAuthError("current user", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from /v3/users", resp.StatusCode)
+	}
+
+	var users struct {
+		Data []struct {
+			Username string `json:"username"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return "", err
+	}
+	if len(users.Data) == 0 {
+		return "", errors.New("Rancher returned no user for the token")
+	}
+	return users.Data[0].Username, nil
+}
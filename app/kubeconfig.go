@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigExportConfig configures the merged kubeconfig written after
+// every sync: one context per collected cluster, reaching the cluster
+// through Rancher's authentication proxy (/k8s/clusters/<id>), so
+// operators can switch between clusters with kubectx.
+type KubeconfigExportConfig struct {
+	// File is the path the kubeconfig is written to.
+	File string `json:"file,omitempty"`
+	// Secret is the Secret in the output namespace the kubeconfig is
+	// written to, under the config key.
+	Secret string `json:"secret,omitempty"`
+	// EmbedToken writes scriba's Rancher token into the kubeconfig.
+	// Without it the rancher user has no credentials and every operator
+	// sets their own token with kubectl config set-credentials rancher.
+	EmbedToken bool `json:"embedToken,omitempty"`
+}
+
+func (k *KubeconfigExportConfig) enabled() bool {
+	return k.File != "" || k.Secret != ""
+}
+
+func validateKubeconfigExport(k *KubeconfigExportConfig) error {
+	if k.Secret == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(k.Secret); len(errs) > 0 {
+		return fmt.Errorf("invalid kubeconfig export Secret name %q: %s", k.Secret, errs[0])
+	}
+	return nil
+}
+
+// kubeconfigUser is the user of every context of the exported kubeconfig.
+const kubeconfigUser = "rancher"
+
+// kubeconfigSecretKey is the key of the kubeconfig in the exported Secret.
+const kubeconfigSecretKey = "config"
+
+// buildKubeconfig returns the merged kubeconfig of the clusters of inv.
+// Contexts and clusters are named after the Rancher cluster names, which
+// are unique, falling back to the cluster ID.
+func buildKubeconfig(cfg *Config, inv *Inventory, caCerts, token string) *clientcmdapi.Config {
+	kubeconfig := clientcmdapi.NewConfig()
+	user := clientcmdapi.NewAuthInfo()
+	user.Token = token
+	kubeconfig.AuthInfos[kubeconfigUser] = user
+
+	clusters := append([]Cluster(nil), inv.Clusters...)
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ID < clusters[j].ID })
+	for _, cluster := range clusters {
+		name := cluster.Name
+		if name == "" || kubeconfig.Contexts[name] != nil {
+			name = cluster.ID
+		}
+
+		entry := clientcmdapi.NewCluster()
+		entry.Server = cfg.RancherURL + "/k8s/clusters/" + cluster.ID
+		if caCerts != "" {
+			entry.CertificateAuthorityData = []byte(caCerts)
+		}
+		kubeconfig.Clusters[name] = entry
+
+		kubeContext := clientcmdapi.NewContext()
+		kubeContext.Cluster = name
+		kubeContext.AuthInfo = kubeconfigUser
+		kubeconfig.Contexts[name] = kubeContext
+	}
+	return kubeconfig
+}
+
+// getRancherCACerts returns the CA certificates of a Rancher server with a
+// private CA, or an empty string when its certificate is publicly trusted.
+func getRancherCACerts(ctx context.Context, rancherAPIURL string, accessToken string) (string, error) {
+	var setting struct {
+		Value string `json:"value"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/settings/cacerts", accessToken, "CA certificates", &setting); err != nil {
+		return "", err
+	}
+	return setting.Value, nil
+}
+
+// exportKubeconfig writes the merged kubeconfig of inv to the configured
+// file and Secret. Rancher's CA certificates are added when Rancher can
+// be reached, so import also works while it is down.
+func exportKubeconfig(ctx context.Context, cfg *Config, inv *Inventory) error {
+	k := &cfg.KubeconfigExport
+	log.Println("Starting exportKubeconfig function")
+
+	var token, caCerts string
+	accessToken, err := getRancherToken(cfg)
+	if err == nil {
+		caCerts, err = getRancherCACerts(ctx, cfg.RancherURL+"/v3", accessToken)
+	}
+	if err != nil {
+		log.Printf("Warning: could not read the CA certificates of Rancher, the kubeconfig relies on the system trust store: %v", err)
+	}
+	if k.EmbedToken {
+		if accessToken == "" {
+			return fmt.Errorf("embedding the Rancher token into the kubeconfig: %w", err)
+		}
+		token = accessToken
+	}
+
+	data, err := clientcmd.Write(*buildKubeconfig(cfg, inv, caCerts, token))
+	if err != nil {
+		return fmt.Errorf("rendering kubeconfig: %w", err)
+	}
+
+	if k.File != "" {
+		started := time.Now()
+		// The kubeconfig can hold a token, so only the owner may read it.
+		err := recordSink(cfg, "kubeconfig", k.File, started, os.WriteFile(k.File, data, 0o600))
+		if err != nil {
+			return fmt.Errorf("writing kubeconfig: %w", err)
+		}
+		log.Printf("Wrote a kubeconfig with %d contexts to %s", len(inv.Clusters), k.File)
+	}
+	if k.Secret != "" {
+		started := time.Now()
+		target := cfg.Namespace + "/" + k.Secret
+		if err := recordSink(cfg, "kubeconfig", target, started, writeKubeconfigSecret(ctx, cfg, data)); err != nil {
+			return fmt.Errorf("%w: writing kubeconfig Secret %s: %w", errKubernetesWrite, target, err)
+		}
+		log.Printf("Wrote a kubeconfig with %d contexts to Secret '%s'", len(inv.Clusters), target)
+	}
+	return nil
+}
+
+// writeKubeconfigSecret creates or updates the kubeconfig Secret. An
+// existing Secret not created by scriba is only taken over with --adopt.
+func writeKubeconfigSecret(ctx context.Context, cfg *Config, data []byte) error {
+	clientset, err := getTargetKubeClient(cfg)
+	if err != nil {
+		return err
+	}
+	secrets := clientset.CoreV1().Secrets(cfg.Namespace)
+
+	secret, err := secrets.Get(ctx, cfg.KubeconfigExport.Secret, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cfg.KubeconfigExport.Secret,
+				Namespace: cfg.Namespace,
+				Labels:    map[string]string{labelManagedBy: managedByScriba},
+			},
+			Data: map[string][]byte{kubeconfigSecretKey: data},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if secret.Labels[labelManagedBy] != managedByScriba {
+		if !cfg.Adopt {
+			return fmt.Errorf("Secret %s/%s is not managed by rancher-scriba (missing label %s=%s); set --adopt to take it over",
+				cfg.Namespace, secret.Name, labelManagedBy, managedByScriba)
+		}
+		log.Printf("Adopting Secret '%s/%s'", cfg.Namespace, secret.Name)
+		if secret.Labels == nil {
+			secret.Labels = make(map[string]string)
+		}
+		secret.Labels[labelManagedBy] = managedByScriba
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[kubeconfigSecretKey] = data
+	_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
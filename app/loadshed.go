@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// OutputBudgets bound the size of the rendered ConfigMap data. When a
+// budget is exceeded, the keys listed in Shed are dropped, first listed
+// first, until the data fits, so an estate outgrowing its ConfigMap loses
+// its least important keys instead of failing the whole update.
+type OutputBudgets struct {
+	// Total is the most bytes of rendered data, keys included, written to
+	// the ConfigMap and the sinks, 0 for no limit.
+	Total int `json:"total,omitempty"`
+	// Keys bounds single keys by name, e.g. resources: 200000. Config
+	// file only.
+	Keys map[string]int `json:"keys,omitempty"`
+	// Shed orders the keys that may be dropped, defaulting to
+	// defaultShedOrder. Keys not listed are never dropped. Config file
+	// only.
+	Shed []string `json:"shed,omitempty"`
+}
+
+// defaultShedOrder drops the collected resources first and never the
+// clusters, projects and inventory keys.
+var defaultShedOrder = []string{"resources", "events", "unassignedNamespaces", "orphans", "features", "summary"}
+
+// shedAnnotation lists the keys dropped from the ConfigMap by the last
+// update, and is removed once nothing is dropped.
+const shedAnnotation = "scriba.rancher.io/shed-keys"
+
+func (b *OutputBudgets) enabled() bool {
+	return b.Total > 0 || len(b.Keys) > 0
+}
+
+func (b *OutputBudgets) shedOrder() []string {
+	if len(b.Shed) > 0 {
+		return b.Shed
+	}
+	return defaultShedOrder
+}
+
+func validateOutputBudgets(b *OutputBudgets) error {
+	if b.Total < 0 {
+		return fmt.Errorf("output budget must not be negative, got %d", b.Total)
+	}
+	for key, budget := range b.Keys {
+		if !isManagedKey(key) {
+			return fmt.Errorf("output budget for unknown key %q (expected one of %s)", key, strings.Join(managedKeys, ", "))
+		}
+		if budget <= 0 {
+			return fmt.Errorf("output budget of %s must be positive, got %d", key, budget)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, key := range b.Shed {
+		if !isManagedKey(key) {
+			return fmt.Errorf("unknown key %q in the shed order (expected one of %s)", key, strings.Join(managedKeys, ", "))
+		}
+		if seen[key] {
+			return fmt.Errorf("key %s is listed twice in the shed order", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// shedOutput drops keys from rendered in the shed order until every key
+// is within its budget and all of them within the total, and returns the
+// dropped keys. Keys that cannot be dropped are left in place even when
+// over budget; the ConfigMap update then fails if they exceed its limit.
+func shedOutput(cfg *Config, rendered map[string]string) []string {
+	b := &cfg.OutputBudgets
+	if !b.enabled() {
+		return nil
+	}
+	var shed []string
+	drop := func(key, reason string) {
+		log.Printf("Warning: dropping the %s key of %s/%s, %s", key, cfg.Namespace, cfg.ConfigMapName, reason)
+		delete(rendered, key)
+		shed = append(shed, key)
+	}
+
+	order := b.shedOrder()
+	for _, key := range sortedKeys(b.Keys) {
+		value, ok := rendered[key]
+		if !ok || len(key)+len(value) <= b.Keys[key] {
+			continue
+		}
+		if !containsString(order, key) {
+			log.Printf("Warning: the %s key of %s/%s exceeds its budget of %d bytes but is not in the shed order", key, cfg.Namespace, cfg.ConfigMapName, b.Keys[key])
+			continue
+		}
+		drop(key, fmt.Sprintf("its %d bytes exceed its budget of %d", len(key)+len(value), b.Keys[key]))
+	}
+
+	if b.Total > 0 {
+		for _, key := range order {
+			size := renderedSize(rendered)
+			if size <= b.Total {
+				break
+			}
+			if _, ok := rendered[key]; ok {
+				drop(key, fmt.Sprintf("the output's %d bytes exceed the budget of %d", size, b.Total))
+			}
+		}
+		if size := renderedSize(rendered); size > b.Total {
+			log.Printf("Warning: the output of %s/%s is %d bytes, over the budget of %d, with every key of the shed order dropped", cfg.Namespace, cfg.ConfigMapName, size, b.Total)
+		}
+	}
+
+	for _, key := range managedKeys {
+		var dropped float64
+		if containsString(shed, key) {
+			dropped = 1
+		}
+		metrics.setGauge("scriba_output_shed", "Whether the key was dropped from the output by the last update for exceeding a size budget (1) or not (0).", dropped,
+			cfg.metricLabels("configmap", cfg.Namespace+"/"+cfg.ConfigMapName, "key", key)...)
+	}
+	if len(shed) > 0 {
+		recordShed(cfg, cfg.Namespace+"/"+cfg.ConfigMapName, shed)
+	}
+	return shed
+}
+
+func renderedSize(rendered map[string]string) int {
+	size := 0
+	for key, value := range rendered {
+		size += len(key) + len(value)
+	}
+	return size
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// MachineConfig describes the machine shape of an RKE1 node template or an
+// RKE2/K3s machine config (rke-machine-config.cattle.io), i.e. what the
+// nodes of the clusters using it are built from.
+type MachineConfig struct {
+	Kind         string `json:"kind"`
+	Namespace    string `json:"namespace,omitempty"`
+	Name         string `json:"name"`
+	Provider     string `json:"provider"`
+	InstanceType string `json:"instanceType,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Region       string `json:"region,omitempty"`
+	// Clusters lists the IDs of the clusters whose node or machine pools
+	// use the config.
+	Clusters []string `json:"clusters,omitempty"`
+}
+
+const kindNodeTemplate = "NodeTemplate"
+
+// The driver fields holding the machine shape, by the first one set. The
+// drivers name them differently, e.g. instanceType (amazonec2), size
+// (azure, digitalocean) or machineType (google).
+var (
+	instanceTypeFields = []string{"instanceType", "size", "machineType", "vmSize", "flavorName"}
+	imageFields        = []string{"ami", "image", "machineImage", "imageName", "imageId", "cloneFrom", "template"}
+	regionFields       = []string{"region", "location", "zone", "datacenter", "availabilityZone"}
+)
+
+// getMachineConfigs collects the node templates and the machine configs
+// referenced by the machine pools of clusters, which must already carry
+// their provisioning details.
+func getMachineConfigs(ctx context.Context, rancherURL string, accessToken string, clusters []Cluster) ([]MachineConfig, error) {
+	log.Println("Starting getMachineConfigs function")
+
+	configs, err := getNodeTemplates(ctx, rancherURL+"/v3", accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Machine configs live next to their provisioning cluster and are
+	// listed per kind.
+	users := make(map[string][]string)
+	kinds := make(map[string]bool)
+	for _, cluster := range clusters {
+		if cluster.Provisioning == nil {
+			continue
+		}
+		for _, pool := range cluster.Provisioning.MachinePools {
+			if pool.MachineConfigKind == "" {
+				continue
+			}
+			key := pool.MachineConfigKind + "/" + cluster.Provisioning.Namespace + "/" + pool.MachineConfigName
+			if !containsString(users[key], cluster.ID) {
+				users[key] = append(users[key], cluster.ID)
+			}
+			kinds[pool.MachineConfigKind] = true
+		}
+	}
+
+	for _, kind := range sortedKeys(kinds) {
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		collection := "rke-machine-config.cattle.io." + strings.ToLower(kind) + "s"
+		if err := getRancherJSON(ctx, rancherURL+"/v1/"+collection, accessToken, kind+" machine configs", &response); err != nil {
+			return nil, err
+		}
+
+		for _, item := range response.Data {
+			metadata, _ := item["metadata"].(map[string]interface{})
+			mc := newMachineConfig(kind, strings.TrimSuffix(strings.ToLower(kind), "config"), item)
+			mc.Namespace = stringField(metadata, "namespace")
+			mc.Name = stringField(metadata, "name")
+			mc.Clusters = users[kind+"/"+mc.Namespace+"/"+mc.Name]
+			configs = append(configs, mc)
+		}
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].Kind != configs[j].Kind {
+			return configs[i].Kind < configs[j].Kind
+		}
+		if configs[i].Namespace != configs[j].Namespace {
+			return configs[i].Namespace < configs[j].Namespace
+		}
+		return configs[i].Name < configs[j].Name
+	})
+
+	log.Printf("Fetched %d node templates and machine configs", len(configs))
+	return configs, nil
+}
+
+// getNodeTemplates lists the RKE1 node templates with the clusters whose
+// node pools use them.
+func getNodeTemplates(ctx context.Context, rancherAPIURL string, accessToken string) ([]MachineConfig, error) {
+	var templates struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/nodetemplates", accessToken, "node templates", &templates); err != nil {
+		return nil, err
+	}
+
+	var pools struct {
+		Data []struct {
+			ClusterID      string `json:"clusterId"`
+			NodeTemplateID string `json:"nodeTemplateId"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/nodepools", accessToken, "node pools", &pools); err != nil {
+		return nil, err
+	}
+	users := make(map[string][]string)
+	for _, pool := range pools.Data {
+		if !containsString(users[pool.NodeTemplateID], pool.ClusterID) {
+			users[pool.NodeTemplateID] = append(users[pool.NodeTemplateID], pool.ClusterID)
+		}
+	}
+
+	var configs []MachineConfig
+	for _, template := range templates.Data {
+		driver := stringField(template, "driver")
+		fields, _ := template[driver+"Config"].(map[string]interface{})
+		mc := newMachineConfig(kindNodeTemplate, driver, fields)
+		mc.Name = stringField(template, "id")
+		mc.Clusters = users[mc.Name]
+		configs = append(configs, mc)
+	}
+	return configs, nil
+}
+
+func newMachineConfig(kind, provider string, fields map[string]interface{}) MachineConfig {
+	mc := MachineConfig{
+		Kind:         kind,
+		Provider:     provider,
+		InstanceType: firstField(fields, instanceTypeFields),
+		Image:        firstField(fields, imageFields),
+		Region:       firstField(fields, regionFields),
+	}
+	// vSphere and Harvester size machines by CPU count and memory.
+	if mc.InstanceType == "" && stringField(fields, "cpuCount") != "" {
+		mc.InstanceType = fmt.Sprintf("%s CPU, %s memory", stringField(fields, "cpuCount"), stringField(fields, "memorySize"))
+	}
+	return mc
+}
+
+func firstField(fields map[string]interface{}, names []string) string {
+	for _, name := range names {
+		if value := stringField(fields, name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// stringField returns the named field of a decoded JSON object as a
+// string, or an empty string when it is unset or not a scalar.
+func stringField(fields map[string]interface{}, name string) string {
+	return scalarString(fields[name])
+}
+
+func scalarString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64, bool:
+		return fmt.Sprint(value)
+	default:
+		return ""
+	}
+}
+
+// MachineConfigsFor returns the machine configs used by the given cluster.
+func (inv *Inventory) MachineConfigsFor(clusterID string) []MachineConfig {
+	var configs []MachineConfig
+	for _, mc := range inv.MachineConfigs {
+		if containsString(mc.Clusters, clusterID) {
+			configs = append(configs, mc)
+		}
+	}
+	return configs
+}
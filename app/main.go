@@ -4,25 +4,105 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
 )
 
 type Cluster struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Type string `json:"type"`
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	State    string       `json:"state"`
+	Internal bool         `json:"internal"`
+	Version  *VersionInfo `json:"version"`
+
+	// Revision fingerprints the cluster as listed by Rancher, to detect
+	// changed clusters in differential sync.
+	Revision string `json:"-"`
+
+	// Provider, NodeCount and Capacity are as reported by Rancher and
+	// feed the summary.
+	Provider  string              `json:"provider,omitempty"`
+	NodeCount int                 `json:"nodeCount,omitempty"`
+	Capacity  corev1.ResourceList `json:"capacity,omitempty"`
+
+	// APIEndpoint is the URL of the cluster's Kubernetes API server as
+	// reported by Rancher.
+	APIEndpoint string `json:"apiEndpoint,omitempty"`
+
+	// Connected is whether the cluster agent is connected to Rancher, and
+	// LastSeen when it was last seen connected. Both are unset when Rancher
+	// does not report the agent's connectivity.
+	Connected *bool      `json:"connected,omitempty"`
+	LastSeen  *time.Time `json:"lastSeen,omitempty"`
+
+	// Created is when the cluster was created in Rancher, and AgeDays its
+	// age in whole days when the inventory was collected.
+	Created *time.Time `json:"created,omitempty"`
+	AgeDays *int       `json:"ageDays,omitempty"`
+
+	// Reachability is only probed with --probe-endpoints.
+	Reachability *Reachability `json:"reachability,omitempty"`
+
+	// KubernetesEOL is the support state of the cluster's Kubernetes minor
+	// release, unset for releases missing from the calendar.
+	KubernetesEOL *KubernetesEOL `json:"kubernetesEol,omitempty"`
+
+	// QuotaCommitment compares the project quotas of the cluster with its
+	// capacity, by resource.
+	QuotaCommitment []QuotaCommitment `json:"quotaCommitment,omitempty"`
+
+	// Fields are the annotations promoted by the field mappings, and
+	// annotations all annotations of the cluster, which are not part of
+	// the output.
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	annotations map[string]string
+
+	// Labels are the Rancher labels of the cluster, matched by the
+	// selectors of groups.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Provisioning is filled from the provisioning.cattle.io/v1 API for
+	// clusters provisioned by Rancher 2.6+.
+	Provisioning *ProvisioningInfo `json:"provisioning,omitempty"`
+
+	// EtcdBackup is only collected with the etcdbackups collector.
+	EtcdBackup *EtcdBackup `json:"etcdBackup,omitempty"`
+}
+
+// IsLocal reports whether c is the Rancher management ("local") cluster.
+func (c Cluster) IsLocal() bool {
+	return c.ID == "local" || c.Internal
+}
+
+type VersionInfo struct {
+	GitVersion string `json:"gitVersion"`
+}
+
+// KubernetesVersion returns the version reported by the cluster agent, or
+// an empty string when Rancher has not received one yet.
+func (c Cluster) KubernetesVersion() string {
+	if c.Version == nil {
+		return ""
+	}
+	return c.Version.GitVersion
 }
 
 type Project struct {
@@ -30,6 +110,31 @@ type Project struct {
 	Name        string            `json:"name"`
 	ClusterID   string            `json:"clusterId"`
 	Annotations map[string]string `json:"annotations"`
+
+	// Fields are the annotations promoted by the field mappings.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	// Created is when the project was created, and AgeDays its age in
+	// whole days when the inventory was collected.
+	Created *time.Time `json:"created,omitempty"`
+	AgeDays *int       `json:"ageDays,omitempty"`
+
+	// ResourceQuota is the project's quota in Rancher.
+	ResourceQuota *ProjectResourceQuota `json:"resourceQuota,omitempty"`
+
+	// Quota is aggregated from the project's namespaces when the
+	// namespaces collector is enabled.
+	Quota map[string]QuotaUsage `json:"quota,omitempty"`
+
+	// MemberCount and Owners are the principals bound to the project and
+	// those bound as project owners, set when the members collector is
+	// enabled.
+	MemberCount int      `json:"memberCount,omitempty"`
+	Owners      []string `json:"owners,omitempty"`
+
+	// labels are the Rancher labels of the project, which are not part of
+	// the output.
+	labels map[string]string
 }
 
 const maxRetries = 5
@@ -38,58 +143,575 @@ func exponentialBackoff(retry int) time.Duration {
 	return time.Duration(math.Pow(2, float64(retry))) * time.Second
 }
 
-func withRetry(fn func() error) error {
+// withRetry calls fn until it succeeds, backing off between attempts.
+// Rejected credentials and missing resources are not retried, and retries
+// stop once ctx is done.
+func withRetry(ctx context.Context, fn func() error) error {
+	var err error
 	for i := 0; i <= maxRetries; i++ {
-		err := fn()
+		err = fn()
 		if err == nil {
 			return nil
 		}
+		if errors.Is(err, errRancherAuth) || errors.Is(err, errRancherNotFound) || ctx.Err() != nil {
+			return err
+		}
 		log.Printf("Error encountered: %v. Retrying in %v seconds", err, exponentialBackoff(i+1).Seconds())
-		time.Sleep(exponentialBackoff(i + 1))
+		select {
+		case <-time.After(exponentialBackoff(i + 1)):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		}
+	}
+	return fmt.Errorf("after %d retries, operation failed: %w", maxRetries, err)
+}
+
+// Inventory is the result of one collection run against the Rancher API.
+type Inventory struct {
+	GeneratedAt time.Time   `json:"generatedAt"`
+	Clusters    []Cluster   `json:"clusters"`
+	Projects    []Project   `json:"projects"`
+	Namespaces  []Namespace `json:"namespaces,omitempty"`
+	Nodes       []Node      `json:"nodes,omitempty"`
+
+	MachineConfigs   []MachineConfig   `json:"machineConfigs,omitempty"`
+	CloudCredentials []CloudCredential `json:"cloudCredentials,omitempty"`
+	Notifiers        []Notifier        `json:"notifiers,omitempty"`
+	AlertGroups      []AlertGroup      `json:"alertGroups,omitempty"`
+	AuthProviders    []AuthProvider    `json:"authProviders,omitempty"`
+	Features         []Feature         `json:"features,omitempty"`
+	Drivers          []Driver          `json:"drivers,omitempty"`
+	ChartRepos       []ChartRepo       `json:"chartRepos,omitempty"`
+	Tokens           []APIToken        `json:"tokens,omitempty"`
+	Orphans          []OrphanedProject `json:"orphans,omitempty"`
+	MultiClusterApps []MultiClusterApp `json:"multiClusterApps,omitempty"`
+	GlobalDNS        []GlobalDNS       `json:"globalDNS,omitempty"`
+	Roles            []Role            `json:"roles,omitempty"`
+
+	// Resources holds the documents of the registered collectors by
+	// collector name.
+	Resources map[string][]Document `json:"resources,omitempty"`
+}
+
+// ProjectsFor returns the projects belonging to the given cluster.
+func (inv *Inventory) ProjectsFor(clusterID string) []Project {
+	var projects []Project
+	for _, project := range inv.Projects {
+		if project.ClusterID == clusterID {
+			projects = append(projects, project)
+		}
 	}
-	return fmt.Errorf("after %d retries, operation failed", maxRetries)
+	return projects
 }
 
 func main() {
-	rancherAPIURL := os.Getenv("RANCHER_SERVER_URL") + "/v3"
-	accessToken := os.Getenv("RANCHER_TOKEN_KEY")
+	command, args := "sync", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	clusters := getClusters(rancherAPIURL, accessToken)
-	configMapData := make(map[string]string)
+	cfg, err := loadConfig(args)
+	if err != nil {
+		log.Printf("Error loading configuration: %v", err)
+		os.Exit(exitConfig)
+	}
+	setRancherHeaders(cfg)
+	setHTTPDebug(cfg)
+
+	if command != "version" && command != "schema" && command != "compare" && command != "generate" && command != "login" && command != "logout" {
+		log.Printf("Starting %s", currentBuildInfo())
+	}
+	recordBuildInfo()
 
+	// sync and serve run every sync profile, the other commands work on a
+	// single inventory.
+	switch command {
+	case "sync", "serve":
+		_, err = cfg.syncConfigs()
+	case "report", "diff", "validate", "email", "import", "login", "logout", "backfill":
+		cfg, err = cfg.singleSyncConfig()
+	}
+	if err != nil {
+		log.Printf("Error loading configuration: %v", err)
+		os.Exit(exitConfig)
+	}
+	registerRancherEndpoints(cfg)
+
+	started := time.Now()
+	switch command {
+	case "version":
+		err = runVersion(cfg)
+	case "sync":
+		err = runSync(cfg)
+	case "report":
+		err = runReport(cfg)
+	case "serve":
+		err = runServe(cfg)
+	case "diff":
+		err = runDiff(cfg)
+	case "validate":
+		err = runValidate(cfg)
+	case "email":
+		err = runEmail(cfg)
+	case "schema":
+		err = runSchema(cfg)
+	case "import":
+		err = runImport(cfg)
+	case "replay":
+		err = runReplay(cfg)
+	case "compare":
+		err = runCompare(cfg)
+	case "generate":
+		err = runGenerate(cfg)
+	case "login":
+		err = runLogin(cfg)
+	case "logout":
+		err = runLogout(cfg)
+	case "backfill":
+		err = runBackfill(cfg)
+	default:
+		log.Printf("Unknown command %q (expected sync, report, serve, diff, validate, email, import, replay, compare, generate, login, logout, backfill, schema or version)", command)
+		os.Exit(exitConfig)
+	}
+	// serve runs until it is stopped, so it has no end of run to report.
+	if cfg.RunReport != "" && command != "serve" {
+		if reportErr := writeRunReport(cfg.RunReport, newRunReport(command, started, err)); reportErr != nil {
+			log.Printf("Error: %v", reportErr)
+		}
+	}
+	if errors.Is(err, errDriftDetected) || errors.Is(err, errValidationFailed) {
+		os.Exit(exitFailure)
+	}
+	if err != nil {
+		log.Printf("Error running %s: %v", command, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// runSync syncs every sync profile once, one after the other.
+func runSync(cfg *Config) error {
+	configs, err := cfg.syncConfigs()
+	if err != nil {
+		return err
+	}
+	if len(configs) == 1 {
+		return syncOnce(configs[0])
+	}
+
+	var errs []error
+	for _, pcfg := range configs {
+		log.Printf("Running sync profile %s", pcfg.syncProfile)
+		if err := syncOnce(pcfg); err != nil {
+			log.Printf("Error running sync profile %s: %v", pcfg.syncProfile, err)
+			errs = append(errs, fmt.Errorf("sync profile %s: %w", pcfg.syncProfile, err))
+		}
+	}
+	if len(errs) > 0 && len(errs) < len(configs) {
+		return fmt.Errorf("%w: %d of %d sync profiles failed: %w", errPartialSync, len(errs), len(configs), errors.Join(errs...))
+	}
+	return errors.Join(errs...)
+}
+
+func syncOnce(cfg *Config) error {
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+
+	started := time.Now()
+	inv, err := collectInventory(ctx, cfg, nil)
+	recordDuration(phaseName(cfg, "collect"), time.Since(started))
+	if err == nil {
+		publishStarted := time.Now()
+		err = publishProfiles(ctx, cfg, nil, inv)
+		recordDuration(phaseName(cfg, "publish"), time.Since(publishStarted))
+	}
+	if err == nil {
+		// The inventory is published, so a failed propagation only makes
+		// the sync partial.
+		err = propagateProjectMetadata(ctx, cfg, inv)
+	}
+	err = syncTimeoutError(ctx, cfg, err)
+	if err != nil {
+		notifyFailure(ctx, cfg, err)
+	}
+	recordSyncMetrics(cfg, inv, err, time.Since(started))
+	return err
+}
+
+// syncContext returns the context of one sync. With --sync-timeout it
+// expires once the sync's wall-clock budget is used up, which aborts the
+// pending Rancher and Kubernetes requests and stops retries.
+func syncContext(cfg *Config) (context.Context, context.CancelFunc) {
+	if cfg.SyncTimeout.Duration <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), cfg.SyncTimeout.Duration)
+}
+
+// syncTimeoutError states that the sync ran out of time when err was
+// caused by the expired sync context.
+func syncTimeoutError(ctx context.Context, cfg *Config, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("sync did not finish within the sync timeout of %s: %w", cfg.SyncTimeout.Duration, err)
+}
+
+// collectInventory collects the inventory from Rancher. With a cache, as
+// kept by the serve loop with differential sync, the clusters whose
+// revision did not change since the previous sync are not collected again.
+func collectInventory(ctx context.Context, cfg *Config, cache *clusterCache) (*Inventory, error) {
+	return collectInventoryWith(ctx, cfg, func(ctx context.Context, accessToken string, inv *Inventory) ([]clusterResult, []error) {
+		return collectClusters(ctx, cfg, accessToken, inv.Clusters, cache)
+	})
+}
+
+// collectClustersFunc collects the projects, namespaces, nodes and chart
+// repositories of the clusters of inv, returning a result and an error
+// for each cluster.
+type collectClustersFunc func(ctx context.Context, accessToken string, inv *Inventory) ([]clusterResult, []error)
+
+// collectInventoryWith collects the inventory from Rancher, with the
+// per-cluster data collected by collect.
+func collectInventoryWith(ctx context.Context, cfg *Config, collect collectClustersFunc) (*Inventory, error) {
+	checkRancherEndpoints(ctx, cfg)
+	rancherAPIURL := cfg.RancherURL + "/v3"
+	accessToken, err := getRancherToken(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errRancherAuth, err)
+	}
+	if err := checkTokenPrivileges(ctx, cfg, accessToken); err != nil {
+		return nil, err
+	}
+
+	clusters, err := getClusters(ctx, rancherAPIURL, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{GeneratedAt: time.Now().UTC()}
 	for _, cluster := range clusters {
-		if cluster.Type == "cluster" {
-			clusterData := fmt.Sprintf("Cluster ID: %s, Name: %s", cluster.ID, cluster.Name)
-			configMapData[cluster.ID] = clusterData
-
-			projects := getProjects(rancherAPIURL, accessToken, cluster.ID)
-			for _, project := range projects {
-				projectData := fmt.Sprintf("Project ID: %s, Name: %s", project.ID, project.Name)
-				for key, value := range project.Annotations {
-					projectData += fmt.Sprintf(", Annotation: %s = %s", key, value)
-				}
-				configMapData[project.ID] = projectData
+		if cluster.Type != "cluster" {
+			continue
+		}
+		if cfg.ExcludeLocal && cluster.IsLocal() {
+			log.Printf("Skipping local cluster %s", cluster.ID)
+			continue
+		}
+		if len(cfg.ClusterStates) > 0 && !containsString(cfg.ClusterStates, cluster.State) {
+			log.Printf("Skipping cluster %s in state %q", cluster.ID, cluster.State)
+			continue
+		}
+		inv.Clusters = append(inv.Clusters, cluster)
+	}
+
+	recordConnectivity(cfg, inv.Clusters)
+	setKubernetesEOL(cfg, inv.Clusters, inv.GeneratedAt)
+	if cfg.ProbeEndpoints {
+		probeClusters(ctx, cfg, inv.Clusters)
+	}
+
+	provisioning, err := getProvisioningClusters(ctx, cfg.RancherURL+"/v1", accessToken)
+	if err != nil {
+		return nil, err
+	}
+	mergeProvisioningClusters(inv.Clusters, provisioning)
+
+	if cfg.collects(collectorEtcdBackups) {
+		if err := getEtcdBackups(ctx, rancherAPIURL, accessToken, inv.Clusters, provisioning); err != nil {
+			return nil, err
+		}
+		recordEtcdBackups(cfg, inv.Clusters)
+	}
+
+	if cfg.collects(collectorMachineConfigs) {
+		inv.MachineConfigs, err = getMachineConfigs(ctx, cfg.RancherURL, accessToken, inv.Clusters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorCloudCredentials) {
+		inv.CloudCredentials, err = getCloudCredentials(ctx, cfg.RancherURL, accessToken, inv.Clusters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorAuthProviders) {
+		inv.AuthProviders, err = getAuthProviders(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorDrivers) {
+		inv.Drivers, err = getDrivers(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorRoles) {
+		inv.Roles, err = getRoles(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var members map[string]*projectMembers
+	if cfg.collects(collectorMembers) {
+		members, err = getProjectMembers(ctx, rancherAPIURL, accessToken, newPrincipalResolver(cfg, rancherAPIURL, accessToken))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorChartRepos) {
+		inv.ChartRepos, err = getCatalogs(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorTokens) {
+		inv.Tokens, err = getAPITokens(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorMultiClusterApps) {
+		inv.MultiClusterApps, inv.GlobalDNS, err = getMultiClusterApps(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Orphans are looked up among all clusters, not only the collected
+	// ones, so excluded clusters do not orphan their projects.
+	if cfg.collects(collectorOrphans) {
+		inv.Orphans, err = getOrphanedProjects(ctx, rancherAPIURL, accessToken, clusters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorFeatures) {
+		inv.Features, err = getFeatures(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.collects(collectorNotifiers) {
+		inv.Notifiers, inv.AlertGroups, err = getAlertRouting(ctx, rancherAPIURL, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inv.Resources, err = runCollectors(ctx, cfg, accessToken, inv.Clusters)
+	if err != nil {
+		return nil, err
+	}
+
+	results, clusterErrs := collect(ctx, accessToken, inv)
+	for i, result := range results {
+		if clusterErrs[i] == nil {
+			recordClusterMetrics(cfg, inv.Clusters[i], result)
+		}
+	}
+	addClusterResults(cfg, inv, results)
+	if members != nil {
+		setProjectMembers(inv.Projects, members)
+	}
+	if cfg.collects(collectorNamespaces) {
+		recordUnassignedNamespaces(cfg, inv)
+	}
+
+	return inv, errors.Join(clusterErrs...)
+}
+
+// collectClusters collects every cluster concurrently, bounded by the
+// configured limit. A failing cluster does not cancel the others. With a
+// cache, the unchanged clusters are taken from it unless a full sync is
+// due.
+func collectClusters(ctx context.Context, cfg *Config, accessToken string, clusters []Cluster, cache *clusterCache) ([]clusterResult, []error) {
+	results := make([]clusterResult, len(clusters))
+	clusterErrs := make([]error, len(clusters))
+
+	now := time.Now()
+	full := cache == nil || cache.fullSyncDue(cfg, now)
+	reused := 0
+
+	var g errgroup.Group
+	g.SetLimit(cfg.Concurrency)
+	for i, cluster := range clusters {
+		i, cluster := i, cluster
+		if !full {
+			if result, ok := cache.lookup(cluster); ok {
+				results[i] = result
+				reused++
+				continue
+			}
+		}
+		g.Go(func() error {
+			started := time.Now()
+			result, err := collectCluster(ctx, cfg, accessToken, cluster)
+			if err != nil {
+				clusterErrs[i] = fmt.Errorf("cluster %s: %w", cluster.ID, err)
 			}
+			result.duration = time.Since(started)
+			results[i] = result
+			return nil
+		})
+	}
+	g.Wait()
+
+	if cache != nil {
+		cache.update(clusters, results, clusterErrs, full, now)
+		recordDifferentialSync(cfg, len(clusters)-reused, reused)
+	}
+	return results, clusterErrs
+}
+
+// addClusterResults adds the per-cluster results to inv and derives what
+// depends on them: project quotas, ages, quota commitment and mapped
+// fields.
+func addClusterResults(cfg *Config, inv *Inventory, results []clusterResult) {
+	for _, result := range results {
+		inv.Projects = append(inv.Projects, result.projects...)
+		inv.Namespaces = append(inv.Namespaces, result.namespaces...)
+		inv.Nodes = append(inv.Nodes, result.nodes...)
+		inv.ChartRepos = append(inv.ChartRepos, result.chartRepos...)
+	}
+	sortChartRepos(inv.ChartRepos)
+	aggregateProjectQuotas(inv)
+	setAges(inv)
+	setQuotaCommitment(cfg, inv)
+	applyFieldMappings(cfg, inv)
+}
+
+// clusterResult holds everything collected for a single cluster.
+type clusterResult struct {
+	projects   []Project
+	namespaces []Namespace
+	nodes      []Node
+	chartRepos []ChartRepo
+
+	// duration is how long collecting the cluster took.
+	duration time.Duration
+}
+
+func collectCluster(ctx context.Context, cfg *Config, accessToken string, cluster Cluster) (clusterResult, error) {
+	var result clusterResult
+
+	projects, err := getProjects(ctx, cfg.RancherURL+"/v3", accessToken, cluster.ID)
+	if err != nil {
+		return result, err
+	}
+	result.projects = projects
+
+	if cfg.collects(collectorNamespaces) {
+		result.namespaces, err = getNamespaces(ctx, cfg.RancherURL, accessToken, cluster.ID)
+		if err != nil {
+			return result, err
 		}
 	}
 
-	updateConfigMap(configMapData)
+	if cfg.collects(collectorNodes) {
+		result.nodes, err = getNodes(ctx, cfg.RancherURL, accessToken, cluster.ID)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if cfg.collects(collectorChartRepos) {
+		result.chartRepos, err = getClusterRepos(ctx, cfg.RancherURL, accessToken, cluster.ID)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// flatInventory holds the entries rendered by renderConfigMapData, keyed
+// by ID, with clusters and projects kept apart so they never have to be
+// told apart by their IDs.
+type flatInventory struct {
+	clusters map[string]flatCluster
+	projects map[string]flatProject
+}
+
+type flatCluster struct {
+	name   string
+	fields map[string]interface{}
+}
+
+type flatProject struct {
+	clusterID   string
+	name        string
+	annotations map[string]string
+	fields      map[string]interface{}
 }
 
-func getKubeClient() (*kubernetes.Clientset, error) {
+// flattenInventory converts the inventory into its flat entries.
+func flattenInventory(inv *Inventory) flatInventory {
+	flat := flatInventory{
+		clusters: make(map[string]flatCluster),
+		projects: make(map[string]flatProject),
+	}
+
+	for _, cluster := range inv.Clusters {
+		flat.clusters[cluster.ID] = flatCluster{name: cluster.Name, fields: cluster.Fields}
+	}
+
+	for _, project := range inv.Projects {
+		clusterID := project.ClusterID
+		if clusterID == "" {
+			clusterID, _ = splitProjectID(project)
+		}
+		flat.projects[project.ID] = flatProject{clusterID: clusterID, name: project.Name, annotations: project.Annotations, fields: project.Fields}
+	}
+
+	return flat
+}
+
+func getKubeClient(cfg *Config) (*kubernetes.Clientset, error) {
 	log.Println("Starting getKubeClient function")
+	return newKubeClient(cfg.Kubeconfig, cfg.KubeContext)
+}
+
+// getTargetKubeClient returns a client for the cluster the output is
+// published to. Unless a separate target kubeconfig is configured, this is
+// the cluster scriba itself runs in.
+func getTargetKubeClient(cfg *Config) (*kubernetes.Clientset, error) {
+	if cfg.TargetKubeconfig == "" {
+		return getKubeClient(cfg)
+	}
+
+	log.Printf("Starting getTargetKubeClient function for kubeconfig %s", cfg.TargetKubeconfig)
+	return newKubeClient(cfg.TargetKubeconfig, cfg.TargetContext)
+}
 
-	// Create config. In-cluster
-	config, err := rest.InClusterConfig()
+func newKubeClient(kubeconfig, context string) (*kubernetes.Clientset, error) {
+	// Load the kubeconfig from the given path, $KUBECONFIG or ~/.kube/config,
+	// falling back to the in-cluster config when none of them exist.
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
 	if err != nil {
-		log.Fatalf("Error creating in-cluster config: %v", err)
+		log.Printf("Error creating Kubernetes client config: %v", err)
 		return nil, err
 	}
 
 	// Create a Clientset using the config
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Fatalf("Error creating Kubernetes clientset: %v", err)
+		log.Printf("Error creating Kubernetes clientset: %v", err)
 		return nil, err
 	}
 
@@ -97,89 +719,353 @@ func getKubeClient() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
-func updateConfigMap(data map[string]string) error {
+// managedKeys lists the ConfigMap keys written by scriba. Other keys in the
+// target ConfigMap belong to other tooling and are preserved on update,
+// unless exclusive mode is enabled.
+var managedKeys = []string{"clusters", "projects", "inventory", "summary", "features", "orphans", "unassignedNamespaces", "resources", "events"}
+
+func isManagedKey(key string) bool {
+	return containsString(managedKeys, key)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// renderInventory renders the managed ConfigMap keys for inv in the
+// configured layout, together with the summary, the feature flags, the
+// orphaned projects, the namespaces not assigned to any project and the
+// documents of the registered collectors.
+func renderInventory(cfg *Config, inv *Inventory) (map[string]string, error) {
+	var rendered map[string]string
+	var err error
+	switch {
+	case cfg.CompatibilityMode:
+		rendered, err = renderCompatible(cfg, inv)
+	case cfg.Layout == layoutNested:
+		rendered, err = renderNested(cfg, inv)
+	default:
+		rendered, err = renderConfigMapData(flattenInventory(inv), entryKeys(cfg, inv))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rendered["summary"], err = renderSummary(inv); err != nil {
+		return nil, err
+	}
+	if inv.Features != nil {
+		if rendered["features"], err = renderFeatures(inv.Features); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.collects(collectorOrphans) {
+		if rendered["orphans"], err = renderOrphans(inv.Orphans); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.collects(collectorNamespaces) {
+		if rendered["unassignedNamespaces"], err = renderUnassignedNamespaces(inv.Namespaces); err != nil {
+			return nil, err
+		}
+	}
+	if inv.Resources != nil {
+		if rendered["resources"], err = renderResources(inv.Resources); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// renderConfigMapData formats the flattened inventory. Each entry is
+// written under its key from keys, which defaults to the Rancher ID.
+func renderConfigMapData(flat flatInventory, keys map[string]string) (map[string]string, error) {
+	var clustersBuilder, projectsBuilder strings.Builder
+
+	keyFor := func(id string) string {
+		if key, ok := keys[id]; ok {
+			return key
+		}
+		return id
+	}
+	// Iterate over the entries in key order so unchanged inventories
+	// render byte-for-byte identical output.
+	inKeyOrder := func(ids []string) []string {
+		sort.SliceStable(ids, func(i, j int) bool { return keyFor(ids[i]) < keyFor(ids[j]) })
+		return ids
+	}
+
+	for _, id := range inKeyOrder(sortedKeys(flat.clusters)) {
+		fmt.Fprintf(&clustersBuilder, "%s:\n", yamlKey(keyFor(id)))
+		fmt.Fprintf(&clustersBuilder, "  Cluster ID: %s\n", id)
+		fmt.Fprintf(&clustersBuilder, "  Name: %s\n", strconv.Quote(flat.clusters[id].name))
+		if err := writeNestedMap(&clustersBuilder, "Fields", flat.clusters[id].fields); err != nil {
+			return nil, fmt.Errorf("rendering fields of cluster %s: %w", id, err)
+		}
+	}
+
+	for _, id := range inKeyOrder(sortedKeys(flat.projects)) {
+		project := flat.projects[id]
+		fmt.Fprintf(&projectsBuilder, "%s:\n", yamlKey(keyFor(id)))
+		fmt.Fprintf(&projectsBuilder, "  Project ID: %s\n", id)
+		fmt.Fprintf(&projectsBuilder, "  Cluster ID: %s\n", project.clusterID)
+		fmt.Fprintf(&projectsBuilder, "  Name: %s\n", strconv.Quote(project.name))
+
+		// Annotations are rendered as a nested map, so values containing
+		// commas, quotes or newlines survive intact.
+		if err := writeNestedMap(&projectsBuilder, "Annotations", project.annotations); err != nil {
+			return nil, fmt.Errorf("rendering annotations of project %s: %w", id, err)
+		}
+		if err := writeNestedMap(&projectsBuilder, "Fields", project.fields); err != nil {
+			return nil, fmt.Errorf("rendering fields of project %s: %w", id, err)
+		}
+	}
+
+	return map[string]string{
+		"clusters": clustersBuilder.String(),
+		"projects": projectsBuilder.String(),
+	}, nil
+}
+
+// writeNestedMap writes m as a YAML map under name, indented to be part of
+// an entry. Empty maps are left out.
+func writeNestedMap[V any](b *strings.Builder, name string, m map[string]V) error {
+	if len(m) == 0 {
+		return nil
+	}
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	b.WriteString("  " + name + ":\n")
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(string(out), "\n"), "\n") {
+		b.WriteString("    " + line)
+	}
+	b.WriteString("\n")
+	return nil
+}
+
+// applyManagedKeys writes rendered into cm, with every key prefixed in
+// shared mode. Owned keys missing from rendered are removed; other keys are
+// only removed in exclusive mode.
+func applyManagedKeys(cm *corev1.ConfigMap, rendered map[string]string, exclusive bool, prefix string) {
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+
+	for key := range cm.Data {
+		if _, ok := rendered[strings.TrimPrefix(key, prefix)]; ok && strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if isOwnedKey(key, prefix) || exclusive {
+			log.Printf("Removing key '%s' from ConfigMap '%s/%s'", key, cm.Namespace, cm.Name)
+			delete(cm.Data, key)
+		}
+	}
+
+	for key, value := range rendered {
+		cm.Data[prefix+key] = value
+	}
+}
+
+// maxConfigMapSize is the most data, keys included, Kubernetes accepts in
+// a ConfigMap.
+const maxConfigMapSize = 1 << 20
+
+func configMapSize(cm *corev1.ConfigMap) int {
+	size := 0
+	for key, value := range cm.Data {
+		size += len(key) + len(value)
+	}
+	for key, value := range cm.BinaryData {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// getConfigMap returns the current output ConfigMap, or nil when it
+// does not exist yet.
+func getConfigMap(cfg *Config) (*corev1.ConfigMap, error) {
+	clientset, err := getTargetKubeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(cfg.Namespace).Get(context.TODO(), cfg.ConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+func updateConfigMap(ctx context.Context, cfg *Config, rendered map[string]string, shed []string) error {
 	log.Println("Starting updateConfigMap function")
 
-	clientset, err := getKubeClient()
+	clientset, err := getTargetKubeClient(cfg)
 	if err != nil {
 		return err
 	}
 
-	cmClient := clientset.CoreV1().ConfigMaps("kube-system")
+	cmClient := clientset.CoreV1().ConfigMaps(cfg.Namespace)
 
-	cm, err := cmClient.Get(context.TODO(), "rancher-data", metav1.GetOptions{})
+	cm, err := cmClient.Get(ctx, cfg.ConfigMapName, metav1.GetOptions{})
 	if err != nil {
-		log.Println("ConfigMap 'rancher-data' not found, attempting to create")
+		log.Printf("ConfigMap '%s/%s' not found, attempting to create", cfg.Namespace, cfg.ConfigMapName)
 
 		// If it doesn't exist, create it
 		cm = &corev1.ConfigMap{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: "rancher-data",
+				Name:   cfg.ConfigMapName,
+				Labels: map[string]string{labelManagedBy: managedByScriba},
 			},
 			Data: make(map[string]string),
 		}
-		_, err = cmClient.Create(context.TODO(), cm, metav1.CreateOptions{})
+		for key, value := range cfg.outputLabels {
+			cm.Labels[key] = value
+		}
+		cm, err = cmClient.Create(ctx, cm, metav1.CreateOptions{})
 		if err != nil {
 			return err
 		}
-		log.Println("Successfully created ConfigMap 'rancher-data'")
+		log.Printf("Successfully created ConfigMap '%s/%s'", cfg.Namespace, cfg.ConfigMapName)
 	} else {
-		log.Println("ConfigMap 'rancher-data' found, updating")
-	}
-
-	var clustersBuilder, projectsBuilder strings.Builder
-
-	// Iterate over the data and format accordingly
-	for id, name := range data {
-		parts := strings.Split(name, ",")
-
-		// If the ID contains "p-", it's a project
-		if strings.Contains(id, "p-") {
-			projectsBuilder.WriteString(fmt.Sprintf("%s:\n", id))
-			projectsBuilder.WriteString(fmt.Sprintf("  Project ID: %s\n", id))
-			projectsBuilder.WriteString(fmt.Sprintf("  Name: \"Project ID: %s\"\n", id))
-
-			// If there are more parts, treat them as annotations
-			if len(parts) > 1 {
-				for i, part := range parts[1:] {
-					// Escape double quotes
-					escapedPart := strings.ReplaceAll(strings.TrimSpace(part), "\"", "\\\"")
-					projectsBuilder.WriteString(fmt.Sprintf("  Annotation%d: \"%s\"\n", i+1, escapedPart))
-				}
+		log.Printf("ConfigMap '%s/%s' found, updating", cfg.Namespace, cfg.ConfigMapName)
+		// In shared mode other tools own the ConfigMap.
+		if cfg.KeyPrefix == "" {
+			if err := claimConfigMap(cm, cfg.Adopt); err != nil {
+				return err
+			}
+			for key, value := range cfg.outputLabels {
+				cm.Labels[key] = value
 			}
-		} else {
-			clustersBuilder.WriteString(fmt.Sprintf("%s:\n", id))
-			clustersBuilder.WriteString(fmt.Sprintf("  Cluster ID: %s\n", id))
-			clustersBuilder.WriteString(fmt.Sprintf("  Name: 'Cluster ID: %s, Name: Cluster ID: %s'\n", id, id))
 		}
 	}
 
-	cm.Data["clusters"] = clustersBuilder.String()
-	cm.Data["projects"] = projectsBuilder.String()
+	applyManagedKeys(cm, rendered, cfg.Exclusive, cfg.KeyPrefix)
+	if len(shed) > 0 {
+		if cm.Annotations == nil {
+			cm.Annotations = make(map[string]string)
+		}
+		cm.Annotations[shedAnnotation] = strings.Join(shed, ",")
+	} else {
+		delete(cm.Annotations, shedAnnotation)
+	}
+	if size := configMapSize(cm); size > maxConfigMapSize {
+		return fmt.Errorf("%w: ConfigMap '%s/%s' would hold %d bytes, Kubernetes allows %d; select less with output profiles or collectors, or set output budgets", errConfigMapTooLarge, cfg.Namespace, cfg.ConfigMapName, size, maxConfigMapSize)
+	}
 
-	_, err = cmClient.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	_, err = cmClient.Update(ctx, cm, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
-	log.Println("Successfully updated ConfigMap 'rancher-data'")
+	log.Printf("Successfully updated ConfigMap '%s/%s'", cfg.Namespace, cfg.ConfigMapName)
 
 	return nil
 }
 
-func getHttpClient() *http.Client {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// errRancherNotFound is returned by getRancherJSON when Rancher does not
+// serve the requested resource, e.g. an API removed in later versions.
+var errRancherNotFound = errors.New("not found")
+
+// getRancherJSON fetches url with the Rancher token and decodes the JSON
+// response into out, retrying on failure. what names the resource in log
+// and error messages.
+func getRancherJSON(ctx context.Context, url string, accessToken string, what string, out interface{}) error {
+	err := withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			log.Printf("Error creating new request to Rancher API for %s: %v", what, err)
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		resp, err := getHttpClient().Do(req)
+		if err != nil {
+			log.Printf("Error sending request to Rancher API for %s: %v", what, err)
+			return rancherRequestError(ctx, err)
+		}
+		defer resp.Body.Close()
+
+		if isRancherAuthStatus(resp.StatusCode) {
+			return rancherAuthError(what, resp.StatusCode)
+		}
+		if isRancherUnavailableStatus(resp.StatusCode) {
+			return rancherUnavailableError(what, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("Rancher API for %s: %w", what, errRancherNotFound)
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("unexpected status code from Rancher API for %s: %d\n", what, resp.StatusCode)
+			return fmt.Errorf("unexpected status code from Rancher API for %s: %d", what, resp.StatusCode)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			log.Printf("Error decoding response body for %s: %v", what, err)
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Failed to fetch %s after retries: %v", what, err)
+		return err
 	}
-	return &http.Client{Transport: tr}
+	return nil
+}
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// getHttpClient returns the HTTP client shared by all Rancher requests.
+// It is built once so keep-alive connections and TLS sessions are reused
+// across calls instead of being renegotiated for every request. It has no
+// overall timeout; requests are bounded by their context, as by
+// --sync-timeout.
+func getHttpClient() *http.Client {
+	httpClientOnce.Do(func() {
+		tr := &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 20,
+			IdleConnTimeout:     90 * time.Second,
+			// Bound the wait for Rancher to answer, not the download of
+			// the body, as large lists take long to read on big estates.
+			ResponseHeaderTimeout: 60 * time.Second,
+		}
+		httpClient = &http.Client{Transport: &headerTransport{base: tr}}
+	})
+	return httpClient
 }
 
-func getClusters(rancherAPIURL string, accessToken string) []Cluster {
+func getClusters(ctx context.Context, rancherAPIURL string, accessToken string) ([]Cluster, error) {
 	log.Println("Starting getClusters function")
 	var clusters []Cluster
 
-	err := withRetry(func() error {
+	err := withRetry(ctx, func() error {
 		client := getHttpClient()
-		req, err := http.NewRequest("GET", rancherAPIURL+"/clusters", nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", rancherAPIURL+"/clusters", nil)
 		if err != nil {
 			log.Printf("Error creating new request to Rancher API: %v", err)
 			return err
@@ -189,51 +1075,64 @@ func getClusters(rancherAPIURL string, accessToken string) []Cluster {
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Printf("Error sending request to Rancher API: %v", err)
-			return err
+			return rancherRequestError(ctx, err)
 		}
 		defer resp.Body.Close()
 
+		if isRancherAuthStatus(resp.StatusCode) {
+			return rancherAuthError("clusters", resp.StatusCode)
+		}
+		if isRancherUnavailableStatus(resp.StatusCode) {
+			return rancherUnavailableError("clusters", resp.StatusCode)
+		}
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("Unexpected status code from Rancher API: %d\n", resp.StatusCode)
 			return fmt.Errorf("Unexpected status code from Rancher API: %d", resp.StatusCode)
 		}
 
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("Error reading response body from Rancher API: %v", err)
-			return err
-		}
-
 		var response struct {
-			Data []Cluster `json:"data"`
+			Data []struct {
+				Cluster
+				Conditions  []clusterCondition `json:"conditions"`
+				Annotations map[string]string  `json:"annotations"`
+			} `json:"data"`
 		}
-		err = json.Unmarshal(body, &response)
+		// Decode straight from the response stream so large lists are not
+		// buffered in memory before being unmarshaled.
+		err = json.NewDecoder(resp.Body).Decode(&response)
 		if err != nil {
-			log.Printf("Error unmarshaling response body: %v", err)
+			log.Printf("Error decoding response body: %v", err)
 			return err
 		}
 
-		clusters = response.Data
+		now := time.Now().UTC()
+		clusters = make([]Cluster, 0, len(response.Data))
+		for _, item := range response.Data {
+			item.Cluster.Revision = clusterRevision(item.Cluster)
+			item.Cluster.setConnectivity(item.Conditions, now)
+			item.Cluster.annotations = item.Annotations
+			clusters = append(clusters, item.Cluster)
+		}
 
-		log.Printf("Fetched %d clusters from Rancher API", len(response.Data))
+		log.Printf("Fetched %d clusters from Rancher API (gzip: %t)", len(response.Data), resp.Uncompressed)
 		return nil // No error, so returning nil
 	})
 
 	if err != nil {
-		log.Fatalf("Failed to fetch clusters after retries: %v", err)
-		return nil
+		log.Printf("Failed to fetch clusters after retries: %v", err)
+		return nil, err
 	}
 
-	return clusters
+	return clusters, nil
 }
 
-func getProjects(rancherAPIURL string, accessToken string, clusterID string) []Project {
+func getProjects(ctx context.Context, rancherAPIURL string, accessToken string, clusterID string) ([]Project, error) {
 	log.Printf("Starting getProjects function for cluster ID: %s", clusterID)
 	var projects []Project
 
-	err := withRetry(func() error {
+	err := withRetry(ctx, func() error {
 		client := getHttpClient()
-		req, err := http.NewRequest("GET", rancherAPIURL+"/projects?clusterId="+clusterID, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", rancherAPIURL+"/projects?clusterId="+clusterID, nil)
 		if err != nil {
 			log.Printf("Error creating new request to Rancher API for projects: %v", err)
 			return err
@@ -243,40 +1142,47 @@ func getProjects(rancherAPIURL string, accessToken string, clusterID string) []P
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Printf("Error sending request to Rancher API for projects: %v", err)
-			return err
+			return rancherRequestError(ctx, err)
 		}
 		defer resp.Body.Close()
 
+		if isRancherAuthStatus(resp.StatusCode) {
+			return rancherAuthError("projects", resp.StatusCode)
+		}
+		if isRancherUnavailableStatus(resp.StatusCode) {
+			return rancherUnavailableError("projects", resp.StatusCode)
+		}
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("unexpected status code from Rancher API for projects: %d\n", resp.StatusCode)
 			return fmt.Errorf("unexpected status code from Rancher API for projects: %d", resp.StatusCode)
 		}
 
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("Error reading response body from Rancher API for projects: %v", err)
-			return err
-		}
-
 		var response struct {
-			Data []Project `json:"data"`
+			Data []struct {
+				Project
+				Labels map[string]string `json:"labels"`
+			} `json:"data"`
 		}
-		err = json.Unmarshal(body, &response)
+		err = json.NewDecoder(resp.Body).Decode(&response)
 		if err != nil {
-			log.Printf("Error unmarshaling response body for projects: %v", err)
+			log.Printf("Error decoding response body for projects: %v", err)
 			return err
 		}
 
-		projects = response.Data
+		projects = make([]Project, 0, len(response.Data))
+		for _, item := range response.Data {
+			item.Project.labels = item.Labels
+			projects = append(projects, item.Project)
+		}
 
-		log.Printf("Fetched %d projects for cluster ID %s from Rancher API", len(response.Data), clusterID)
+		log.Printf("Fetched %d projects for cluster ID %s from Rancher API (gzip: %t)", len(response.Data), clusterID, resp.Uncompressed)
 		return nil // No error, so returning nil
 	})
 
 	if err != nil {
-		log.Fatalf("Failed to fetch projects after retries: %v", err)
-		return nil
+		log.Printf("Failed to fetch projects after retries: %v", err)
+		return nil, err
 	}
 
-	return projects
+	return projects, nil
 }
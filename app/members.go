@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// roleProjectOwner is the role template of project owners.
+const roleProjectOwner = "project-owner"
+
+// projectMembers are the principals bound to a project.
+type projectMembers struct {
+	principals map[string]bool
+	owners     map[string]bool
+}
+
+// getProjectMembers lists the project role template bindings and returns
+// the members of every project by project ID. Principals are named by
+// resolver if set, otherwise after the Rancher user holding them;
+// principals of groups and of users that never logged in keep their ID.
+func getProjectMembers(ctx context.Context, rancherAPIURL string, accessToken string, resolver *principalResolver) (map[string]*projectMembers, error) {
+	log.Println("Starting getProjectMembers function")
+
+	var bindings struct {
+		Data []struct {
+			ProjectID        string `json:"projectId"`
+			RoleTemplateID   string `json:"roleTemplateId"`
+			UserID           string `json:"userId"`
+			UserPrincipalID  string `json:"userPrincipalId"`
+			GroupPrincipalID string `json:"groupPrincipalId"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/projectroletemplatebindings", accessToken, "project role template bindings", &bindings); err != nil {
+		return nil, err
+	}
+
+	var users struct {
+		Data []struct {
+			ID           string   `json:"id"`
+			Name         string   `json:"name"`
+			Username     string   `json:"username"`
+			PrincipalIDs []string `json:"principalIds"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/users", accessToken, "users", &users); err != nil {
+		return nil, err
+	}
+	userNames := make(map[string]string)
+	for _, user := range users.Data {
+		name := user.Name
+		if name == "" {
+			name = user.Username
+		}
+		if name == "" {
+			continue
+		}
+		userNames[user.ID] = name
+		for _, id := range user.PrincipalIDs {
+			userNames[id] = name
+		}
+	}
+
+	members := make(map[string]*projectMembers)
+	for _, binding := range bindings.Data {
+		principal := binding.UserPrincipalID
+		if principal == "" {
+			principal = binding.GroupPrincipalID
+		}
+		if principal == "" {
+			principal = binding.UserID
+		}
+		if principal == "" {
+			continue
+		}
+		name := resolver.name(ctx, principal)
+		if name == principal {
+			if user, ok := userNames[principal]; ok {
+				name = user
+			} else if user, ok := userNames[binding.UserID]; ok && binding.GroupPrincipalID == "" {
+				name = user
+			}
+		}
+
+		m, ok := members[binding.ProjectID]
+		if !ok {
+			m = &projectMembers{principals: make(map[string]bool), owners: make(map[string]bool)}
+			members[binding.ProjectID] = m
+		}
+		m.principals[principal] = true
+		if binding.RoleTemplateID == roleProjectOwner {
+			m.owners[name] = true
+		}
+	}
+
+	log.Printf("Fetched %d project role template bindings of %d projects", len(bindings.Data), len(members))
+	return members, nil
+}
+
+// setProjectMembers sets the member count and owners of the projects.
+func setProjectMembers(projects []Project, members map[string]*projectMembers) {
+	for i := range projects {
+		m, ok := members[projects[i].ID]
+		if !ok {
+			continue
+		}
+		projects[i].MemberCount = len(m.principals)
+		projects[i].Owners = sortedKeys(m.owners)
+	}
+}
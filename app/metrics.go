@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsRegistry is a minimal Prometheus registry: enough to expose
+// gauges and counters in the text exposition format without pulling in
+// the client library.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	help    string
+	typ     string
+	samples map[string]float64 // keyed by the rendered label set
+}
+
+var metrics = &metricsRegistry{families: make(map[string]*metricFamily)}
+
+func (r *metricsRegistry) family(name, help, typ string) *metricFamily {
+	f, ok := r.families[name]
+	if !ok {
+		f = &metricFamily{help: help, typ: typ, samples: make(map[string]float64)}
+		r.families[name] = f
+	}
+	return f
+}
+
+// setGauge sets the gauge name to value. labels are given as alternating
+// label names and values.
+func (r *metricsRegistry) setGauge(name, help string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "gauge").samples[formatLabels(labels)] = value
+}
+
+// addCounter increments the counter name by delta.
+func (r *metricsRegistry) addCounter(name, help string, delta float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "counter").samples[formatLabels(labels)] += delta
+}
+
+func (r *metricsRegistry) writeTo(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.typ)
+
+		labelSets := make([]string, 0, len(f.samples))
+		for labels := range f.samples {
+			labelSets = append(labelSets, labels)
+		}
+		sort.Strings(labelSets)
+		for _, labels := range labelSets {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(f.samples[labels], 'g', -1, 64))
+		}
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], labelValueReplacer.Replace(labels[i+1]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.writeTo(w)
+}
+
+// recordClusterMetrics records how long collecting a cluster took, its
+// project count and the size of its data in the JSON inventory, to find
+// the clusters that slow down syncs or bloat the output. Clusters reused
+// by differential sync keep the duration of their last collection.
+func recordClusterMetrics(cfg *Config, cluster Cluster, result clusterResult) {
+	payload, err := json.Marshal(struct {
+		Cluster    Cluster
+		Projects   []Project
+		Namespaces []Namespace
+		Nodes      []Node
+		ChartRepos []ChartRepo
+	}{cluster, result.projects, result.namespaces, result.nodes, result.chartRepos})
+	if err != nil {
+		log.Printf("Error measuring the inventory size of cluster %s: %v", cluster.ID, err)
+	}
+
+	labels := cfg.metricLabels("cluster", cluster.ID)
+	metrics.setGauge("scriba_cluster_collection_duration_seconds", "Duration of the last collection of the cluster's projects, namespaces, nodes and chart repositories.", result.duration.Seconds(), labels...)
+	metrics.setGauge("scriba_cluster_projects", "Number of projects of the cluster in the last collected inventory.", float64(len(result.projects)), labels...)
+	metrics.setGauge("scriba_cluster_payload_bytes", "Size of the cluster and its projects, namespaces, nodes and chart repositories in the JSON inventory.", float64(len(payload)), labels...)
+}
+
+func recordBuildInfo() {
+	info := currentBuildInfo()
+	metrics.setGauge("scriba_build_info", "Build information of the running rancher-scriba binary.", 1,
+		"version", info.Version, "commit", info.Commit, "date", info.Date, "goversion", info.GoVersion)
+}
+
+// recordSyncMetrics records the outcome and duration of a sync and the
+// inventory counts, when the inventory was collected, and pushes them to
+// StatsD when configured.
+func recordSyncMetrics(cfg *Config, inv *Inventory, syncErr error, duration time.Duration) {
+	result := "success"
+	if syncErr != nil {
+		result = "failure"
+	}
+	metrics.addCounter("scriba_syncs_total", "Syncs by result.", 1, cfg.metricLabels("result", result)...)
+	metrics.setGauge("scriba_last_sync_duration_seconds", "Duration of the last sync.", duration.Seconds(), cfg.metricLabels()...)
+	if syncErr == nil {
+		metrics.setGauge("scriba_last_success_timestamp_seconds", "When the last successful sync finished, as a Unix timestamp.", float64(time.Now().Unix()), cfg.metricLabels()...)
+	}
+
+	statsd := []statsdMetric{
+		{name: "syncs." + result, value: 1, typ: "c"},
+		{name: "sync.duration", value: float64(duration.Milliseconds()), typ: "ms"},
+	}
+	if inv != nil {
+		counts := map[string]int{"clusters": len(inv.Clusters), "projects": len(inv.Projects)}
+		if inv.Nodes != nil {
+			counts["nodes"] = len(inv.Nodes)
+		}
+		for _, name := range sortedKeys(counts) {
+			metrics.setGauge("scriba_"+name, "Number of "+name+" in the last collected inventory.", float64(counts[name]), cfg.metricLabels()...)
+			statsd = append(statsd, statsdMetric{name: name, value: float64(counts[name]), typ: "g"})
+		}
+	}
+
+	if cfg.StatsD.enabled() {
+		sendStatsD(&cfg.StatsD, statsd)
+	}
+}
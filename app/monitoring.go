@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// The generate command writes monitoring for the metrics served at
+// /metrics in serve mode, tailored to the configuration: the staleness
+// alert follows the sync interval, alerts and panels of optional
+// collectors are only included when they are enabled, and everything is
+// split by sync profile when there are several.
+
+// monitoringName names the generated PrometheusRule and dashboard
+// ConfigMap.
+const monitoringName = "rancher-scriba"
+
+// monitoringSettings are the parts of the configuration the generated
+// monitoring depends on.
+type monitoringSettings struct {
+	namespace string
+	// stale is how long without a successful sync is alerted on: three
+	// intervals of the slowest sync profile, so a single failed sync does
+	// not page.
+	stale      time.Duration
+	profiles   bool
+	collectors map[string]bool
+	// probes is whether any sync profile probes the cluster endpoints.
+	probes bool
+}
+
+func newMonitoringSettings(cfg *Config) (*monitoringSettings, error) {
+	configs, err := cfg.syncConfigs()
+	if err != nil {
+		return nil, err
+	}
+	s := &monitoringSettings{namespace: ownNamespace(cfg), profiles: len(configs) > 1, collectors: make(map[string]bool)}
+	for _, pcfg := range configs {
+		if stale := 3 * pcfg.Interval.Duration; stale > s.stale {
+			s.stale = stale
+		}
+		s.probes = s.probes || pcfg.ProbeEndpoints
+		for _, name := range knownCollectors {
+			if pcfg.collects(name) {
+				s.collectors[name] = true
+			}
+		}
+	}
+	if s.stale < 15*time.Minute {
+		s.stale = 15 * time.Minute
+	}
+	return s, nil
+}
+
+// promDuration formats d as a Prometheus duration, e.g. 15m or 1h30m.
+func promDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	var b strings.Builder
+	if h := int(d.Hours()); h > 0 {
+		fmt.Fprintf(&b, "%dh", h)
+	}
+	if m := int(d.Minutes()) % 60; m > 0 || b.Len() == 0 {
+		fmt.Fprintf(&b, "%dm", m)
+	}
+	return b.String()
+}
+
+type prometheusRule struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Spec       struct {
+		Groups []ruleGroup `json:"groups"`
+	} `json:"spec"`
+}
+
+type ruleGroup struct {
+	Name  string      `json:"name"`
+	Rules []alertRule `json:"rules"`
+}
+
+type alertRule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func newAlertRule(name, expr, duration, severity, summary, description string) alertRule {
+	return alertRule{
+		Alert:       name,
+		Expr:        expr,
+		For:         duration,
+		Labels:      map[string]string{"severity": severity},
+		Annotations: map[string]string{"summary": summary, "description": description},
+	}
+}
+
+// alertRules returns the alerting rules for the configuration.
+func (s *monitoringSettings) alertRules() []alertRule {
+	stale := promDuration(s.stale)
+	rules := []alertRule{
+		newAlertRule("ScribaSyncStale",
+			fmt.Sprintf("time() - scriba_last_success_timestamp_seconds > %d", int(s.stale.Seconds())),
+			"5m", "warning",
+			"rancher-scriba has not synced successfully for "+stale,
+			"The Rancher inventory published by rancher-scriba is older than "+stale+"; the ConfigMaps and sinks are stale."),
+		newAlertRule("ScribaSyncFailing",
+			fmt.Sprintf(`sum without (result) (increase(scriba_syncs_total{result="failure"}[%s])) > 0 unless sum without (result) (increase(scriba_syncs_total{result="success"}[%s])) > 0`, stale, stale),
+			"", "warning",
+			"rancher-scriba syncs are failing",
+			"Every rancher-scriba sync in the last "+stale+" failed; check its logs for the Rancher or Kubernetes error."),
+		newAlertRule("ScribaInvalidOutput",
+			"increase(scriba_invalid_output_total[1h]) > 0",
+			"", "warning",
+			"rancher-scriba rendered output that does not match its schema",
+			"The {{ $labels.key }} output did not match its schema and was not published."),
+		newAlertRule("ScribaInventoryEmpty",
+			"scriba_clusters == 0",
+			"15m", "warning",
+			"rancher-scriba found no clusters",
+			"The last inventory has no clusters; the Rancher token may have lost access to them."),
+		newAlertRule("ScribaClusterCountDropped",
+			"scriba_clusters < 0.9 * (scriba_clusters offset 1h)",
+			"15m", "info",
+			"The number of Rancher clusters dropped by more than 10% within an hour",
+			"The inventory has {{ $value }} clusters, more than 10% fewer than an hour ago."),
+		newAlertRule("RancherClusterDisconnected",
+			"rancher_cluster_connected == 0",
+			"15m", "warning",
+			"The agent of cluster {{ $labels.cluster }} is not connected to Rancher",
+			"Rancher cannot reach cluster {{ $labels.cluster }}; its inventory data is stale."),
+		newAlertRule("RancherClusterKubernetesEOL",
+			"rancher_cluster_kubernetes_eol == 1",
+			"", "warning",
+			"Cluster {{ $labels.cluster }} runs a Kubernetes release past its end of life",
+			"The Kubernetes minor release of cluster {{ $labels.cluster }} no longer receives security fixes; upgrade it."),
+		newAlertRule("ScribaRancherTokenAdmin",
+			"scriba_rancher_token_admin == 1",
+			"", "info",
+			"rancher-scriba uses an admin Rancher token",
+			"rancher-scriba only needs read access; use the token of a user with read-only access to the clusters and projects."),
+	}
+	if s.collectors[collectorEtcdBackups] {
+		rules = append(rules, newAlertRule("RancherClusterNoOffsiteEtcdBackup",
+			"scriba_cluster_etcd_offsite_backup == 0",
+			"1h", "warning",
+			"Cluster {{ $labels.cluster }} does not upload etcd snapshots to S3",
+			"The etcd snapshots of cluster {{ $labels.cluster }} are only kept on its nodes."))
+	}
+	if s.collectors[collectorNamespaces] {
+		rules = append(rules, newAlertRule("RancherClusterUnassignedNamespaces",
+			"rancher_cluster_unassigned_namespaces > 0",
+			"1h", "info",
+			"Cluster {{ $labels.cluster }} has namespaces not assigned to any project",
+			"{{ $value }} namespaces of cluster {{ $labels.cluster }} escape project quotas and RBAC."))
+	}
+	if s.probes {
+		rules = append(rules, newAlertRule("RancherClusterUnreachable",
+			"rancher_cluster_reachable == 0",
+			"15m", "warning",
+			"The API endpoint of cluster {{ $labels.cluster }} is unreachable",
+			"rancher-scriba cannot complete a TLS handshake with the API server of cluster {{ $labels.cluster }}."))
+	}
+	return rules
+}
+
+func (s *monitoringSettings) prometheusRule() *prometheusRule {
+	rule := &prometheusRule{
+		APIVersion: "monitoring.coreos.com/v1",
+		Kind:       "PrometheusRule",
+		Metadata: map[string]interface{}{
+			"name":      monitoringName,
+			"namespace": s.namespace,
+			"labels":    map[string]string{labelManagedBy: managedByScriba},
+		},
+	}
+	rule.Spec.Groups = []ruleGroup{{Name: "rancher-scriba", Rules: s.alertRules()}}
+	return rule
+}
+
+// dashboard returns the Grafana dashboard model.
+func (s *monitoringSettings) dashboard() map[string]interface{} {
+	// With several sync profiles, every query is restricted to the
+	// profiles selected in the profile variable.
+	withSelector := func(metric string) string {
+		if !s.profiles {
+			return metric
+		}
+		return metric + `{profile=~"$profile"}`
+	}
+
+	// Panels are laid out left to right in rows of the 24 columns of the
+	// Grafana grid.
+	const panelHeight = 6
+	var panels []map[string]interface{}
+	var x, y int
+	add := func(title, kind, unit string, width int, targets ...string) {
+		if x+width > 24 {
+			x, y = 0, y+panelHeight
+		}
+		var promTargets []map[string]interface{}
+		for i, expr := range targets {
+			target := map[string]interface{}{"expr": expr, "refId": string(rune('A' + i))}
+			if s.profiles {
+				target["legendFormat"] = "{{profile}}"
+			}
+			promTargets = append(promTargets, target)
+		}
+		panels = append(panels, map[string]interface{}{
+			"id":          len(panels) + 1,
+			"title":       title,
+			"type":        kind,
+			"datasource":  map[string]string{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":     map[string]int{"x": x, "y": y, "w": width, "h": panelHeight},
+			"targets":     promTargets,
+			"fieldConfig": map[string]interface{}{"defaults": map[string]string{"unit": unit}, "overrides": []interface{}{}},
+		})
+		x += width
+	}
+
+	add("Time since last successful sync", "stat", "s", 6, "time() - "+withSelector("scriba_last_success_timestamp_seconds"))
+	add("Clusters", "stat", "short", 6, withSelector("scriba_clusters"))
+	add("Projects", "stat", "short", 6, withSelector("scriba_projects"))
+	add("Disconnected clusters", "stat", "short", 6, "count("+withSelector("rancher_cluster_connected")+" == 0) or vector(0)")
+	add("Syncs", "timeseries", "short", 12,
+		`sum by (result) (increase(`+withSelector("scriba_syncs_total")+`[$__rate_interval]))`)
+	add("Sync duration", "timeseries", "s", 12, withSelector("scriba_last_sync_duration_seconds"))
+	inventory := []string{withSelector("scriba_clusters"), withSelector("scriba_projects")}
+	if s.collectors[collectorNodes] {
+		inventory = append(inventory, withSelector("scriba_nodes"))
+	}
+	add("Inventory", "timeseries", "short", 12, inventory...)
+	add("Invalid output", "timeseries", "short", 12,
+		`sum by (key) (increase(`+withSelector("scriba_invalid_output_total")+`[$__rate_interval]))`)
+	// The per-cluster panels show the ten slowest and largest clusters,
+	// labeled by cluster rather than by profile.
+	perCluster := func(title, unit, metric string) {
+		add(title, "timeseries", unit, 12, "topk(10, "+withSelector(metric)+")")
+		for _, target := range panels[len(panels)-1]["targets"].([]map[string]interface{}) {
+			target["legendFormat"] = "{{cluster}}"
+		}
+	}
+	perCluster("Slowest clusters", "s", "scriba_cluster_collection_duration_seconds")
+	perCluster("Largest clusters", "bytes", "scriba_cluster_payload_bytes")
+	if s.collectors[collectorEtcdBackups] {
+		add("Clusters without off-site etcd backups", "stat", "short", 12, "count("+withSelector("scriba_cluster_etcd_offsite_backup")+" == 0) or vector(0)")
+	}
+	if s.collectors[collectorNamespaces] {
+		add("Unassigned namespaces", "timeseries", "short", 12, "sum by (cluster) ("+withSelector("rancher_cluster_unassigned_namespaces")+")")
+	}
+
+	variables := []map[string]interface{}{
+		{"name": "datasource", "type": "datasource", "query": "prometheus", "label": "Data source"},
+	}
+	if s.profiles {
+		variables = append(variables, map[string]interface{}{
+			"name":       "profile",
+			"type":       "query",
+			"label":      "Sync profile",
+			"datasource": map[string]string{"type": "prometheus", "uid": "${datasource}"},
+			"query":      "label_values(scriba_syncs_total, profile)",
+			"includeAll": true,
+			"multi":      true,
+			"refresh":    2,
+		})
+	}
+
+	return map[string]interface{}{
+		"uid":           monitoringName,
+		"title":         "Rancher inventory (rancher-scriba)",
+		"tags":          []string{"rancher", "rancher-scriba"},
+		"schemaVersion": 38,
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"refresh":       "1m",
+		"templating":    map[string]interface{}{"list": variables},
+		"panels":        panels,
+	}
+}
+
+// dashboardConfigMap wraps the dashboard into a ConfigMap picked up by the
+// Grafana dashboard sidecar, as deployed by kube-prometheus-stack.
+func (s *monitoringSettings) dashboardConfigMap(dashboard []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      monitoringName + "-dashboard",
+			"namespace": s.namespace,
+			"labels":    map[string]string{labelManagedBy: managedByScriba, "grafana_dashboard": "1"},
+		},
+		"data": map[string]string{monitoringName + ".json": string(dashboard)},
+	}
+}
+
+// runGenerate prints generated configuration: "monitoring" prints the
+// PrometheusRule and the dashboard ConfigMap as Kubernetes manifests,
+// "dashboard" the dashboard JSON for importing it into Grafana.
+func runGenerate(cfg *Config) error {
+	if len(cfg.positional) != 1 {
+		return errors.New("usage: scriba generate [flags] monitoring|dashboard")
+	}
+	s, err := newMonitoringSettings(cfg)
+	if err != nil {
+		return err
+	}
+	dashboard, err := json.MarshalIndent(s.dashboard(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("rendering dashboard: %w", err)
+	}
+
+	switch cfg.positional[0] {
+	case "dashboard":
+		_, err = os.Stdout.Write(append(dashboard, '\n'))
+		return err
+	case "monitoring":
+		for _, manifest := range []interface{}{s.prometheusRule(), s.dashboardConfigMap(dashboard)} {
+			out, err := yaml.Marshal(manifest)
+			if err != nil {
+				return fmt.Errorf("rendering monitoring manifests: %w", err)
+			}
+			if _, err := os.Stdout.Write(append([]byte("---\n"), out...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown generate target %q (expected monitoring or dashboard)", cfg.positional[0])
+	}
+}
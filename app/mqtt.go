@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// MQTTConfig configures the MQTT sink, which publishes a retained
+// inventory document per cluster to
+// <topicPrefix><namespace>/<configMap>/clusters/<id> and the change events
+// of every sync to <topicPrefix><namespace>/<configMap>/events.
+type MQTTConfig struct {
+	// Broker is the broker URL: tcp://host:1883, or ssl:// or mqtts://
+	// for TLS.
+	Broker      string `json:"broker,omitempty"`
+	ClientID    string `json:"clientID,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	TopicPrefix string `json:"topicPrefix,omitempty"`
+	QoS         int    `json:"qos,omitempty"`
+	// CAFile verifies the broker certificate instead of the system roots.
+	CAFile string `json:"caFile,omitempty"`
+}
+
+func (m *MQTTConfig) enabled() bool {
+	return m.Broker != ""
+}
+
+func validateMQTT(m *MQTTConfig) error {
+	if !m.enabled() {
+		return nil
+	}
+	u, err := url.Parse(m.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT broker %q: %w", m.Broker, err)
+	}
+	if u.Scheme != "tcp" && u.Scheme != "ssl" && u.Scheme != "mqtts" {
+		return fmt.Errorf("unsupported MQTT broker scheme %q (expected tcp, ssl or mqtts)", u.Scheme)
+	}
+	if u.Port() == "" {
+		return fmt.Errorf("MQTT broker %q needs a port", m.Broker)
+	}
+	if m.QoS < 0 || m.QoS > 2 {
+		return fmt.Errorf("MQTT QoS must be 0, 1 or 2, got %d", m.QoS)
+	}
+	if m.ClientID == "" {
+		return errors.New("an MQTT client ID is required")
+	}
+	return nil
+}
+
+// MQTT 3.1.1 control packet types.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttDisconnect = 14
+)
+
+// mqttConn is a minimal MQTT 3.1.1 client that only publishes.
+type mqttConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	qos      int
+	packetID uint16
+}
+
+func dialMQTT(m *MQTTConfig) (*mqttConn, error) {
+	u, _ := url.Parse(m.Broker)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if u.Scheme == "tcp" {
+		conn, err = dialer.Dial("tcp", u.Host)
+	} else {
+		tlsConfig := &tls.Config{ServerName: u.Hostname()}
+		if m.CAFile != "" {
+			data, err := os.ReadFile(m.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in MQTT CA file %s", m.CAFile)
+			}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, tlsConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn), qos: m.QoS}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// Clean session, with the credentials when given and a 60s keep alive.
+	var body bytes.Buffer
+	writeMQTTString(&body, "MQTT")
+	flags := byte(0x02)
+	if m.Username != "" {
+		flags |= 0x80
+		if m.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body.Write([]byte{4, flags, 0, 60})
+	writeMQTTString(&body, m.ClientID)
+	if m.Username != "" {
+		writeMQTTString(&body, m.Username)
+		if m.Password != "" {
+			writeMQTTString(&body, m.Password)
+		}
+	}
+	if err := c.write(mqttConnect<<4, body.Bytes()); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	typ, payload, err := c.read()
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if typ != mqttConnack || len(payload) != 2 {
+		c.close()
+		return nil, fmt.Errorf("unexpected MQTT packet type %d instead of CONNACK", typ)
+	}
+	if payload[1] != 0 {
+		c.close()
+		return nil, fmt.Errorf("MQTT broker refused the connection with return code %d", payload[1])
+	}
+	return c, nil
+}
+
+func writeMQTTString(w *bytes.Buffer, s string) {
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	w.WriteString(s)
+}
+
+func (c *mqttConn) write(header byte, body []byte) error {
+	packet := []byte{header}
+	// The remaining length is a variable length integer.
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+func (c *mqttConn) read() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, payload, nil
+}
+
+// publish sends message to topic and, for QoS 1 and 2, waits until the
+// broker acknowledged it.
+func (c *mqttConn) publish(topic string, message []byte, retain bool) error {
+	c.conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var body bytes.Buffer
+	writeMQTTString(&body, topic)
+	header := byte(mqttPublish<<4) | byte(c.qos<<1)
+	if retain {
+		header |= 0x01
+	}
+	if c.qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		binary.Write(&body, binary.BigEndian, c.packetID)
+	}
+	body.Write(message)
+	if err := c.write(header, body.Bytes()); err != nil {
+		return err
+	}
+
+	switch c.qos {
+	case 1:
+		return c.expect(mqttPuback)
+	case 2:
+		if err := c.expect(mqttPubrec); err != nil {
+			return err
+		}
+		id := make([]byte, 2)
+		binary.BigEndian.PutUint16(id, c.packetID)
+		if err := c.write(mqttPubrel<<4|0x02, id); err != nil {
+			return err
+		}
+		return c.expect(mqttPubcomp)
+	}
+	return nil
+}
+
+func (c *mqttConn) expect(typ byte) error {
+	got, payload, err := c.read()
+	if err != nil {
+		return err
+	}
+	if got != typ || len(payload) < 2 || binary.BigEndian.Uint16(payload) != c.packetID {
+		return fmt.Errorf("unexpected MQTT packet type %d instead of %d", got, typ)
+	}
+	return nil
+}
+
+func (c *mqttConn) close() {
+	c.write(mqttDisconnect<<4, nil)
+	c.conn.Close()
+}
+
+// mqttClusterDocument is the document published per cluster.
+type mqttClusterDocument struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Cluster     Cluster   `json:"cluster"`
+	Projects    []Project `json:"projects"`
+	Nodes       []Node    `json:"nodes,omitempty"`
+}
+
+// publishToMQTT publishes the document of every cluster of inv, retained
+// so new subscribers receive the current state, and events, when there
+// are any. The retained documents of removed clusters are cleared.
+func publishToMQTT(cfg *Config, inv *Inventory, events *SyncEvents) error {
+	m := &cfg.MQTT
+	c, err := dialMQTT(m)
+	if err != nil {
+		return fmt.Errorf("connecting to MQTT broker %s: %w", m.Broker, err)
+	}
+	defer c.close()
+
+	base := m.TopicPrefix + cfg.Namespace + "/" + cfg.ConfigMapName
+	for _, cluster := range inv.Clusters {
+		doc, err := json.Marshal(mqttClusterDocument{
+			GeneratedAt: inv.GeneratedAt,
+			Cluster:     cluster,
+			Projects:    inv.ProjectsFor(cluster.ID),
+			Nodes:       inv.NodesFor(cluster.ID),
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.publish(base+"/clusters/"+cluster.ID, doc, true); err != nil {
+			return fmt.Errorf("publishing cluster %s: %w", cluster.ID, err)
+		}
+	}
+
+	if events == nil || len(events.Events) == 0 {
+		log.Printf("Published %d cluster documents to MQTT under %s", len(inv.Clusters), base)
+		return nil
+	}
+	for _, event := range events.Events {
+		if event.Kind == kindCluster && event.Type == eventRemoved {
+			if err := c.publish(base+"/clusters/"+event.ID, nil, true); err != nil {
+				return fmt.Errorf("clearing cluster %s: %w", event.ID, err)
+			}
+		}
+	}
+	message, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	if err := c.publish(base+"/events", message, false); err != nil {
+		return fmt.Errorf("publishing change events: %w", err)
+	}
+	log.Printf("Published %d cluster documents and %d change events to MQTT under %s", len(inv.Clusters), len(events.Events), base)
+	return nil
+}
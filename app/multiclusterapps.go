@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+)
+
+// MultiClusterApp is a legacy multi-cluster app, deployed from a catalog
+// template to the same app in several projects. Multi-cluster apps were
+// removed in Rancher 2.7 and block upgrading Rancher.
+type MultiClusterApp struct {
+	Name            string                  `json:"name"`
+	TemplateVersion string                  `json:"templateVersion,omitempty"`
+	State           string                  `json:"state,omitempty"`
+	Targets         []MultiClusterAppTarget `json:"targets,omitempty"`
+}
+
+// MultiClusterAppTarget is a project a multi-cluster app is deployed to.
+type MultiClusterAppTarget struct {
+	ProjectID string `json:"projectId"`
+	AppID     string `json:"appId,omitempty"`
+	State     string `json:"state,omitempty"`
+}
+
+// GlobalDNS is a legacy global DNS entry, publishing the ingress endpoints
+// of a multi-cluster app or of a list of projects under one FQDN at an
+// external DNS provider. Global DNS was removed in Rancher 2.7 together
+// with multi-cluster apps.
+type GlobalDNS struct {
+	Name string `json:"name"`
+	FQDN string `json:"fqdn"`
+	// Provider is the name of the global DNS provider and ProviderType its
+	// kind, e.g. route53, cloudflare or alidns.
+	Provider        string `json:"provider,omitempty"`
+	ProviderType    string `json:"providerType,omitempty"`
+	MultiClusterApp string `json:"multiClusterApp,omitempty"`
+	// ProjectIDs are the projects whose endpoints are published: the
+	// targets of the multi-cluster app, or the listed projects.
+	ProjectIDs []string `json:"projectIds,omitempty"`
+	State      string   `json:"state,omitempty"`
+}
+
+// clusterIDs returns the IDs of the clusters of the projects the app is
+// deployed to.
+func (a MultiClusterApp) clusterIDs() []string {
+	var ids []string
+	for _, target := range a.Targets {
+		clusterID, _, _ := strings.Cut(target.ProjectID, ":")
+		ids = append(ids, clusterID)
+	}
+	return ids
+}
+
+// clusterIDs returns the IDs of the clusters of the projects whose
+// endpoints are published.
+func (g GlobalDNS) clusterIDs() []string {
+	var ids []string
+	for _, projectID := range g.ProjectIDs {
+		clusterID, _, _ := strings.Cut(projectID, ":")
+		ids = append(ids, clusterID)
+	}
+	return ids
+}
+
+// getMultiClusterApps lists the multi-cluster apps and the global DNS
+// entries with the projects they target. Rancher versions without these
+// features yield empty lists.
+func getMultiClusterApps(ctx context.Context, rancherAPIURL string, accessToken string) ([]MultiClusterApp, []GlobalDNS, error) {
+	log.Println("Starting getMultiClusterApps function")
+
+	var appsResponse struct {
+		Data []struct {
+			ID                string `json:"id"`
+			Name              string `json:"name"`
+			TemplateVersionID string `json:"templateVersionId"`
+			State             string `json:"state"`
+			Targets           []struct {
+				ProjectID string `json:"projectId"`
+				AppID     string `json:"appId"`
+				State     string `json:"state"`
+			} `json:"targets"`
+		} `json:"data"`
+	}
+	err := getRancherJSON(ctx, rancherAPIURL+"/multiclusterapps", accessToken, "multi-cluster apps", &appsResponse)
+	if errors.Is(err, errRancherNotFound) {
+		log.Println("multiclusterapps not available from Rancher API, skipping")
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	apps := []MultiClusterApp{}
+	appsByID := make(map[string]MultiClusterApp)
+	for _, item := range appsResponse.Data {
+		app := MultiClusterApp{Name: item.Name, TemplateVersion: item.TemplateVersionID, State: item.State}
+		for _, target := range item.Targets {
+			app.Targets = append(app.Targets, MultiClusterAppTarget{ProjectID: target.ProjectID, AppID: target.AppID, State: target.State})
+		}
+		sort.Slice(app.Targets, func(i, j int) bool { return app.Targets[i].ProjectID < app.Targets[j].ProjectID })
+		apps = append(apps, app)
+		appsByID[item.ID] = app
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+
+	dns, err := getGlobalDNS(ctx, rancherAPIURL, accessToken, appsByID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("Fetched %d multi-cluster apps and %d global DNS entries", len(apps), len(dns))
+	return apps, dns, nil
+}
+
+// getGlobalDNS lists the global DNS entries, resolving their providers and
+// the targets of their multi-cluster apps.
+func getGlobalDNS(ctx context.Context, rancherAPIURL string, accessToken string, apps map[string]MultiClusterApp) ([]GlobalDNS, error) {
+	var providersResponse struct {
+		Data []struct {
+			ID                       string      `json:"id"`
+			Name                     string      `json:"name"`
+			Route53ProviderConfig    interface{} `json:"route53ProviderConfig"`
+			CloudflareProviderConfig interface{} `json:"cloudflareProviderConfig"`
+			AlidnsProviderConfig     interface{} `json:"alidnsProviderConfig"`
+		} `json:"data"`
+	}
+	err := getRancherJSON(ctx, rancherAPIURL+"/globaldnsproviders", accessToken, "global DNS providers", &providersResponse)
+	if errors.Is(err, errRancherNotFound) {
+		log.Println("globaldnsproviders not available from Rancher API, skipping")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type provider struct{ name, kind string }
+	providers := make(map[string]provider)
+	for _, item := range providersResponse.Data {
+		p := provider{name: item.Name}
+		switch {
+		case item.Route53ProviderConfig != nil:
+			p.kind = "route53"
+		case item.CloudflareProviderConfig != nil:
+			p.kind = "cloudflare"
+		case item.AlidnsProviderConfig != nil:
+			p.kind = "alidns"
+		}
+		providers[item.ID] = p
+	}
+
+	var dnsResponse struct {
+		Data []struct {
+			Name              string   `json:"name"`
+			FQDN              string   `json:"fqdn"`
+			ProviderID        string   `json:"providerId"`
+			MultiClusterAppID string   `json:"multiClusterAppId"`
+			ProjectIDs        []string `json:"projectIds"`
+			State             string   `json:"state"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/globaldnses", accessToken, "global DNS entries", &dnsResponse); err != nil {
+		return nil, err
+	}
+
+	entries := []GlobalDNS{}
+	for _, item := range dnsResponse.Data {
+		entry := GlobalDNS{
+			Name:         item.Name,
+			FQDN:         item.FQDN,
+			Provider:     providers[item.ProviderID].name,
+			ProviderType: providers[item.ProviderID].kind,
+			ProjectIDs:   item.ProjectIDs,
+			State:        item.State,
+		}
+		if item.MultiClusterAppID != "" {
+			entry.MultiClusterApp = item.MultiClusterAppID
+			if app, ok := apps[item.MultiClusterAppID]; ok {
+				entry.MultiClusterApp = app.Name
+				entry.ProjectIDs = nil
+				for _, target := range app.Targets {
+					entry.ProjectIDs = append(entry.ProjectIDs, target.ProjectID)
+				}
+			} else {
+				log.Printf("Warning: global DNS entry %s references unknown multi-cluster app %s", item.Name, item.MultiClusterAppID)
+			}
+		}
+		sort.Strings(entry.ProjectIDs)
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FQDN < entries[j].FQDN })
+	return entries, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Namespace is a namespace of a downstream cluster together with the
+// project it is assigned to and its aggregated ResourceQuota status.
+type Namespace struct {
+	ClusterID string              `json:"clusterId"`
+	Name      string              `json:"name"`
+	ProjectID string              `json:"projectId,omitempty"`
+	QuotaHard corev1.ResourceList `json:"quotaHard,omitempty"`
+	QuotaUsed corev1.ResourceList `json:"quotaUsed,omitempty"`
+}
+
+// QuotaUsage is the quota of one resource summed over a project's
+// namespaces.
+type QuotaUsage struct {
+	Hard        string  `json:"hard"`
+	Used        string  `json:"used"`
+	Utilization float64 `json:"utilizationPercent"`
+}
+
+const projectIDAnnotation = "field.cattle.io/projectId"
+
+// getNamespaces lists the namespaces of a downstream cluster and their
+// ResourceQuotas through Rancher's Kubernetes API proxy.
+func getNamespaces(ctx context.Context, rancherURL string, accessToken string, clusterID string) ([]Namespace, error) {
+	log.Printf("Starting getNamespaces function for cluster ID: %s", clusterID)
+	proxyURL := rancherURL + "/k8s/clusters/" + url.PathEscape(clusterID) + "/api/v1"
+
+	var namespaceList corev1.NamespaceList
+	if err := getRancherJSON(ctx, proxyURL+"/namespaces", accessToken, "namespaces", &namespaceList); err != nil {
+		return nil, err
+	}
+
+	var quotaList corev1.ResourceQuotaList
+	if err := getRancherJSON(ctx, proxyURL+"/resourcequotas", accessToken, "resource quotas", &quotaList); err != nil {
+		return nil, err
+	}
+
+	hard := make(map[string]corev1.ResourceList)
+	used := make(map[string]corev1.ResourceList)
+	for _, quota := range quotaList.Items {
+		ns := quota.Namespace
+		hard[ns] = addResourceLists(hard[ns], quota.Status.Hard)
+		used[ns] = addResourceLists(used[ns], quota.Status.Used)
+	}
+
+	namespaces := make([]Namespace, 0, len(namespaceList.Items))
+	for _, item := range namespaceList.Items {
+		projectID := item.Annotations[projectIDAnnotation]
+		if projectID == "" && item.Labels[projectIDAnnotation] != "" {
+			projectID = clusterID + ":" + item.Labels[projectIDAnnotation]
+		}
+
+		namespaces = append(namespaces, Namespace{
+			ClusterID: clusterID,
+			Name:      item.Name,
+			ProjectID: projectID,
+			QuotaHard: hard[item.Name],
+			QuotaUsed: used[item.Name],
+		})
+	}
+
+	log.Printf("Fetched %d namespaces and %d resource quotas for cluster ID %s", len(namespaces), len(quotaList.Items), clusterID)
+	return namespaces, nil
+}
+
+func addResourceLists(sum corev1.ResourceList, add corev1.ResourceList) corev1.ResourceList {
+	if sum == nil {
+		sum = corev1.ResourceList{}
+	}
+	for name, quantity := range add {
+		total := sum[name]
+		total.Add(quantity)
+		sum[name] = total
+	}
+	return sum
+}
+
+// aggregateProjectQuotas sums the quota of every project's namespaces and
+// records the utilization of each resource with a hard limit.
+func aggregateProjectQuotas(inv *Inventory) {
+	hard := make(map[string]corev1.ResourceList)
+	used := make(map[string]corev1.ResourceList)
+	for _, ns := range inv.Namespaces {
+		if ns.ProjectID == "" {
+			continue
+		}
+		hard[ns.ProjectID] = addResourceLists(hard[ns.ProjectID], ns.QuotaHard)
+		used[ns.ProjectID] = addResourceLists(used[ns.ProjectID], ns.QuotaUsed)
+	}
+
+	for i, project := range inv.Projects {
+		if len(hard[project.ID]) == 0 {
+			continue
+		}
+
+		usage := make(map[string]QuotaUsage)
+		for name, h := range hard[project.ID] {
+			u := used[project.ID][name]
+			q := QuotaUsage{Hard: h.String(), Used: u.String()}
+			if h.Sign() > 0 {
+				q.Utilization = math.Round(u.AsApproximateFloat64()/h.AsApproximateFloat64()*1000) / 10
+			}
+			usage[string(name)] = q
+		}
+		inv.Projects[i].Quota = usage
+	}
+}
+
+// unassignedNamespaces returns the names of the namespaces that are not
+// assigned to any project, by cluster ID. They escape the project's
+// quotas and RBAC.
+func unassignedNamespaces(namespaces []Namespace) map[string][]string {
+	unassigned := make(map[string][]string)
+	for _, ns := range namespaces {
+		if ns.ProjectID == "" {
+			unassigned[ns.ClusterID] = append(unassigned[ns.ClusterID], ns.Name)
+		}
+	}
+	for _, names := range unassigned {
+		sort.Strings(names)
+	}
+	return unassigned
+}
+
+// recordUnassignedNamespaces exports the number of unassigned namespaces of
+// every cluster whose namespaces were collected, and warns about them.
+func recordUnassignedNamespaces(cfg *Config, inv *Inventory) {
+	collected := make(map[string]bool)
+	for _, ns := range inv.Namespaces {
+		collected[ns.ClusterID] = true
+	}
+	unassigned := unassignedNamespaces(inv.Namespaces)
+	for _, clusterID := range sortedKeys(collected) {
+		names := unassigned[clusterID]
+		if len(names) > 0 {
+			log.Printf("Warning: %d namespaces of cluster %s are not assigned to any project: %v", len(names), clusterID, names)
+		}
+		metrics.setGauge("rancher_cluster_unassigned_namespaces", "Number of namespaces of the cluster not assigned to any project.", float64(len(names)), cfg.metricLabels("cluster", clusterID)...)
+	}
+}
+
+// renderUnassignedNamespaces renders the unassignedNamespaces key: the
+// names of the unassigned namespaces by cluster ID.
+func renderUnassignedNamespaces(namespaces []Namespace) (string, error) {
+	out, err := yaml.Marshal(unassignedNamespaces(namespaces))
+	if err != nil {
+		return "", fmt.Errorf("rendering unassigned namespaces: %w", err)
+	}
+	return string(out), nil
+}
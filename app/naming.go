@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Key schemes for the entries written to the ConfigMap.
+const (
+	keySchemeID   = "id"
+	keySchemeName = "name"
+	keySchemeBoth = "both"
+)
+
+// entryKeys returns the ConfigMap entry key of every cluster and project in
+// inv, indexed by Rancher ID. Project names are only unique within their
+// cluster, so name based project keys are prefixed with the cluster key.
+// Keys that would collide fall back to the scheme "both".
+func entryKeys(cfg *Config, inv *Inventory) map[string]string {
+	keys := make(map[string]string)
+	used := make(map[string]bool)
+
+	assign := func(id, prefix, name string) string {
+		key := prefix + formatEntryKey(cfg, id, name)
+		if used[key] {
+			key = prefix + formatEntryKey(&Config{KeyScheme: keySchemeBoth, Slugify: cfg.Slugify}, id, name)
+		}
+		used[key] = true
+		keys[id] = key
+		return key
+	}
+
+	clusterKeys := make(map[string]string)
+	for _, cluster := range inv.Clusters {
+		clusterKeys[cluster.ID] = assign(cluster.ID, "", cluster.Name)
+	}
+
+	// Assign project keys in a stable order so collisions resolve the same
+	// way on every sync.
+	projects := append([]Project(nil), inv.Projects...)
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	for _, project := range projects {
+		prefix := ""
+		if cfg.KeyScheme != keySchemeID {
+			prefix = clusterKeys[project.ClusterID] + "/"
+		}
+		assign(project.ID, prefix, project.Name)
+	}
+
+	return keys
+}
+
+func formatEntryKey(cfg *Config, id, name string) string {
+	if cfg.Slugify {
+		name = slugify(name)
+	}
+	if name == "" {
+		return id
+	}
+
+	switch cfg.KeyScheme {
+	case keySchemeName:
+		return name
+	case keySchemeBoth:
+		return name + "_" + id
+	default:
+		return id
+	}
+}
+
+// plainKeyPattern matches the keys that may be written as plain YAML
+// scalars, provided they do not read as another type such as a number.
+var plainKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// yamlKey returns key as a YAML mapping key. Rancher IDs are written
+// as they are; keys made from display names, which may contain any
+// character, are quoted unless they read back as the same string.
+func yamlKey(key string) string {
+	if plainKeyPattern.MatchString(key) {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(key), &v); err == nil && v == key {
+			return key
+		}
+	}
+	return strconv.Quote(key)
+}
+
+// slugify lowercases s and replaces every run of characters other than
+// letters and digits with a single dash.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func validateKeyScheme(scheme string) error {
+	switch scheme {
+	case keySchemeID, keySchemeName, keySchemeBoth:
+		return nil
+	}
+	return fmt.Errorf("unsupported key scheme %q (expected id, name or both)", scheme)
+}
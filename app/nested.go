@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Output layouts.
+const (
+	layoutFlat   = "flat"
+	layoutNested = "nested"
+)
+
+type nestedCluster struct {
+	ID       string                   `json:"id"`
+	Name     string                   `json:"name"`
+	State    string                   `json:"state"`
+	Projects map[string]nestedProject `json:"projects"`
+	Nodes    []nestedNode             `json:"nodes,omitempty"`
+	Fields   map[string]interface{}   `json:"fields,omitempty"`
+
+	MachineConfigs []nestedMachineConfig `json:"machineConfigs,omitempty"`
+	Alerting       *nestedAlerting       `json:"alerting,omitempty"`
+
+	Provisioning *ProvisioningInfo `json:"provisioning,omitempty"`
+	EtcdBackup   *EtcdBackup       `json:"etcdBackup,omitempty"`
+}
+
+type nestedProject struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Annotations map[string]string      `json:"annotations,omitempty"`
+	Quota       map[string]QuotaUsage  `json:"quota,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	MemberCount int                    `json:"memberCount,omitempty"`
+	Owners      []string               `json:"owners,omitempty"`
+}
+
+type nestedNode struct {
+	Name   string            `json:"name"`
+	Roles  []string          `json:"roles,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Taints []NodeTaint       `json:"taints,omitempty"`
+}
+
+type nestedMachineConfig struct {
+	Kind         string `json:"kind"`
+	Name         string `json:"name"`
+	Provider     string `json:"provider"`
+	InstanceType string `json:"instanceType,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Region       string `json:"region,omitempty"`
+}
+
+// nestedAlerting shows where a cluster's alerts are routed to. Alert
+// groups refer to their notifiers by name.
+type nestedAlerting struct {
+	Notifiers []nestedNotifier   `json:"notifiers,omitempty"`
+	Groups    []nestedAlertGroup `json:"groups,omitempty"`
+}
+
+type nestedNotifier struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Target string `json:"target,omitempty"`
+}
+
+type nestedAlertGroup struct {
+	Name      string   `json:"name"`
+	ProjectID string   `json:"projectId,omitempty"`
+	Rules     []string `json:"rules,omitempty"`
+	Notifiers []string `json:"notifiers,omitempty"`
+}
+
+// renderNested renders inv as a single YAML document under the "inventory"
+// key with every project grouped under its cluster, so consumers do not
+// need to join the flat lists themselves.
+func renderNested(cfg *Config, inv *Inventory) (map[string]string, error) {
+	keys := entryKeys(cfg, inv)
+	doc := make(map[string]nestedCluster)
+
+	for _, cluster := range inv.Clusters {
+		projects := make(map[string]nestedProject)
+		for _, project := range inv.ProjectsFor(cluster.ID) {
+			// Within a cluster the cluster part of the project key is redundant.
+			key := strings.TrimPrefix(keys[project.ID], keys[cluster.ID]+"/")
+			projects[key] = nestedProject{
+				ID:          project.ID,
+				Name:        project.Name,
+				Annotations: project.Annotations,
+				Quota:       project.Quota,
+				Fields:      project.Fields,
+				MemberCount: project.MemberCount,
+				Owners:      project.Owners,
+			}
+		}
+
+		var nodes []nestedNode
+		for _, node := range inv.NodesFor(cluster.ID) {
+			nodes = append(nodes, nestedNode{Name: node.Name, Roles: node.Roles, Labels: node.Labels, Taints: node.Taints})
+		}
+
+		var machineConfigs []nestedMachineConfig
+		for _, mc := range inv.MachineConfigsFor(cluster.ID) {
+			machineConfigs = append(machineConfigs, nestedMachineConfig{
+				Kind:         mc.Kind,
+				Name:         mc.Name,
+				Provider:     mc.Provider,
+				InstanceType: mc.InstanceType,
+				Image:        mc.Image,
+				Region:       mc.Region,
+			})
+		}
+
+		doc[keys[cluster.ID]] = nestedCluster{
+			ID:       cluster.ID,
+			Name:     cluster.Name,
+			State:    cluster.State,
+			Projects: projects,
+			Nodes:    nodes,
+			Fields:   cluster.Fields,
+
+			MachineConfigs: machineConfigs,
+			Alerting:       nestAlerting(inv, cluster.ID),
+
+			Provisioning: cluster.Provisioning,
+			EtcdBackup:   cluster.EtcdBackup,
+		}
+	}
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("rendering nested inventory: %w", err)
+	}
+	return map[string]string{"inventory": string(out)}, nil
+}
+
+// renderCompatible renders the keys of both layouts side by side, the flat
+// clusters and projects keys next to the nested inventory key.
+func renderCompatible(cfg *Config, inv *Inventory) (map[string]string, error) {
+	rendered, err := renderConfigMapData(flattenInventory(inv), entryKeys(cfg, inv))
+	if err != nil {
+		return nil, err
+	}
+	nested, err := renderNested(cfg, inv)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range nested {
+		rendered[key] = value
+	}
+	return rendered, nil
+}
+
+func validateLayout(layout string) error {
+	switch layout {
+	case layoutFlat, layoutNested:
+		return nil
+	}
+	return fmt.Errorf("unsupported layout %q (expected flat or nested)", layout)
+}
+
+func nestAlerting(inv *Inventory, clusterID string) *nestedAlerting {
+	names := make(map[string]string)
+	alerting := &nestedAlerting{}
+	for _, notifier := range inv.Notifiers {
+		names[notifier.ID] = notifier.Name
+		if notifier.ClusterID == clusterID {
+			alerting.Notifiers = append(alerting.Notifiers, nestedNotifier{Name: notifier.Name, Type: notifier.Type, Target: notifier.Target})
+		}
+	}
+	for _, group := range inv.AlertGroupsFor(clusterID) {
+		nested := nestedAlertGroup{Name: group.Name, ProjectID: group.ProjectID, Rules: group.Rules}
+		for _, id := range group.Notifiers {
+			name := names[id]
+			if name == "" {
+				name = id
+			}
+			nested.Notifiers = append(nested.Notifiers, name)
+		}
+		alerting.Groups = append(alerting.Groups, nested)
+	}
+
+	if alerting.Notifiers == nil && alerting.Groups == nil {
+		return nil
+	}
+	return alerting
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Node is a node of a downstream cluster with the labels and taints that
+// decide what is scheduled on it.
+type Node struct {
+	ClusterID string            `json:"clusterId"`
+	Name      string            `json:"name"`
+	Roles     []string          `json:"roles,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Taints    []NodeTaint       `json:"taints,omitempty"`
+}
+
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+const nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+// getNodes lists the nodes of a downstream cluster through Rancher's
+// Kubernetes API proxy.
+func getNodes(ctx context.Context, rancherURL string, accessToken string, clusterID string) ([]Node, error) {
+	log.Printf("Starting getNodes function for cluster ID: %s", clusterID)
+	proxyURL := rancherURL + "/k8s/clusters/" + url.PathEscape(clusterID) + "/api/v1"
+
+	var nodeList corev1.NodeList
+	if err := getRancherJSON(ctx, proxyURL+"/nodes", accessToken, "nodes", &nodeList); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0, len(nodeList.Items))
+	for _, item := range nodeList.Items {
+		node := Node{
+			ClusterID: clusterID,
+			Name:      item.Name,
+			Roles:     nodeRoles(item.Labels),
+			Labels:    item.Labels,
+		}
+		for _, taint := range item.Spec.Taints {
+			node.Taints = append(node.Taints, NodeTaint{Key: taint.Key, Value: taint.Value, Effect: string(taint.Effect)})
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	log.Printf("Fetched %d nodes for cluster ID %s", len(nodes), clusterID)
+	return nodes, nil
+}
+
+// nodeRoles returns the roles of a node from its node-role.kubernetes.io
+// labels, e.g. control-plane, etcd and worker.
+func nodeRoles(labels map[string]string) []string {
+	var roles []string
+	for key := range labels {
+		if role := strings.TrimPrefix(key, nodeRoleLabelPrefix); role != key && role != "" {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// NodesFor returns the nodes belonging to the given cluster.
+func (inv *Inventory) NodesFor(clusterID string) []Node {
+	var nodes []Node
+	for _, node := range inv.Nodes {
+		if node.ClusterID == clusterID {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
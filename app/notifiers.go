@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Notifier is a Rancher notifier (cluster alerting of Rancher's legacy
+// monitoring). Target names where it delivers to without revealing
+// secrets: the Slack channel or email recipient, or just the host of a
+// webhook URL.
+type Notifier struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ClusterID string `json:"clusterId"`
+	Type      string `json:"type"`
+	Target    string `json:"target,omitempty"`
+}
+
+// AlertGroup is a cluster or project alert group with its rules and the
+// notifiers its alerts are routed to.
+type AlertGroup struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	ClusterID string   `json:"clusterId"`
+	ProjectID string   `json:"projectId,omitempty"`
+	Rules     []string `json:"rules,omitempty"`
+	Notifiers []string `json:"notifiers,omitempty"`
+}
+
+// notifierTargets extract the non-secret target of a notifier from its
+// config, by notifier type.
+var notifierTargets = map[string]func(config map[string]interface{}) string{
+	"slack":     func(c map[string]interface{}) string { return stringField(c, "defaultRecipient") },
+	"smtp":      func(c map[string]interface{}) string { return stringField(c, "defaultRecipient") },
+	"pagerduty": func(map[string]interface{}) string { return "" },
+	"webhook":   func(c map[string]interface{}) string { return urlHost(stringField(c, "url")) },
+	"msteams":   func(c map[string]interface{}) string { return urlHost(stringField(c, "url")) },
+	"wechat":    func(c map[string]interface{}) string { return stringField(c, "defaultRecipient") },
+	"dingtalk":  func(c map[string]interface{}) string { return urlHost(stringField(c, "url")) },
+}
+
+// getAlertRouting lists the notifiers and the cluster and project alert
+// groups. Rancher versions without legacy alerting (2.6+, where alerts
+// are routed by Alertmanager) yield empty lists.
+func getAlertRouting(ctx context.Context, rancherAPIURL string, accessToken string) ([]Notifier, []AlertGroup, error) {
+	log.Println("Starting getAlertRouting function")
+
+	var notifiers struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	err := getRancherJSON(ctx, rancherAPIURL+"/notifiers", accessToken, "notifiers", &notifiers)
+	if errors.Is(err, errRancherNotFound) {
+		log.Println("Notifiers not available from Rancher API, skipping alert routing")
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result []Notifier
+	for _, item := range notifiers.Data {
+		notifier := Notifier{
+			ID:        stringField(item, "id"),
+			Name:      stringField(item, "name"),
+			ClusterID: stringField(item, "clusterId"),
+		}
+		for typ, target := range notifierTargets {
+			if config, ok := item[typ+"Config"].(map[string]interface{}); ok {
+				notifier.Type, notifier.Target = typ, target(config)
+			}
+		}
+		result = append(result, notifier)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	var groups []AlertGroup
+	for _, scope := range []string{"cluster", "project"} {
+		scoped, err := getAlertGroups(ctx, rancherAPIURL, accessToken, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		groups = append(groups, scoped...)
+	}
+
+	log.Printf("Fetched %d notifiers and %d alert groups", len(result), len(groups))
+	return result, groups, nil
+}
+
+// getAlertGroups lists the alert groups of scope (cluster or project) with
+// the names of their rules.
+func getAlertGroups(ctx context.Context, rancherAPIURL string, accessToken string, scope string) ([]AlertGroup, error) {
+	var groups struct {
+		Data []struct {
+			ID         string `json:"id"`
+			Name       string `json:"name"`
+			ClusterID  string `json:"clusterId"`
+			ProjectID  string `json:"projectId"`
+			Recipients []struct {
+				NotifierID string `json:"notifierId"`
+			} `json:"recipients"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/"+scope+"alertgroups", accessToken, scope+" alert groups", &groups); err != nil {
+		return nil, err
+	}
+
+	var rules struct {
+		Data []struct {
+			Name    string `json:"name"`
+			GroupID string `json:"groupId"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/"+scope+"alertrules", accessToken, scope+" alert rules", &rules); err != nil {
+		return nil, err
+	}
+	rulesByGroup := make(map[string][]string)
+	for _, rule := range rules.Data {
+		rulesByGroup[rule.GroupID] = append(rulesByGroup[rule.GroupID], rule.Name)
+	}
+
+	var result []AlertGroup
+	for _, item := range groups.Data {
+		group := AlertGroup{
+			ID:        item.ID,
+			Name:      item.Name,
+			ClusterID: item.ClusterID,
+			ProjectID: item.ProjectID,
+			Rules:     rulesByGroup[item.ID],
+		}
+		// Project alert groups only record their project.
+		if group.ClusterID == "" && group.ProjectID != "" {
+			group.ClusterID, _, _ = strings.Cut(group.ProjectID, ":")
+		}
+		for _, recipient := range item.Recipients {
+			if recipient.NotifierID != "" && !containsString(group.Notifiers, recipient.NotifierID) {
+				group.Notifiers = append(group.Notifiers, recipient.NotifierID)
+			}
+		}
+		sort.Strings(group.Rules)
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// AlertGroupsFor returns the alert groups of the given cluster and its
+// projects.
+func (inv *Inventory) AlertGroupsFor(clusterID string) []AlertGroup {
+	var groups []AlertGroup
+	for _, group := range inv.AlertGroups {
+		if group.ClusterID == clusterID {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Reasons a project is orphaned.
+const (
+	orphanClusterMissing  = "clusterMissing"
+	orphanClusterRemoving = "clusterRemoving"
+)
+
+// clusterStateRemoving is the state of a cluster Rancher is deleting.
+// Projects of a cluster stuck in it are only removed once it is gone.
+const clusterStateRemoving = "removing"
+
+// OrphanedProject is a project whose cluster no longer exists or is being
+// deleted, left for Rancher housekeeping to clean up.
+type OrphanedProject struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ClusterID string `json:"clusterId"`
+	Reason    string `json:"reason"`
+}
+
+// getOrphanedProjects lists every project visible to the token and returns
+// those whose cluster is not among clusters, the unfiltered clusters of
+// Rancher, or is being removed.
+func getOrphanedProjects(ctx context.Context, rancherAPIURL string, accessToken string, clusters []Cluster) ([]OrphanedProject, error) {
+	log.Println("Starting getOrphanedProjects function")
+
+	var response struct {
+		Data []Project `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/projects", accessToken, "projects", &response); err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string, len(clusters))
+	for _, cluster := range clusters {
+		states[cluster.ID] = cluster.State
+	}
+
+	orphans := []OrphanedProject{}
+	for _, project := range response.Data {
+		clusterID, _ := splitProjectID(project)
+		state, ok := states[clusterID]
+		switch {
+		case !ok:
+			orphans = append(orphans, OrphanedProject{ID: project.ID, Name: project.Name, ClusterID: clusterID, Reason: orphanClusterMissing})
+		case state == clusterStateRemoving:
+			orphans = append(orphans, OrphanedProject{ID: project.ID, Name: project.Name, ClusterID: clusterID, Reason: orphanClusterRemoving})
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].ID < orphans[j].ID })
+
+	log.Printf("Found %d orphaned projects among %d projects", len(orphans), len(response.Data))
+	return orphans, nil
+}
+
+// renderOrphans renders the orphans key: the orphaned projects by ID. It is
+// rendered even when there are none, so the key is cleared once Rancher
+// housekeeping has removed them.
+func renderOrphans(orphans []OrphanedProject) (string, error) {
+	if orphans == nil {
+		orphans = []OrphanedProject{}
+	}
+	out, err := yaml.Marshal(orphans)
+	if err != nil {
+		return "", fmt.Errorf("rendering orphans: %w", err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ProjectResourceQuota is the Rancher quota of a project, shared by its
+// namespaces, as listed by the projects API, e.g. limitsCpu: 2000m.
+type ProjectResourceQuota struct {
+	Limit map[string]string `json:"limit,omitempty"`
+}
+
+// QuotaCommitment compares the sum of the quotas of a cluster's projects
+// for one resource with the cluster's capacity.
+type QuotaCommitment struct {
+	Resource string `json:"resource"`
+	Quota    string `json:"quota"`
+	Capacity string `json:"capacity"`
+	// Ratio is the quota as a multiple of the capacity, and Overcommitted
+	// whether it exceeds the configured overcommit factor.
+	Ratio         float64 `json:"ratio"`
+	Overcommitted bool    `json:"overcommitted"`
+	// Projects counts the projects with a quota of the resource.
+	Projects int `json:"projects"`
+}
+
+// committedResources are the resources compared with the capacity, with
+// the project quota keys committing them in order of preference: a
+// project's limit commits more than its requests, so it counts when set.
+var committedResources = []struct {
+	name corev1.ResourceName
+	keys []string
+}{
+	{corev1.ResourceCPU, []string{"limitsCpu", "requestsCpu"}},
+	{corev1.ResourceMemory, []string{"limitsMemory", "requestsMemory"}},
+}
+
+// setQuotaCommitment sets the quota commitment of every cluster whose
+// projects have quotas, exports it as metrics and warns about clusters
+// committing more than the overcommit factor allows.
+func setQuotaCommitment(cfg *Config, inv *Inventory) {
+	for i := range inv.Clusters {
+		cluster := &inv.Clusters[i]
+		cluster.QuotaCommitment = nil
+		projects := inv.ProjectsFor(cluster.ID)
+		for _, r := range committedResources {
+			capacity, ok := cluster.Capacity[r.name]
+			if !ok || capacity.Sign() <= 0 {
+				continue
+			}
+			quota, n := sumProjectQuotas(projects, r.keys)
+			if n == 0 {
+				continue
+			}
+			c := QuotaCommitment{
+				Resource: string(r.name),
+				Quota:    quota.String(),
+				Capacity: capacity.String(),
+				Ratio:    math.Round(quota.AsApproximateFloat64()/capacity.AsApproximateFloat64()*100) / 100,
+				Projects: n,
+			}
+			c.Overcommitted = c.Ratio > cfg.OvercommitFactor
+			cluster.QuotaCommitment = append(cluster.QuotaCommitment, c)
+
+			metrics.setGauge("rancher_cluster_quota_commitment_ratio", "Sum of the project quotas of a resource as a multiple of the cluster's capacity.", c.Ratio, cfg.metricLabels("cluster", cluster.ID, "resource", c.Resource)...)
+			if c.Overcommitted {
+				log.Printf("Warning: the projects of cluster %s have %s quotas of %s, %.2f times its capacity of %s", cluster.ID, c.Resource, c.Quota, c.Ratio, c.Capacity)
+			}
+		}
+	}
+}
+
+// sumProjectQuotas sums the quotas of projects under the first of keys
+// each sets, and counts the projects with a quota.
+func sumProjectQuotas(projects []Project, keys []string) (resource.Quantity, int) {
+	var total resource.Quantity
+	var n int
+	for _, project := range projects {
+		if project.ResourceQuota == nil {
+			continue
+		}
+		for _, key := range keys {
+			value, ok := project.ResourceQuota.Limit[key]
+			if !ok {
+				continue
+			}
+			q, err := resource.ParseQuantity(value)
+			if err != nil {
+				log.Printf("Warning: ignoring the invalid %s quota %q of project %s", key, value, project.ID)
+				break
+			}
+			total.Add(q)
+			n++
+			break
+		}
+	}
+	return total, n
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConfigMaps created by scriba carry the managed-by label. Existing
+// ConfigMaps without it are only written with --adopt, which adds the label,
+// or in shared mode (--key-prefix), which only touches prefixed keys and
+// leaves ownership alone.
+
+func validateOwnership(cfg *Config) error {
+	if cfg.Exclusive && cfg.KeyPrefix != "" {
+		return errors.New("--exclusive and --key-prefix are mutually exclusive")
+	}
+	return nil
+}
+
+func ownedByScriba(cm *corev1.ConfigMap) bool {
+	return cm.Labels[labelManagedBy] == managedByScriba
+}
+
+// claimConfigMap makes sure scriba may manage cm, adopting it when adopt is
+// set.
+func claimConfigMap(cm *corev1.ConfigMap, adopt bool) error {
+	if ownedByScriba(cm) {
+		return nil
+	}
+	if !adopt {
+		return fmt.Errorf("ConfigMap %s/%s is not managed by rancher-scriba (missing label %s=%s); set --adopt to take it over or --key-prefix to share it",
+			cm.Namespace, cm.Name, labelManagedBy, managedByScriba)
+	}
+
+	log.Printf("Adopting ConfigMap '%s/%s'", cm.Namespace, cm.Name)
+	if cm.Labels == nil {
+		cm.Labels = make(map[string]string)
+	}
+	cm.Labels[labelManagedBy] = managedByScriba
+	return nil
+}
+
+// isOwnedKey reports whether key is written by scriba: any key with the
+// prefix in shared mode, otherwise one of managedKeys.
+func isOwnedKey(key, prefix string) bool {
+	if prefix != "" {
+		return strings.HasPrefix(key, prefix)
+	}
+	return isManagedKey(key)
+}
+
+// unprefixKeys returns the keys of data owned in shared mode, without the
+// prefix. Without a prefix data is returned unchanged.
+func unprefixKeys(data map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return data
+	}
+	out := make(map[string]string)
+	for key, value := range data {
+		if strings.HasPrefix(key, prefix) {
+			out[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// principalNames caches the display names of principals looked up in the
+// Rancher principals API, by Rancher API URL and principal ID, so repeated
+// syncs only look up new principals. Failed lookups are cached as well so
+// a deleted group is not looked up on every sync.
+var principalNames struct {
+	sync.Mutex
+	entries map[string]principalName
+}
+
+type principalName struct {
+	name    string
+	expires time.Time
+}
+
+// principalResolver resolves principal IDs such as
+// activedirectory_user://CN=alice,... to readable names. A nil resolver
+// leaves the IDs unchanged.
+type principalResolver struct {
+	rancherAPIURL string
+	accessToken   string
+	ttl           time.Duration
+}
+
+// newPrincipalResolver returns a resolver if principal resolution is
+// enabled.
+func newPrincipalResolver(cfg *Config, rancherAPIURL string, accessToken string) *principalResolver {
+	if !cfg.ResolvePrincipals {
+		return nil
+	}
+	return &principalResolver{rancherAPIURL: rancherAPIURL, accessToken: accessToken, ttl: cfg.PrincipalCacheTTL.Duration}
+}
+
+// name returns the display name of the principal, its name followed by
+// its login name (often the email address) when they differ, or id itself
+// if it cannot be resolved.
+func (r *principalResolver) name(ctx context.Context, id string) string {
+	if r == nil || !strings.Contains(id, "://") {
+		return id
+	}
+	key := r.rancherAPIURL + " " + id
+
+	principalNames.Lock()
+	defer principalNames.Unlock()
+	if principalNames.entries == nil {
+		principalNames.entries = make(map[string]principalName)
+	}
+	now := time.Now()
+	if entry, ok := principalNames.entries[key]; ok && now.Before(entry.expires) {
+		return entry.name
+	}
+
+	name := id
+	var principal struct {
+		Name      string `json:"name"`
+		LoginName string `json:"loginName"`
+	}
+	err := getRancherJSON(ctx, r.rancherAPIURL+"/principals/"+url.PathEscape(id), r.accessToken, "principal", &principal)
+	switch {
+	case err != nil:
+		log.Printf("Warning: could not resolve principal %s: %v", id, err)
+	case principal.Name != "" && principal.LoginName != "" && principal.LoginName != principal.Name:
+		name = principal.Name + " (" + principal.LoginName + ")"
+	case principal.Name != "":
+		name = principal.Name
+	case principal.LoginName != "":
+		name = principal.LoginName
+	}
+	principalNames.entries[key] = principalName{name: name, expires: now.Add(r.ttl)}
+	return name
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// privilegedGlobalRoles are the Rancher global roles granting write access
+// to everything. scriba only reads, so a token of a user with one of them
+// is more than it needs.
+var privilegedGlobalRoles = []string{"admin", "restricted-admin"}
+
+// tokenPrivileges caches the outcome of the last privilege check of each
+// sync profile, so the lookups only run again when its token changes.
+var tokenPrivileges struct {
+	sync.Mutex
+	checks map[string]tokenCheck
+}
+
+type tokenCheck struct {
+	token string
+	roles []string
+}
+
+// checkTokenPrivileges warns when the Rancher token belongs to a user with
+// an admin global role, and refuses it with --strict-token-privileges. The
+// result is exported as the scriba_rancher_token_admin metric.
+func checkTokenPrivileges(ctx context.Context, cfg *Config, accessToken string) error {
+	tokenPrivileges.Lock()
+	defer tokenPrivileges.Unlock()
+	if tokenPrivileges.checks == nil {
+		tokenPrivileges.checks = make(map[string]tokenCheck)
+	}
+
+	check := tokenPrivileges.checks[cfg.syncProfile]
+	if check.token != accessToken {
+		roles, err := privilegedRoles(ctx, cfg.RancherURL+"/v3", accessToken)
+		if err != nil {
+			if cfg.StrictTokenPrivileges {
+				return fmt.Errorf("%w: checking the privileges of the Rancher token: %w", errRancherAuth, err)
+			}
+			log.Printf("Warning: could not check the privileges of the Rancher token: %v", err)
+			return nil
+		}
+		check = tokenCheck{token: accessToken, roles: roles}
+		tokenPrivileges.checks[cfg.syncProfile] = check
+
+		if len(roles) > 0 {
+			log.Printf("Warning: the Rancher token has the %s global role; scriba only needs read access, use a token of a user with read-only access to the clusters and projects instead", strings.Join(roles, ", "))
+		}
+	}
+
+	admin := 0.0
+	if len(check.roles) > 0 {
+		admin = 1
+	}
+	metrics.setGauge("scriba_rancher_token_admin", "Whether the Rancher token has an admin global role (1) or not (0).", admin, cfg.metricLabels()...)
+
+	if cfg.StrictTokenPrivileges && len(check.roles) > 0 {
+		return fmt.Errorf("%w: the token has the %s global role and --strict-token-privileges is set", errRancherAuth, strings.Join(check.roles, ", "))
+	}
+	return nil
+}
+
+// privilegedRoles returns the privileged global roles bound to the user
+// owning the token.
+func privilegedRoles(ctx context.Context, rancherAPIURL string, accessToken string) ([]string, error) {
+	var users struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/users?me=true", accessToken, "current user", &users); err != nil {
+		return nil, err
+	}
+	if len(users.Data) == 0 {
+		return nil, errors.New("Rancher did not return the user of the token")
+	}
+
+	var bindings struct {
+		Data []struct {
+			GlobalRoleID string `json:"globalRoleId"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/globalrolebindings?userId="+url.QueryEscape(users.Data[0].ID), accessToken, "global role bindings", &bindings); err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	for _, binding := range bindings.Data {
+		if containsString(privilegedGlobalRoles, binding.GlobalRoleID) && !containsString(roles, binding.GlobalRoleID) {
+			roles = append(roles, binding.GlobalRoleID)
+		}
+	}
+	return roles, nil
+}
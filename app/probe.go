@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Reachability is the outcome of probing a cluster's API endpoint directly,
+// independent of Rancher and its cluster agent.
+type Reachability struct {
+	Reachable bool `json:"reachable"`
+	// LatencySeconds is how long the TCP connection and TLS handshake
+	// took, set when the endpoint is reachable.
+	LatencySeconds float64 `json:"latencySeconds,omitempty"`
+	// Error is why the endpoint is unreachable.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// probeClusters probes the API endpoint of every cluster reporting one,
+// concurrently up to the configured limit, and exports the outcome as
+// metrics.
+func probeClusters(ctx context.Context, cfg *Config, clusters []Cluster) {
+	var g errgroup.Group
+	g.SetLimit(cfg.Concurrency)
+	for i := range clusters {
+		cluster := &clusters[i]
+		endpoint := capiEndpoint(cluster.APIEndpoint)
+		if endpoint == nil {
+			continue
+		}
+		g.Go(func() error {
+			cluster.Reachability = probeEndpoint(ctx, net.JoinHostPort(endpoint.Host, strconv.Itoa(int(endpoint.Port))), cfg.ProbeTimeout.Duration)
+			return nil
+		})
+	}
+	g.Wait()
+
+	for _, cluster := range clusters {
+		if cluster.Reachability == nil {
+			continue
+		}
+		reachable := 0.0
+		if cluster.Reachability.Reachable {
+			reachable = 1
+			metrics.setGauge("rancher_cluster_probe_latency_seconds", "Duration of the TCP connection and TLS handshake with the cluster's API endpoint.", cluster.Reachability.LatencySeconds, cfg.metricLabels("cluster", cluster.ID)...)
+		} else {
+			log.Printf("Warning: the API endpoint of cluster %s is unreachable: %s", cluster.ID, cluster.Reachability.Error)
+		}
+		metrics.setGauge("rancher_cluster_reachable", "Whether the cluster's API endpoint accepted a TLS handshake (1) or not (0).", reachable, cfg.metricLabels("cluster", cluster.ID)...)
+	}
+}
+
+// probeEndpoint connects to addr and completes a TLS handshake, without
+// sending a request. The certificate is not verified: the probe checks
+// that the API server answers, not whom it presents itself as, and
+// downstream clusters commonly serve certificates of a private CA.
+func probeEndpoint(ctx context.Context, addr string, timeout time.Duration) *Reachability {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	r := &Reachability{CheckedAt: started.UTC()}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	conn.Close()
+	r.Reachable = true
+	r.LatencySeconds = time.Since(started).Seconds()
+	return r
+}
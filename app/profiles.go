@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Profile renders a view of the inventory tailored to one audience into
+// its own ConfigMap, e.g. everything for operators but only names and
+// selected annotations for developers. All profiles are rendered from the
+// same collection pass.
+type Profile struct {
+	Name      string `json:"name"`
+	ConfigMap string `json:"configMap"`
+	Namespace string `json:"namespace,omitempty"`
+	Layout    string `json:"layout,omitempty"`
+	// ConfigMapMode overrides --configmap-mode; in per-project mode
+	// ConfigMap is the prefix of the project ConfigMaps.
+	ConfigMapMode string `json:"configMapMode,omitempty"`
+
+	// Annotations lists the project annotations included, as path.Match
+	// patterns (e.g. "example.com/*"). When unset all annotations are
+	// included; an empty list includes none.
+	Annotations      []string `json:"annotations,omitempty"`
+	OmitQuota        bool     `json:"omitQuota,omitempty"`
+	OmitProvisioning bool     `json:"omitProvisioning,omitempty"`
+
+	// ClusterSelector restricts the profile to the clusters whose labels
+	// match this label selector, e.g. "env=prod".
+	ClusterSelector string `json:"clusterSelector,omitempty"`
+
+	// group and groupOutput name the group of a profile derived by
+	// groupProfiles and the ConfigMap of the profile it was derived from.
+	group       string
+	groupOutput string
+}
+
+// outputProfiles returns the configured profiles, or a single profile
+// with the complete inventory in the configured ConfigMap, each followed
+// by the profiles of its groups.
+func outputProfiles(cfg *Config) []Profile {
+	profiles := cfg.Profiles
+	if len(profiles) == 0 {
+		profiles = []Profile{{Name: "default", ConfigMap: cfg.ConfigMapName}}
+	}
+
+	var out []Profile
+	for _, p := range profiles {
+		out = append(out, p)
+		out = append(out, groupProfiles(cfg, p)...)
+	}
+	return out
+}
+
+// profileConfig returns a copy of cfg targeting the profile's ConfigMap,
+// namespace and layout.
+func profileConfig(cfg *Config, p Profile) *Config {
+	pcfg := *cfg
+	pcfg.ConfigMapName = p.ConfigMap
+	if p.Namespace != "" {
+		pcfg.Namespace = p.Namespace
+	}
+	if p.Layout != "" {
+		pcfg.Layout = p.Layout
+	}
+	if p.ConfigMapMode != "" {
+		pcfg.ConfigMapMode = p.ConfigMapMode
+	}
+	if p.group != "" {
+		pcfg.outputLabels = map[string]string{labelOutput: p.groupOutput, labelGroup: p.group}
+	}
+	return &pcfg
+}
+
+// filterInventory returns the part of inv visible to the profile. inv
+// itself is not modified.
+func (p Profile) filterInventory(inv *Inventory) *Inventory {
+	out := *inv
+	if p.ClusterSelector != "" {
+		out = *p.selectClusters(inv)
+	}
+
+	out.Clusters = append([]Cluster(nil), out.Clusters...)
+	if p.OmitProvisioning {
+		for i := range out.Clusters {
+			out.Clusters[i].Provisioning = nil
+		}
+	}
+
+	out.Projects = append([]Project(nil), out.Projects...)
+	for i := range out.Projects {
+		if p.Annotations != nil {
+			out.Projects[i].Annotations = p.matchAnnotations(out.Projects[i].Annotations)
+		}
+		if p.OmitQuota {
+			out.Projects[i].Quota = nil
+		}
+	}
+
+	return &out
+}
+
+// selectClusters returns the part of inv belonging to the clusters matching
+// the profile's cluster selector.
+func (p Profile) selectClusters(inv *Inventory) *Inventory {
+	out := &Inventory{GeneratedAt: inv.GeneratedAt, AuthProviders: inv.AuthProviders, Features: inv.Features, Drivers: inv.Drivers, Roles: inv.Roles, Tokens: inv.Tokens, Orphans: inv.Orphans}
+	for _, cluster := range inv.Clusters {
+		if cluster.matchesSelector(p.ClusterSelector) {
+			out.Clusters = append(out.Clusters, cluster)
+		}
+	}
+
+	ids := out.clusterIDs()
+	for _, project := range inv.Projects {
+		if ids[project.ClusterID] {
+			out.Projects = append(out.Projects, project)
+		}
+	}
+	for _, namespace := range inv.Namespaces {
+		if ids[namespace.ClusterID] {
+			out.Namespaces = append(out.Namespaces, namespace)
+		}
+	}
+	for _, node := range inv.Nodes {
+		if ids[node.ClusterID] {
+			out.Nodes = append(out.Nodes, node)
+		}
+	}
+	for _, mc := range inv.MachineConfigs {
+		for _, id := range mc.Clusters {
+			if ids[id] {
+				out.MachineConfigs = append(out.MachineConfigs, mc)
+				break
+			}
+		}
+	}
+	for _, notifier := range inv.Notifiers {
+		if ids[notifier.ClusterID] {
+			out.Notifiers = append(out.Notifiers, notifier)
+		}
+	}
+	for _, group := range inv.AlertGroups {
+		if ids[group.ClusterID] {
+			out.AlertGroups = append(out.AlertGroups, group)
+		}
+	}
+	for _, repo := range inv.ChartRepos {
+		if repo.ClusterID == "" || ids[repo.ClusterID] {
+			out.ChartRepos = append(out.ChartRepos, repo)
+		}
+	}
+	for _, app := range inv.MultiClusterApps {
+		if len(app.Targets) == 0 || anySelected(ids, app.clusterIDs()) {
+			out.MultiClusterApps = append(out.MultiClusterApps, app)
+		}
+	}
+	for _, dns := range inv.GlobalDNS {
+		if len(dns.ProjectIDs) == 0 || anySelected(ids, dns.clusterIDs()) {
+			out.GlobalDNS = append(out.GlobalDNS, dns)
+		}
+	}
+	for _, credential := range inv.CloudCredentials {
+		for _, id := range credential.Clusters {
+			if ids[id] {
+				out.CloudCredentials = append(out.CloudCredentials, credential)
+				break
+			}
+		}
+	}
+	out.Resources = selectResources(inv.Resources, ids, true)
+	return out
+}
+
+// anySelected reports whether any of the cluster IDs is in ids.
+func anySelected(ids map[string]bool, clusterIDs []string) bool {
+	for _, id := range clusterIDs {
+		if ids[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Profile) matchAnnotations(annotations map[string]string) map[string]string {
+	matched := make(map[string]string)
+	for key, value := range annotations {
+		for _, pattern := range p.Annotations {
+			if ok, _ := path.Match(pattern, key); ok {
+				matched[key] = value
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// publishProfiles renders inv for every output profile and writes it to
+// the profile's ConfigMap, together with the changes since prev when the
+// previous inventory is known. A failing profile does not keep the others
+// from being written.
+func publishProfiles(ctx context.Context, cfg *Config, prev, inv *Inventory) error {
+	// failed holds the errors of the profiles, which decide whether the
+	// sync is partial, and errs those of the steps after them.
+	var failed, errs []error
+	profiles := outputProfiles(cfg)
+	for _, p := range profiles {
+		var events *SyncEvents
+		if prev != nil {
+			events = newSyncEvents(p.filterInventory(prev), p.filterInventory(inv))
+		}
+		err := publish(ctx, profileConfig(cfg, p), p.filterInventory(inv), events)
+		if err != nil {
+			log.Printf("Error publishing profile %s: %v", p.Name, err)
+			failed = append(failed, fmt.Errorf("profile %s: %w", p.Name, err))
+		}
+	}
+	if err := pruneGroupConfigMaps(ctx, cfg); err != nil {
+		log.Printf("Error removing the ConfigMaps of removed groups: %v", err)
+		errs = append(errs, err)
+	}
+	if cfg.KubeconfigExport.enabled() {
+		if err := exportKubeconfig(ctx, cfg, inv); err != nil {
+			log.Printf("Error exporting the kubeconfig: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	if cfg.CAPIExport.enabled() {
+		if err := exportCAPIClusters(cfg, inv); err != nil {
+			log.Printf("Error exporting the Cluster API manifests: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(failed...)
+	if len(failed) > 0 && len(failed) < len(profiles) {
+		err = fmt.Errorf("%w: %d of %d profiles failed: %w", errPartialSync, len(failed), len(profiles), err)
+	}
+	return errors.Join(append([]error{err}, errs...)...)
+}
+
+// publish writes inv to the ConfigMap, or ConfigMaps, configured in cfg.
+// Change events are written to the events key of a single ConfigMap.
+func publish(ctx context.Context, cfg *Config, inv *Inventory, events *SyncEvents) error {
+	target := cfg.Namespace + "/" + cfg.ConfigMapName
+	if cfg.ConfigMapMode == configMapModePerProject {
+		configMaps, err := projectConfigMaps(cfg, inv)
+		if err != nil {
+			return err
+		}
+		if err := validateProjectConfigMaps(cfg, configMaps); err != nil {
+			return err
+		}
+		started := time.Now()
+		if err := recordSink(cfg, "configmap", target, started, writeProjectConfigMaps(ctx, cfg, configMaps)); err != nil {
+			return fmt.Errorf("%w: %w", errKubernetesWrite, err)
+		}
+		return nil
+	}
+
+	rendered, err := renderInventory(cfg, inv)
+	if err != nil {
+		return err
+	}
+	if events != nil {
+		if rendered["events"], err = renderEvents(events); err != nil {
+			return err
+		}
+	}
+	shed := shedOutput(cfg, rendered)
+	if err := validateRendered(cfg, rendered); err != nil {
+		return err
+	}
+	started := time.Now()
+	if err := recordSink(cfg, "configmap", target, started, updateConfigMap(ctx, cfg, rendered, shed)); err != nil {
+		return fmt.Errorf("%w: %w", errKubernetesWrite, err)
+	}
+	return writeSinks(ctx, cfg, &sinkPayload{Inventory: inv, Events: events, Rendered: rendered})
+}
+
+// validateProfiles checks the output profiles, whose ConfigMaps default to
+// namespace.
+func validateProfiles(profiles []Profile, namespace string) error {
+	seen := make(map[string]bool)
+	targets := make(map[string]bool)
+	for _, p := range profiles {
+		if p.Name == "" || p.ConfigMap == "" {
+			return errors.New("every profile needs a name and a configMap")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		seen[p.Name] = true
+
+		target := namespace + "/" + p.ConfigMap
+		if p.Namespace != "" {
+			target = p.Namespace + "/" + p.ConfigMap
+		}
+		if targets[target] {
+			return fmt.Errorf("profile %q writes to the same ConfigMap as another profile", p.Name)
+		}
+		targets[target] = true
+
+		if p.Layout != "" {
+			if err := validateLayout(p.Layout); err != nil {
+				return fmt.Errorf("profile %q: %w", p.Name, err)
+			}
+		}
+		if p.ConfigMapMode != "" {
+			if err := validateConfigMapMode(p.ConfigMapMode); err != nil {
+				return fmt.Errorf("profile %q: %w", p.Name, err)
+			}
+		}
+		for _, pattern := range p.Annotations {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("profile %q: invalid annotation pattern %q", p.Name, pattern)
+			}
+		}
+		if _, err := labels.Parse(p.ClusterSelector); err != nil {
+			return fmt.Errorf("profile %q: invalid cluster selector: %w", p.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigMap modes: a single ConfigMap with the whole inventory, or one
+// ConfigMap per project.
+const (
+	configMapModeSingle     = "single"
+	configMapModePerProject = "per-project"
+)
+
+// Labels set on per-project ConfigMaps. labelOutput holds the base
+// ConfigMap name so stale ConfigMaps of the same output can be found.
+const (
+	labelManagedBy = "app.kubernetes.io/managed-by"
+	labelOutput    = "scriba.rancher.io/output"
+	labelClusterID = "scriba.rancher.io/cluster-id"
+	labelProjectID = "scriba.rancher.io/project-id"
+
+	managedByScriba = "rancher-scriba"
+)
+
+func validateConfigMapMode(mode string) error {
+	switch mode {
+	case configMapModeSingle, configMapModePerProject:
+		return nil
+	}
+	return fmt.Errorf("unsupported ConfigMap mode %q (expected single or per-project)", mode)
+}
+
+// projectConfigMapSchema is the schema of the data of a per-project
+// ConfigMap.
+const projectConfigMapSchema = "project-configmap"
+
+// projectConfigMaps renders one ConfigMap per project in inv, named
+// <ConfigMapName>-<project name>. Projects whose names collide get their
+// project ID appended.
+func projectConfigMaps(cfg *Config, inv *Inventory) ([]*corev1.ConfigMap, error) {
+	clusters := make(map[string]Cluster)
+	for _, cluster := range inv.Clusters {
+		clusters[cluster.ID] = cluster
+	}
+
+	projects := append([]Project(nil), inv.Projects...)
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+
+	used := make(map[string]bool)
+	var configMaps []*corev1.ConfigMap
+	for _, project := range projects {
+		clusterID, projectID := splitProjectID(project)
+
+		name := projectConfigMapName(cfg.ConfigMapName, project.Name)
+		if used[name] || project.Name == "" {
+			name = projectConfigMapName(cfg.ConfigMapName, project.Name+"-"+projectID)
+		}
+		used[name] = true
+
+		data := map[string]string{
+			"clusterId":   clusterID,
+			"clusterName": clusters[clusterID].Name,
+			"projectId":   project.ID,
+			"projectName": project.Name,
+		}
+		if len(project.Annotations) > 0 {
+			out, err := yaml.Marshal(project.Annotations)
+			if err != nil {
+				return nil, fmt.Errorf("rendering annotations of project %s: %w", project.ID, err)
+			}
+			data["annotations"] = string(out)
+		}
+		if len(project.Quota) > 0 {
+			out, err := yaml.Marshal(project.Quota)
+			if err != nil {
+				return nil, fmt.Errorf("rendering quota of project %s: %w", project.ID, err)
+			}
+			data["quota"] = string(out)
+		}
+
+		configMaps = append(configMaps, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cfg.Namespace,
+				Labels: map[string]string{
+					labelManagedBy: managedByScriba,
+					labelOutput:    cfg.ConfigMapName,
+					labelClusterID: clusterID,
+					labelProjectID: projectID,
+				},
+			},
+			Data: data,
+		})
+	}
+	return configMaps, nil
+}
+
+// splitProjectID splits a Rancher project ID ("c-abc:p-xyz") into its
+// cluster and project parts; label values cannot contain the colon.
+func splitProjectID(project Project) (string, string) {
+	if i := strings.Index(project.ID, ":"); i >= 0 {
+		return project.ID[:i], project.ID[i+1:]
+	}
+	return project.ClusterID, project.ID
+}
+
+// projectConfigMapName returns a valid ConfigMap name for the project,
+// limited to the 253 characters of a DNS subdomain.
+func projectConfigMapName(base string, projectName string) string {
+	name := base + "-" + slugify(projectName)
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-")
+	}
+	return name
+}
+
+// validateProjectConfigMaps checks the data of every per-project ConfigMap
+// against its schema before any of them is written.
+func validateProjectConfigMaps(cfg *Config, configMaps []*corev1.ConfigMap) error {
+	schemas, err := getSchemas()
+	if err != nil {
+		return err
+	}
+	for _, cm := range configMaps {
+		doc, err := json.Marshal(cm.Data)
+		if err != nil {
+			return err
+		}
+		if err := validateDocument(schemas[projectConfigMapSchema], string(doc)); err != nil {
+			return invalidOutput(cfg, projectConfigMapSchema, fmt.Errorf("ConfigMap %s: %w", cm.Name, err))
+		}
+	}
+	return nil
+}
+
+// writeProjectConfigMaps creates or updates the per-project ConfigMaps and
+// deletes those of projects that no longer exist.
+func writeProjectConfigMaps(ctx context.Context, cfg *Config, configMaps []*corev1.ConfigMap) error {
+	clientset, err := getTargetKubeClient(cfg)
+	if err != nil {
+		return err
+	}
+	cmClient := clientset.CoreV1().ConfigMaps(cfg.Namespace)
+
+	var errs []error
+	wanted := make(map[string]bool)
+	for _, cm := range configMaps {
+		wanted[cm.Name] = true
+
+		existing, err := cmClient.Get(ctx, cm.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = cmClient.Create(ctx, cm, metav1.CreateOptions{})
+		case err == nil:
+			if err = claimConfigMap(existing, cfg.Adopt); err != nil {
+				break
+			}
+			for key, value := range cm.Labels {
+				existing.Labels[key] = value
+			}
+			existing.Data = cm.Data
+			_, err = cmClient.Update(ctx, existing, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("writing ConfigMap %s/%s: %w", cfg.Namespace, cm.Name, err))
+		}
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{labelManagedBy: managedByScriba, labelOutput: cfg.ConfigMapName})
+	list, err := cmClient.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("listing project ConfigMaps: %w", err))
+		return errors.Join(errs...)
+	}
+	for _, cm := range list.Items {
+		if wanted[cm.Name] {
+			continue
+		}
+		log.Printf("Deleting ConfigMap '%s/%s' of removed project %s", cfg.Namespace, cm.Name, cm.Labels[labelProjectID])
+		if err := cmClient.Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting ConfigMap %s/%s: %w", cfg.Namespace, cm.Name, err))
+		}
+	}
+
+	log.Printf("Wrote %d project ConfigMaps to namespace '%s'", len(configMaps), cfg.Namespace)
+	return errors.Join(errs...)
+}
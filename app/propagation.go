@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// PropagationConfig copies selected project annotations and labels onto
+// the namespaces of the project in the downstream clusters, so tooling
+// working on namespaces can read the project's metadata locally.
+type PropagationConfig struct {
+	// Annotations and Labels are the keys copied, or key prefixes ending
+	// in *, e.g. cost.example.com/*.
+	Annotations []string `json:"annotations,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+// The keys scriba propagated to a namespace are recorded on it, so keys
+// removed from the project or from the configuration are removed from the
+// namespace again, and keys set on the namespace by others are left alone.
+const (
+	propagatedAnnotationsAnnotation = "scriba.rancher.io/propagated-annotations"
+	propagatedLabelsAnnotation      = "scriba.rancher.io/propagated-labels"
+)
+
+func (p *PropagationConfig) enabled() bool {
+	return len(p.Annotations) > 0 || len(p.Labels) > 0
+}
+
+func validatePropagation(p *PropagationConfig) error {
+	for _, pattern := range append(append([]string(nil), p.Annotations...), p.Labels...) {
+		key := strings.TrimSuffix(pattern, "*")
+		if key == "" {
+			return fmt.Errorf("propagated key %q must name a key or a key prefix", pattern)
+		}
+		if strings.Contains(key, "cattle.io/") || strings.Contains(key, "kubernetes.io/") || strings.Contains(key, "scriba.rancher.io/") {
+			return fmt.Errorf("propagated key %q is managed by Rancher, Kubernetes or scriba", pattern)
+		}
+		if key == pattern {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return fmt.Errorf("invalid propagated key %q: %s", pattern, errs[0])
+			}
+		}
+	}
+	return nil
+}
+
+// matchKey reports whether key matches one of the patterns.
+func matchKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// propagateProjectMetadata reconciles the namespaces of the projects of
+// inv in every connected cluster, patching those whose propagated
+// annotations or labels differ from their project's. Every cluster is
+// recorded in the run report. The inventory is published by then, so
+// failing clusters make the sync partial and are retried with the next.
+func propagateProjectMetadata(ctx context.Context, cfg *Config, inv *Inventory) error {
+	if !cfg.Propagation.enabled() {
+		return nil
+	}
+	accessToken, err := getRancherToken(cfg)
+	if err != nil {
+		log.Printf("Error propagating project metadata to namespaces: %v", err)
+		return fmt.Errorf("%w: propagating project metadata: %w", errPartialSync, err)
+	}
+	projects := make(map[string]Project, len(inv.Projects))
+	for _, project := range inv.Projects {
+		projects[project.ID] = project
+	}
+
+	var clusters []string
+	for _, cluster := range inv.Clusters {
+		if cluster.Connected != nil && !*cluster.Connected {
+			log.Printf("Skipping namespace propagation for disconnected cluster %s", cluster.ID)
+			continue
+		}
+		clusters = append(clusters, cluster.ID)
+	}
+	errs := make([]error, len(clusters))
+	var g errgroup.Group
+	g.SetLimit(cfg.Concurrency)
+	for i, clusterID := range clusters {
+		i, clusterID := i, clusterID
+		g.Go(func() error {
+			patched, err := propagateToCluster(ctx, cfg, accessToken, clusterID, projects)
+			recordPropagation(cfg, clusterID, patched, err)
+			metrics.addCounter("scriba_namespace_propagation_patches_total", "Namespaces patched with the annotations and labels of their project.", float64(patched), cfg.metricLabels("cluster", clusterID)...)
+			if err != nil {
+				log.Printf("Error propagating project metadata to the namespaces of cluster %s: %v", clusterID, err)
+				metrics.addCounter("scriba_namespace_propagation_failures_total", "Clusters whose namespaces could not be reconciled with their projects.", 1, cfg.metricLabels("cluster", clusterID)...)
+				errs[i] = fmt.Errorf("cluster %s: %w", clusterID, err)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		failed := 0
+		for _, err := range errs {
+			if err != nil {
+				failed++
+			}
+		}
+		return fmt.Errorf("%w: project metadata propagation failed for %d of %d clusters: %w", errPartialSync, failed, len(clusters), err)
+	}
+	return nil
+}
+
+// propagateToCluster reconciles the namespaces of one cluster and returns
+// how many it patched.
+func propagateToCluster(ctx context.Context, cfg *Config, accessToken, clusterID string, projects map[string]Project) (int, error) {
+	proxyURL := cfg.RancherURL + "/k8s/clusters/" + url.PathEscape(clusterID) + "/api/v1/namespaces"
+	var namespaces corev1.NamespaceList
+	if err := getRancherJSON(ctx, proxyURL, accessToken, "namespaces", &namespaces); err != nil {
+		return 0, err
+	}
+
+	patched := 0
+	for _, ns := range namespaces.Items {
+		project, ok := projects[ns.Annotations[projectIDAnnotation]]
+		if !ok && ns.Annotations[propagatedAnnotationsAnnotation] == "" && ns.Annotations[propagatedLabelsAnnotation] == "" {
+			continue
+		}
+		annotations, trackedAnnotations := propagationPatch(cfg.Propagation.Annotations, project.Annotations, ns.Annotations, ns.Annotations[propagatedAnnotationsAnnotation])
+		labels, trackedLabels := propagationPatch(cfg.Propagation.Labels, project.labels, ns.Labels, ns.Annotations[propagatedLabelsAnnotation])
+		setTracked(annotations, propagatedAnnotationsAnnotation, ns.Annotations[propagatedAnnotationsAnnotation], trackedAnnotations)
+		setTracked(annotations, propagatedLabelsAnnotation, ns.Annotations[propagatedLabelsAnnotation], trackedLabels)
+		if len(annotations) == 0 && len(labels) == 0 {
+			continue
+		}
+
+		metadata := map[string]interface{}{}
+		if len(annotations) > 0 {
+			metadata["annotations"] = annotations
+		}
+		if len(labels) > 0 {
+			metadata["labels"] = labels
+		}
+		body, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+		if err != nil {
+			return patched, err
+		}
+		if err := withRetry(ctx, func() error { return patchRancherJSON(ctx, proxyURL+"/"+url.PathEscape(ns.Name), accessToken, body) }); err != nil {
+			return patched, fmt.Errorf("patching namespace %s: %w", ns.Name, err)
+		}
+		log.Printf("Updated the propagated project metadata of namespace %s of cluster %s", ns.Name, clusterID)
+		patched++
+	}
+	return patched, nil
+}
+
+// propagationPatch returns the merge patch of a namespace's annotations or
+// labels, current, that brings them in line with the matching keys of the
+// project's, with nil values removing keys, and the list of the keys to
+// record as propagated. Keys propagated before, as listed in recorded, are
+// removed once the project no longer has them.
+func propagationPatch(patterns []string, project, current map[string]string, recorded string) (map[string]interface{}, string) {
+	patch := make(map[string]interface{})
+	var keys []string
+	for key, value := range project {
+		if !matchKey(patterns, key) {
+			continue
+		}
+		keys = append(keys, key)
+		if current[key] != value {
+			patch[key] = value
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range splitList(recorded) {
+		if _, ok := current[key]; ok && !containsString(keys, key) {
+			patch[key] = nil
+		}
+	}
+	return patch, strings.Join(keys, ",")
+}
+
+// setTracked adds the change of the recorded keys to the annotation patch.
+func setTracked(patch map[string]interface{}, annotation, recorded, tracked string) {
+	switch {
+	case tracked == recorded:
+	case tracked == "":
+		patch[annotation] = nil
+	default:
+		patch[annotation] = tracked
+	}
+}
+
+// patchRancherJSON sends a JSON merge patch to a Kubernetes object through
+// Rancher's proxy.
+func patchRancherJSON(ctx context.Context, url, accessToken string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return rancherRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if isRancherAuthStatus(resp.StatusCode) {
+		return rancherAuthError("namespace patch", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d from Rancher API for namespace patch: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ProvisioningInfo holds the parts of a provisioning.cattle.io/v1 cluster
+// (RKE2/K3s clusters provisioned by Rancher 2.6+) that the /v3 management
+// API does not expose.
+type ProvisioningInfo struct {
+	Name                  string        `json:"name"`
+	Namespace             string        `json:"namespace"`
+	KubernetesVersion     string        `json:"kubernetesVersion,omitempty"`
+	CloudCredentialSecret string        `json:"cloudCredentialSecret,omitempty"`
+	KubeconfigSecret      string        `json:"kubeconfigSecret,omitempty"`
+	Ready                 bool          `json:"ready"`
+	MachinePools          []MachinePool `json:"machinePools,omitempty"`
+}
+
+type MachinePool struct {
+	Name              string `json:"name"`
+	Quantity          int    `json:"quantity"`
+	EtcdRole          bool   `json:"etcdRole,omitempty"`
+	ControlPlaneRole  bool   `json:"controlPlaneRole,omitempty"`
+	WorkerRole        bool   `json:"workerRole,omitempty"`
+	MachineConfigKind string `json:"machineConfigKind,omitempty"`
+	MachineConfigName string `json:"machineConfigName,omitempty"`
+}
+
+type provisioningCluster struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		KubernetesVersion         string `json:"kubernetesVersion"`
+		CloudCredentialSecretName string `json:"cloudCredentialSecretName"`
+		RKEConfig                 *struct {
+			MachinePools []struct {
+				Name             string `json:"name"`
+				Quantity         *int   `json:"quantity"`
+				EtcdRole         bool   `json:"etcdRole"`
+				ControlPlaneRole bool   `json:"controlPlaneRole"`
+				WorkerRole       bool   `json:"workerRole"`
+				MachineConfigRef struct {
+					Kind string `json:"kind"`
+					Name string `json:"name"`
+				} `json:"machineConfigRef"`
+			} `json:"machinePools"`
+			Etcd *rkeEtcdConfig `json:"etcd"`
+		} `json:"rkeConfig"`
+	} `json:"spec"`
+	Status struct {
+		ClusterName      string `json:"clusterName"`
+		ClientSecretName string `json:"clientSecretName"`
+		Ready            bool   `json:"ready"`
+	} `json:"status"`
+}
+
+func (pc provisioningCluster) info() *ProvisioningInfo {
+	info := &ProvisioningInfo{
+		Name:                  pc.Metadata.Name,
+		Namespace:             pc.Metadata.Namespace,
+		KubernetesVersion:     pc.Spec.KubernetesVersion,
+		CloudCredentialSecret: pc.Spec.CloudCredentialSecretName,
+		KubeconfigSecret:      pc.Status.ClientSecretName,
+		Ready:                 pc.Status.Ready,
+	}
+	if pc.Spec.RKEConfig == nil {
+		return info
+	}
+
+	for _, pool := range pc.Spec.RKEConfig.MachinePools {
+		quantity := 1
+		if pool.Quantity != nil {
+			quantity = *pool.Quantity
+		}
+		info.MachinePools = append(info.MachinePools, MachinePool{
+			Name:              pool.Name,
+			Quantity:          quantity,
+			EtcdRole:          pool.EtcdRole,
+			ControlPlaneRole:  pool.ControlPlaneRole,
+			WorkerRole:        pool.WorkerRole,
+			MachineConfigKind: pool.MachineConfigRef.Kind,
+			MachineConfigName: pool.MachineConfigRef.Name,
+		})
+	}
+	return info
+}
+
+// getProvisioningClusters lists provisioning.cattle.io/v1 clusters through
+// Rancher's /v1 API. Rancher versions without that API, or tokens not
+// allowed to read it, yield an empty list rather than an error.
+func getProvisioningClusters(ctx context.Context, rancherV1URL string, accessToken string) ([]provisioningCluster, error) {
+	log.Println("Starting getProvisioningClusters function")
+	var clusters []provisioningCluster
+
+	err := withRetry(ctx, func() error {
+		client := getHttpClient()
+		req, err := http.NewRequestWithContext(ctx, "GET", rancherV1URL+"/provisioning.cattle.io.clusters", nil)
+		if err != nil {
+			log.Printf("Error creating new request to Rancher API for provisioning clusters: %v", err)
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Error sending request to Rancher API for provisioning clusters: %v", err)
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			return rancherAuthError("provisioning clusters", resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+			log.Printf("Provisioning clusters not available from Rancher API (status %d), skipping", resp.StatusCode)
+			return nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("unexpected status code from Rancher API for provisioning clusters: %d\n", resp.StatusCode)
+			return fmt.Errorf("unexpected status code from Rancher API for provisioning clusters: %d", resp.StatusCode)
+		}
+
+		var response struct {
+			Data []provisioningCluster `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		if err != nil {
+			log.Printf("Error decoding response body for provisioning clusters: %v", err)
+			return err
+		}
+
+		clusters = response.Data
+
+		log.Printf("Fetched %d provisioning clusters from Rancher API (gzip: %t)", len(response.Data), resp.Uncompressed)
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Failed to fetch provisioning clusters after retries: %v", err)
+		return nil, err
+	}
+
+	return clusters, nil
+}
+
+// mergeProvisioningClusters attaches provisioning details to the /v3
+// clusters they belong to, matched by the management cluster ID recorded
+// in the provisioning cluster's status.
+func mergeProvisioningClusters(clusters []Cluster, provisioning []provisioningCluster) {
+	byID := make(map[string]*ProvisioningInfo)
+	for _, pc := range provisioning {
+		if pc.Status.ClusterName == "" {
+			log.Printf("Provisioning cluster %s/%s has no management cluster yet, skipping", pc.Metadata.Namespace, pc.Metadata.Name)
+			continue
+		}
+		byID[pc.Status.ClusterName] = pc.info()
+	}
+
+	for i := range clusters {
+		if info, ok := byID[clusters[i].ID]; ok {
+			clusters[i].Provisioning = info
+		}
+	}
+}
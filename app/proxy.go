@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProxyConfig enables the caching Rancher proxy of serve mode, which
+// answers reads of other automation from a cache instead of Rancher.
+type ProxyConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// TTL is how long responses are cached. TTLs overrides it per
+	// resource, e.g. clusters: 5m. Config file only.
+	TTL  metav1.Duration            `json:"ttl,omitempty"`
+	TTLs map[string]metav1.Duration `json:"ttls,omitempty"`
+}
+
+// proxyResources are the Rancher API collections served by the proxy,
+// along with their objects by ID. They hold no secrets and are what other
+// automation polls most.
+var proxyResources = []string{"clusters", "projects"}
+
+func (p *ProxyConfig) ttl(resource string) time.Duration {
+	if ttl, ok := p.TTLs[resource]; ok {
+		return ttl.Duration
+	}
+	return p.TTL.Duration
+}
+
+func validateProxy(p *ProxyConfig) error {
+	if p.TTL.Duration <= 0 {
+		return fmt.Errorf("proxy TTL must be positive, got %s", p.TTL.Duration)
+	}
+	for resource, ttl := range p.TTLs {
+		if !containsString(proxyResources, resource) {
+			return fmt.Errorf("unknown proxy resource %q (expected one of %s)", resource, strings.Join(proxyResources, ", "))
+		}
+		if ttl.Duration <= 0 {
+			return fmt.Errorf("proxy TTL of %s must be positive, got %s", resource, ttl.Duration)
+		}
+	}
+	return nil
+}
+
+// proxyCache holds the proxied responses of one sync profile by request
+// path and query.
+type proxyCache struct {
+	mu      sync.Mutex
+	entries map[string]*proxyEntry
+}
+
+// proxyEntry is a proxied response. Requests arriving while it is fetched
+// wait for it, so a burst of requests costs Rancher a single one.
+type proxyEntry struct {
+	ready chan struct{}
+
+	fetchedAt   time.Time
+	expires     time.Time
+	status      int
+	contentType string
+	body        []byte
+	err         error
+}
+
+// get returns the cached response for key, fetching it when it is
+// missing or expired, and whether it was served from the cache. Only
+// successful responses are kept for ttl.
+func (c *proxyCache) get(key string, ttl time.Duration, fetch func(*proxyEntry)) (*proxyEntry, bool) {
+	now := time.Now()
+	c.mu.Lock()
+	if e := c.entries[key]; e != nil {
+		select {
+		case <-e.ready:
+			if now.Before(e.expires) {
+				c.mu.Unlock()
+				return e, true
+			}
+		default:
+			c.mu.Unlock()
+			<-e.ready
+			return e, true
+		}
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*proxyEntry)
+	}
+	for k, e := range c.entries {
+		select {
+		case <-e.ready:
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		default:
+		}
+	}
+	e := &proxyEntry{ready: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	fetch(e)
+	e.fetchedAt = time.Now()
+	if e.err == nil && e.status == http.StatusOK {
+		e.expires = e.fetchedAt.Add(ttl)
+	}
+	close(e.ready)
+	return e, false
+}
+
+// handleProxy serves GET /proxy/v3/<resource>[/<id>] from the cache,
+// reading through to Rancher with scriba's token on a miss. It requires
+// API authentication, since the responses are those of scriba's token.
+func (s *server) handleProxy(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config()
+	if !cfg.Proxy.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if !cfg.API.authEnabled() {
+		http.Error(w, "the Rancher proxy requires API authentication", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/proxy/v3/")
+	parts := strings.Split(path, "/")
+	if len(parts) > 2 || !containsString(proxyResources, parts[0]) || (len(parts) == 2 && parts[1] == "") {
+		http.Error(w, "not proxied, the proxy serves /v3/"+strings.Join(proxyResources, " and /v3/")+" and their objects", http.StatusNotFound)
+		return
+	}
+	resource := parts[0]
+
+	// The profile parameter selects the sync profile and is not Rancher's.
+	// Encode sorts the parameters, so their order does not split the cache.
+	query := r.URL.Query()
+	query.Del("profile")
+	target := "/v3/" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	e, hit := s.proxy.get(target, cfg.Proxy.ttl(resource), func(e *proxyEntry) { fetchProxied(cfg, target, e) })
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	metrics.addCounter("scriba_proxy_requests_total", "Requests to the caching Rancher proxy by resource and whether they were served from the cache.", 1, cfg.metricLabels("resource", resource, "result", result)...)
+
+	if e.err != nil {
+		http.Error(w, "requesting Rancher: "+e.err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Set("X-Scriba-Cache", strings.ToUpper(result))
+	if e.status == http.StatusOK {
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(e.fetchedAt).Seconds())))
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(time.Until(e.expires).Seconds())))
+	}
+	w.WriteHeader(e.status)
+	if r.Method == http.MethodGet {
+		w.Write(e.body)
+	}
+}
+
+// fetchProxied requests target from Rancher into e. It does not use the
+// context of the request that missed, as other requests may be waiting
+// for the response.
+func fetchProxied(cfg *Config, target string, e *proxyEntry) {
+	accessToken, err := getRancherToken(cfg)
+	if err != nil {
+		e.err = err
+		return
+	}
+	req, err := http.NewRequest("GET", cfg.RancherURL+target, nil)
+	if err != nil {
+		e.err = err
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		e.err = err
+		return
+	}
+	defer resp.Body.Close()
+	e.body, e.err = io.ReadAll(resp.Body)
+	e.status, e.contentType = resp.StatusCode, resp.Header.Get("Content-Type")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisConfig configures the Redis sink, which stores every cluster and
+// project as a hash for low-latency lookups and publishes change events
+// to a channel. Keys are named <keyPrefix><namespace>/<configMap>:cluster:<id>
+// and ...:project:<id>, with the IDs in the ...:clusters and ...:projects
+// sets.
+type RedisConfig struct {
+	Addr      string `json:"addr,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	DB        int    `json:"db,omitempty"`
+	TLS       bool   `json:"tls,omitempty"`
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	// TTL expires the keys unless a later sync refreshes them, so stale
+	// data disappears when scriba stops. Zero keeps them forever.
+	TTL metav1.Duration `json:"ttl,omitempty"`
+	// Channel receives the change events of every sync with changes.
+	Channel string `json:"channel,omitempty"`
+}
+
+func (r *RedisConfig) enabled() bool {
+	return r.Addr != ""
+}
+
+func validateRedis(r *RedisConfig) error {
+	if !r.enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(r.Addr); err != nil {
+		return fmt.Errorf("invalid Redis address %q: %w", r.Addr, err)
+	}
+	if r.DB < 0 {
+		return fmt.Errorf("Redis database must not be negative, got %d", r.DB)
+	}
+	if r.TTL.Duration < 0 {
+		return fmt.Errorf("Redis TTL must not be negative, got %s", r.TTL.Duration)
+	}
+	return nil
+}
+
+// redisConn is a minimal RESP2 client, enough for the few commands the
+// sink sends.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialRedis(r *RedisConfig) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if r.TLS {
+		host, _, _ := net.SplitHostPort(r.Addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.Addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", r.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if r.Password != "" {
+		args := []string{"AUTH", r.Password}
+		if r.Username != "" {
+			args = []string{"AUTH", r.Username, r.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.close()
+			return nil, fmt.Errorf("authenticating: %w", err)
+		}
+	}
+	if r.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.DB)); err != nil {
+			c.close()
+			return nil, fmt.Errorf("selecting database %d: %w", r.DB, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) close() {
+	c.conn.Close()
+}
+
+// do sends a command and returns its reply: a string, an integer, nil or
+// a slice of replies. Error replies are returned as errors.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply from Redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// Error elements, e.g. of a failed command within EXEC, fail the
+		// whole reply.
+		items := make([]interface{}, 0, n)
+		var itemErr error
+		for i := 0; i < n; i++ {
+			item, err := c.reply()
+			if err != nil && itemErr == nil {
+				itemErr = err
+			}
+			items = append(items, item)
+		}
+		return items, itemErr
+	default:
+		return nil, fmt.Errorf("unexpected reply from Redis: %q", line)
+	}
+}
+
+// writeToRedis replaces the cluster and project hashes with those of inv
+// in one transaction and publishes events, when there are any.
+func writeToRedis(cfg *Config, inv *Inventory, events *SyncEvents) error {
+	r := &cfg.Redis
+	c, err := dialRedis(r)
+	if err != nil {
+		return fmt.Errorf("connecting to Redis at %s: %w", r.Addr, err)
+	}
+	defer c.close()
+
+	base := r.KeyPrefix + cfg.Namespace + "/" + cfg.ConfigMapName
+	clusters := make(map[string][]string, len(inv.Clusters))
+	for _, cluster := range inv.Clusters {
+		labels, _ := json.Marshal(cluster.Labels)
+		clusters[cluster.ID] = []string{
+			"id", cluster.ID,
+			"name", cluster.Name,
+			"state", cluster.State,
+			"provider", cluster.Provider,
+			"kubernetesVersion", cluster.KubernetesVersion(),
+			"labels", string(labels),
+		}
+	}
+	projects := make(map[string][]string, len(inv.Projects))
+	for _, project := range inv.Projects {
+		annotations, _ := json.Marshal(project.Annotations)
+		projects[project.ID] = []string{
+			"id", project.ID,
+			"name", project.Name,
+			"clusterId", project.ClusterID,
+			"annotations", string(annotations),
+		}
+	}
+
+	// Entries removed since the previous sync are deleted with the rest.
+	var stale []string
+	for kind, current := range map[string]map[string][]string{"cluster": clusters, "project": projects} {
+		reply, err := c.do("SMEMBERS", base+":"+kind+"s")
+		if err != nil {
+			return fmt.Errorf("reading %s IDs: %w", kind, err)
+		}
+		members, _ := reply.([]interface{})
+		for _, member := range members {
+			if id, _ := member.(string); id != "" {
+				if _, ok := current[id]; !ok {
+					stale = append(stale, base+":"+kind+":"+id)
+				}
+			}
+		}
+	}
+
+	commands := [][]string{{"MULTI"}}
+	if len(stale) > 0 {
+		commands = append(commands, append([]string{"DEL"}, stale...))
+	}
+	for kind, entries := range map[string]map[string][]string{"cluster": clusters, "project": projects} {
+		set := base + ":" + kind + "s"
+		commands = append(commands, []string{"DEL", set})
+		ids := []string{"SADD", set}
+		for id, fields := range entries {
+			key := base + ":" + kind + ":" + id
+			commands = append(commands, []string{"DEL", key}, append([]string{"HSET", key}, fields...))
+			if r.TTL.Duration > 0 {
+				commands = append(commands, []string{"PEXPIRE", key, strconv.FormatInt(r.TTL.Milliseconds(), 10)})
+			}
+			ids = append(ids, id)
+		}
+		if len(entries) > 0 {
+			commands = append(commands, ids)
+			if r.TTL.Duration > 0 {
+				commands = append(commands, []string{"PEXPIRE", set, strconv.FormatInt(r.TTL.Milliseconds(), 10)})
+			}
+		}
+	}
+	commands = append(commands, []string{"EXEC"})
+
+	for _, command := range commands {
+		if _, err := c.do(command...); err != nil {
+			c.do("DISCARD")
+			return fmt.Errorf("%s: %w", command[0], err)
+		}
+	}
+	log.Printf("Wrote %d clusters and %d projects to Redis under %s", len(clusters), len(projects), base)
+
+	if r.Channel != "" && events != nil && len(events.Events) > 0 {
+		message, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		if _, err := c.do("PUBLISH", r.Channel, string(message)); err != nil {
+			return fmt.Errorf("publishing change events to %s: %w", r.Channel, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often the config file and config ConfigMap
+// are checked for changes. Polling the content rather than watching for
+// events also catches ConfigMap volume updates, which swap a symlink
+// instead of writing the file.
+const configPollInterval = 10 * time.Second
+
+// watchConfig reloads the configuration on SIGHUP and whenever the content
+// of the config file or config ConfigMap changes.
+func (s *server) watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	last := configChecksum(s.config())
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			s.reload("SIGHUP")
+		case <-ticker.C:
+			cfg := s.config()
+			if cfg.configFile == "" && cfg.ConfigConfigMap == "" {
+				continue
+			}
+			if sum := configChecksum(cfg); sum != nil && !bytes.Equal(sum, last) {
+				last = sum
+				s.reload("configuration changed")
+			}
+		}
+	}
+}
+
+// reload loads the configuration again from the same arguments, config
+// file and environment. An invalid configuration is logged and the current
+// one kept. Settings bound at startup (listen address, TLS, credential
+// source, the set of sync profiles) only take effect after a restart.
+func (s *server) reload(reason string) {
+	old := s.config()
+	cfg, err := loadConfig(old.args)
+	if err != nil {
+		log.Printf("Error reloading configuration (%s), keeping the current one: %v", reason, err)
+		return
+	}
+	if old.syncProfile != "" {
+		if cfg = cfg.syncProfileConfig(old.syncProfile); cfg == nil {
+			log.Printf("Sync profile %s was removed (%s), this takes effect after a restart", old.syncProfile, reason)
+			return
+		}
+	}
+
+	if cfg.ListenAddress != old.ListenAddress {
+		log.Printf("Listen address changed to %s, this takes effect after a restart", cfg.ListenAddress)
+	}
+	if cfg.API.TLSCertFile != old.API.TLSCertFile || cfg.API.TLSKeyFile != old.API.TLSKeyFile ||
+		cfg.API.TLSSecret != old.API.TLSSecret || cfg.API.ClientCAFile != old.API.ClientCAFile {
+		log.Printf("TLS settings changed, this takes effect after a restart")
+	}
+	if cfg.RancherToken != old.RancherToken || !reflect.DeepEqual(cfg.CredentialSource, old.CredentialSource) {
+		log.Printf("Rancher credentials changed, this takes effect after a restart")
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.clusters = nil
+	s.mu.Unlock()
+	setRancherHeaders(cfg)
+	setHTTPDebug(cfg)
+
+	select {
+	case s.reloaded <- struct{}{}:
+	default:
+	}
+	log.Printf("Reloaded configuration (%s), syncing every %s", reason, cfg.Interval.Duration)
+}
+
+// configChecksum hashes the content of the config file and config
+// ConfigMap. It returns nil when either cannot be read.
+func configChecksum(cfg *Config) []byte {
+	h := sha256.New()
+	if cfg.configFile != "" {
+		data, err := os.ReadFile(cfg.configFile)
+		if err != nil {
+			log.Printf("Error reading config file %s: %v", cfg.configFile, err)
+			return nil
+		}
+		h.Write(data)
+	}
+	if cfg.ConfigConfigMap != "" {
+		data, err := readConfigConfigMap(cfg)
+		if err != nil {
+			log.Printf("Error reading config ConfigMap: %v", err)
+			return nil
+		}
+		h.Write(data)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type reportCluster struct {
+	Cluster
+	Projects             []Project
+	UnassignedNamespaces []string
+}
+
+// reportOvercommit is an overcommitted resource of a cluster.
+type reportOvercommit struct {
+	ClusterName string
+	ClusterID   string
+	QuotaCommitment
+}
+
+type reportData struct {
+	GeneratedAt      time.Time
+	Clusters         []reportCluster
+	ProjectCount     int
+	DueForRefresh    int
+	CloudCredentials []CloudCredential
+	AuthProviders    []AuthProvider
+	Drivers          []Driver
+	CustomRoles      []Role
+	Overcommitted    []reportOvercommit
+	ChartRepos       []ChartRepo
+	ExpiringTokens   []reportToken
+	Orphans          []OrphanedProject
+	MultiClusterApps []MultiClusterApp
+	GlobalDNS        []GlobalDNS
+}
+
+const markdownReportTemplate = `# Rancher inventory report
+
+Generated at {{ .GeneratedAt.Format "2006-01-02 15:04:05 MST" }}: {{ len .Clusters }} clusters, {{ .ProjectCount }} projects.
+
+## Clusters
+
+| Name | ID | State | Kubernetes version | Age | Projects |
+|------|----|-------|--------------------|-----|----------|
+{{- range .Clusters }}
+| {{ md .Name }} | {{ md .ID }} | {{ md .State }}{{ with .Reachability }}{{ if not .Reachable }} **unreachable**{{ end }}{{ end }} | {{ md .KubernetesVersion }}{{ with .KubernetesEOL }}{{ if eq .Status "eol" }} **EOL since {{ .Date }}**{{ else if eq .Status "nearingEol" }} (EOL on {{ .Date }}){{ end }}{{ end }} | {{ with .AgeDays }}{{ . }} days{{ end }} | {{ len .Projects }} |
+{{- end }}
+{{- if .DueForRefresh }}
+
+{{ .DueForRefresh }} clusters are older than a year and run a Kubernetes release past its end of life.
+{{- end }}
+
+## Projects
+{{ range .Clusters }}
+### {{ md .Name }} ({{ md .ID }})
+{{ if .Projects }}
+| Name | ID | Annotations | Quota utilization | Owners |
+|------|----|-------------|-------------------|--------|
+{{- range .Projects }}
+| {{ md .Name }} | {{ md .ID }} | {{ range $i, $a := annotations .Annotations }}{{ if $i }}<br>{{ end }}{{ md $a }}{{ end }} | {{ range $i, $q := quota .Quota }}{{ if $i }}<br>{{ end }}{{ md $q }}{{ end }} | {{ range $i, $o := .Owners }}{{ if $i }}, {{ end }}{{ md $o }}{{ end }}{{ if .MemberCount }} ({{ .MemberCount }} members){{ end }} |
+{{- end }}
+{{ else }}
+No projects.
+{{ end }}
+{{- if .UnassignedNamespaces }}
+Namespaces not assigned to any project: {{ range $i, $n := .UnassignedNamespaces }}{{ if $i }}, {{ end }}{{ md $n }}{{ end }}
+{{ end }}
+{{- end }}
+{{- if .Overcommitted }}
+## Overcommitted clusters
+
+The project quotas of these clusters add up to more of a resource than the overcommit factor allows.
+
+| Cluster | Resource | Project quotas | Capacity | Ratio | Projects with quota |
+|---------|----------|----------------|----------|-------|---------------------|
+{{- range .Overcommitted }}
+| {{ md .ClusterName }} ({{ md .ClusterID }}) | {{ md .Resource }} | {{ md .Quota }} | {{ md .Capacity }} | {{ .Ratio }} | {{ .Projects }} |
+{{- end }}
+{{ end }}
+{{- if .AuthProviders }}
+## Authentication providers
+
+| Provider | Type | Enabled | Access mode | Allowed principals | Settings |
+|----------|------|---------|-------------|--------------------|----------|
+{{- range .AuthProviders }}
+| {{ md .ID }} | {{ md .Type }} | {{ if .Enabled }}yes{{ else }}no{{ end }} | {{ md .AccessMode }} | {{ .AllowedPrincipals }} | {{ range $i, $s := annotations .Settings }}{{ if $i }}<br>{{ end }}{{ md $s }}{{ end }} |
+{{- end }}
+{{ end }}
+{{- if .Drivers }}
+## Active drivers
+
+| Driver | Kind | Built in | URL | Whitelisted domains |
+|--------|------|----------|-----|---------------------|
+{{- range .Drivers }}
+| {{ md .Name }} | {{ md .Kind }} | {{ if .Builtin }}yes{{ else }}no{{ end }} | {{ md .URL }} | {{ range $i, $d := .WhitelistDomains }}{{ if $i }}, {{ end }}{{ md $d }}{{ end }} |
+{{- end }}
+{{ end }}
+{{- if .CustomRoles }}
+## Custom roles
+
+Global roles and role templates that do not ship with Rancher.
+
+| Role | Kind | Default | Locked | Inherits | Wildcard | Rules |
+|------|------|---------|--------|----------|----------|-------|
+{{- range .CustomRoles }}
+| {{ md .Name }} ({{ md .ID }}) | {{ md .Kind }} | {{ if .Default }}yes{{ else }}no{{ end }} | {{ if .Locked }}yes{{ else }}no{{ end }} | {{ range $i, $r := .Inherits }}{{ if $i }}, {{ end }}{{ md $r }}{{ end }} | {{ if .Wildcard }}**yes**{{ else }}no{{ end }} | {{ range $i, $r := rules .Rules }}{{ if $i }}<br>{{ end }}{{ md $r }}{{ end }} |
+{{- end }}
+{{ end }}
+{{- if .ChartRepos }}
+## Chart repositories
+
+| Cluster | Kind | Name | URL | Branch | Last refresh | Refresh error |
+|---------|------|------|-----|--------|--------------|---------------|
+{{- range .ChartRepos }}
+| {{ with .ClusterID }}{{ md . }}{{ else }}global{{ end }} | {{ md .Kind }} | {{ md .Name }} | {{ md .URL }} | {{ md .Branch }} | {{ md .LastRefresh }} | {{ md .RefreshError }} |
+{{- end }}
+{{ end }}
+{{- if .MultiClusterApps }}
+## Multi-cluster apps
+
+Multi-cluster apps were removed in Rancher 2.7; migrate these before upgrading Rancher.
+
+| Name | Template version | State | Target projects |
+|------|------------------|-------|-----------------|
+{{- range .MultiClusterApps }}
+| {{ md .Name }} | {{ md .TemplateVersion }} | {{ md .State }} | {{ range $i, $t := .Targets }}{{ if $i }}, {{ end }}{{ md $t.ProjectID }}{{ else }}none{{ end }} |
+{{- end }}
+{{ end }}
+{{- if .GlobalDNS }}
+## Global DNS
+
+Global DNS was removed in Rancher 2.7; migrate these before upgrading Rancher.
+
+| FQDN | Provider | Multi-cluster app | Projects | State |
+|------|----------|-------------------|----------|-------|
+{{- range .GlobalDNS }}
+| {{ md .FQDN }} | {{ md .Provider }}{{ with .ProviderType }} ({{ md . }}){{ end }} | {{ md .MultiClusterApp }} | {{ range $i, $p := .ProjectIDs }}{{ if $i }}, {{ end }}{{ md $p }}{{ else }}none{{ end }} | {{ md .State }} |
+{{- end }}
+{{ end }}
+{{- if .ExpiringTokens }}
+## Expiring API tokens
+
+| Token | User | Description | Cluster | Expires | Last used | Status |
+|-------|------|-------------|---------|---------|-----------|--------|
+{{- range .ExpiringTokens }}
+| {{ md .ID }} | {{ md .UserID }} | {{ md .Description }} | {{ md .ClusterID }} | {{ md .ExpiresAt }} | {{ md .LastUsedAt }} | {{ .Status }} |
+{{- end }}
+{{ end }}
+{{- if .Orphans }}
+## Orphaned projects
+
+| Project | ID | Cluster | Reason |
+|---------|----|---------|--------|
+{{- range .Orphans }}
+| {{ md .Name }} | {{ md .ID }} | {{ md .ClusterID }} | {{ if eq .Reason "clusterRemoving" }}cluster is being removed{{ else }}cluster no longer exists{{ end }} |
+{{- end }}
+{{ end }}
+{{- if .CloudCredentials }}
+## Cloud credentials
+
+| Name | ID | Type | Created | Clusters |
+|------|----|------|---------|----------|
+{{- range .CloudCredentials }}
+| {{ md .Name }} | {{ md .ID }} | {{ md .Type }} | {{ md .Created }} | {{ range $i, $c := .Clusters }}{{ if $i }}, {{ end }}{{ md $c }}{{ else }}unused{{ end }} |
+{{- end }}
+{{ end }}`
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Rancher inventory report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Rancher inventory report</h1>
+<p>Generated at {{ .GeneratedAt.Format "2006-01-02 15:04:05 MST" }}: {{ len .Clusters }} clusters, {{ .ProjectCount }} projects.</p>
+<h2>Clusters</h2>
+<table>
+<tr><th>Name</th><th>ID</th><th>State</th><th>Kubernetes version</th><th>Age</th><th>Projects</th></tr>
+{{- range .Clusters }}
+<tr><td>{{ .Name }}</td><td>{{ .ID }}</td><td>{{ .State }}{{ with .Reachability }}{{ if not .Reachable }} <strong>unreachable</strong>{{ end }}{{ end }}</td><td>{{ .KubernetesVersion }}{{ with .KubernetesEOL }}{{ if eq .Status "eol" }} <strong>EOL since {{ .Date }}</strong>{{ else if eq .Status "nearingEol" }} (EOL on {{ .Date }}){{ end }}{{ end }}</td><td>{{ with .AgeDays }}{{ . }} days{{ end }}</td><td>{{ len .Projects }}</td></tr>
+{{- end }}
+</table>
+{{- if .DueForRefresh }}
+<p>{{ .DueForRefresh }} clusters are older than a year and run a Kubernetes release past its end of life.</p>
+{{- end }}
+<h2>Projects</h2>
+{{- range .Clusters }}
+<h3>{{ .Name }} ({{ .ID }})</h3>
+{{- if .Projects }}
+<table>
+<tr><th>Name</th><th>ID</th><th>Annotations</th><th>Quota utilization</th><th>Owners</th></tr>
+{{- range .Projects }}
+<tr><td>{{ .Name }}</td><td>{{ .ID }}</td><td>{{ range $i, $a := annotations .Annotations }}{{ if $i }}<br>{{ end }}{{ $a }}{{ end }}</td><td>{{ range $i, $q := quota .Quota }}{{ if $i }}<br>{{ end }}{{ $q }}{{ end }}</td><td>{{ range $i, $o := .Owners }}{{ if $i }}, {{ end }}{{ $o }}{{ end }}{{ if .MemberCount }} ({{ .MemberCount }} members){{ end }}</td></tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No projects.</p>
+{{- end }}
+{{- if .UnassignedNamespaces }}
+<p>Namespaces not assigned to any project: {{ range $i, $n := .UnassignedNamespaces }}{{ if $i }}, {{ end }}{{ $n }}{{ end }}</p>
+{{- end }}
+{{- end }}
+{{- if .Overcommitted }}
+<h2>Overcommitted clusters</h2>
+<p>The project quotas of these clusters add up to more of a resource than the overcommit factor allows.</p>
+<table>
+<tr><th>Cluster</th><th>Resource</th><th>Project quotas</th><th>Capacity</th><th>Ratio</th><th>Projects with quota</th></tr>
+{{- range .Overcommitted }}
+<tr><td>{{ .ClusterName }} ({{ .ClusterID }})</td><td>{{ .Resource }}</td><td>{{ .Quota }}</td><td>{{ .Capacity }}</td><td>{{ .Ratio }}</td><td>{{ .Projects }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .AuthProviders }}
+<h2>Authentication providers</h2>
+<table>
+<tr><th>Provider</th><th>Type</th><th>Enabled</th><th>Access mode</th><th>Allowed principals</th><th>Settings</th></tr>
+{{- range .AuthProviders }}
+<tr><td>{{ .ID }}</td><td>{{ .Type }}</td><td>{{ if .Enabled }}yes{{ else }}no{{ end }}</td><td>{{ .AccessMode }}</td><td>{{ .AllowedPrincipals }}</td><td>{{ range $i, $s := annotations .Settings }}{{ if $i }}<br>{{ end }}{{ $s }}{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Drivers }}
+<h2>Active drivers</h2>
+<table>
+<tr><th>Driver</th><th>Kind</th><th>Built in</th><th>URL</th><th>Whitelisted domains</th></tr>
+{{- range .Drivers }}
+<tr><td>{{ .Name }}</td><td>{{ .Kind }}</td><td>{{ if .Builtin }}yes{{ else }}no{{ end }}</td><td>{{ .URL }}</td><td>{{ range $i, $d := .WhitelistDomains }}{{ if $i }}, {{ end }}{{ $d }}{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .CustomRoles }}
+<h2>Custom roles</h2>
+<p>Global roles and role templates that do not ship with Rancher.</p>
+<table>
+<tr><th>Role</th><th>Kind</th><th>Default</th><th>Locked</th><th>Inherits</th><th>Wildcard</th><th>Rules</th></tr>
+{{- range .CustomRoles }}
+<tr><td>{{ .Name }} ({{ .ID }})</td><td>{{ .Kind }}</td><td>{{ if .Default }}yes{{ else }}no{{ end }}</td><td>{{ if .Locked }}yes{{ else }}no{{ end }}</td><td>{{ range $i, $r := .Inherits }}{{ if $i }}, {{ end }}{{ $r }}{{ end }}</td><td>{{ if .Wildcard }}<strong>yes</strong>{{ else }}no{{ end }}</td><td>{{ range $i, $r := rules .Rules }}{{ if $i }}<br>{{ end }}{{ $r }}{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .ChartRepos }}
+<h2>Chart repositories</h2>
+<table>
+<tr><th>Cluster</th><th>Kind</th><th>Name</th><th>URL</th><th>Branch</th><th>Last refresh</th><th>Refresh error</th></tr>
+{{- range .ChartRepos }}
+<tr><td>{{ with .ClusterID }}{{ . }}{{ else }}global{{ end }}</td><td>{{ .Kind }}</td><td>{{ .Name }}</td><td>{{ .URL }}</td><td>{{ .Branch }}</td><td>{{ .LastRefresh }}</td><td>{{ .RefreshError }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .MultiClusterApps }}
+<h2>Multi-cluster apps</h2>
+<p>Multi-cluster apps were removed in Rancher 2.7; migrate these before upgrading Rancher.</p>
+<table>
+<tr><th>Name</th><th>Template version</th><th>State</th><th>Target projects</th></tr>
+{{- range .MultiClusterApps }}
+<tr><td>{{ .Name }}</td><td>{{ .TemplateVersion }}</td><td>{{ .State }}</td><td>{{ range $i, $t := .Targets }}{{ if $i }}, {{ end }}{{ $t.ProjectID }}{{ else }}none{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .GlobalDNS }}
+<h2>Global DNS</h2>
+<p>Global DNS was removed in Rancher 2.7; migrate these before upgrading Rancher.</p>
+<table>
+<tr><th>FQDN</th><th>Provider</th><th>Multi-cluster app</th><th>Projects</th><th>State</th></tr>
+{{- range .GlobalDNS }}
+<tr><td>{{ .FQDN }}</td><td>{{ .Provider }}{{ with .ProviderType }} ({{ . }}){{ end }}</td><td>{{ .MultiClusterApp }}</td><td>{{ range $i, $p := .ProjectIDs }}{{ if $i }}, {{ end }}{{ $p }}{{ else }}none{{ end }}</td><td>{{ .State }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .ExpiringTokens }}
+<h2>Expiring API tokens</h2>
+<table>
+<tr><th>Token</th><th>User</th><th>Description</th><th>Cluster</th><th>Expires</th><th>Last used</th><th>Status</th></tr>
+{{- range .ExpiringTokens }}
+<tr><td>{{ .ID }}</td><td>{{ .UserID }}</td><td>{{ .Description }}</td><td>{{ .ClusterID }}</td><td>{{ .ExpiresAt }}</td><td>{{ .LastUsedAt }}</td><td>{{ .Status }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Orphans }}
+<h2>Orphaned projects</h2>
+<table>
+<tr><th>Project</th><th>ID</th><th>Cluster</th><th>Reason</th></tr>
+{{- range .Orphans }}
+<tr><td>{{ .Name }}</td><td>{{ .ID }}</td><td>{{ .ClusterID }}</td><td>{{ if eq .Reason "clusterRemoving" }}cluster is being removed{{ else }}cluster no longer exists{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .CloudCredentials }}
+<h2>Cloud credentials</h2>
+<table>
+<tr><th>Name</th><th>ID</th><th>Type</th><th>Created</th><th>Clusters</th></tr>
+{{- range .CloudCredentials }}
+<tr><td>{{ .Name }}</td><td>{{ .ID }}</td><td>{{ .Type }}</td><td>{{ .Created }}</td><td>{{ range $i, $c := .Clusters }}{{ if $i }}, {{ end }}{{ $c }}{{ else }}unused{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`
+
+var reportFuncs = map[string]interface{}{
+	"md":          markdownEscape,
+	"annotations": sortedAnnotations,
+	"rules":       ruleLines,
+	"quota":       quotaLines,
+}
+
+var (
+	markdownReport = template.Must(template.New("markdown").Funcs(reportFuncs).Parse(markdownReportTemplate))
+	htmlReport     = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(htmlReportTemplate))
+)
+
+func newReportData(inv *Inventory) reportData {
+	data := reportData{GeneratedAt: inv.GeneratedAt, ProjectCount: len(inv.Projects), CloudCredentials: inv.CloudCredentials, AuthProviders: inv.AuthProviders, Drivers: activeDrivers(inv.Drivers), CustomRoles: customRoles(inv.Roles), ChartRepos: inv.ChartRepos, ExpiringTokens: expiringTokens(inv.Tokens, inv.GeneratedAt), Orphans: inv.Orphans, MultiClusterApps: inv.MultiClusterApps, GlobalDNS: inv.GlobalDNS}
+
+	unassigned := unassignedNamespaces(inv.Namespaces)
+	for _, cluster := range inv.Clusters {
+		if dueForRefresh(cluster) {
+			data.DueForRefresh++
+		}
+		for _, c := range cluster.QuotaCommitment {
+			if c.Overcommitted {
+				data.Overcommitted = append(data.Overcommitted, reportOvercommit{ClusterName: cluster.Name, ClusterID: cluster.ID, QuotaCommitment: c})
+			}
+		}
+		projects := inv.ProjectsFor(cluster.ID)
+		sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+		data.Clusters = append(data.Clusters, reportCluster{Cluster: cluster, Projects: projects, UnassignedNamespaces: unassigned[cluster.ID]})
+	}
+	sort.Slice(data.Clusters, func(i, j int) bool { return data.Clusters[i].Name < data.Clusters[j].Name })
+	sort.SliceStable(data.Overcommitted, func(i, j int) bool { return data.Overcommitted[i].ClusterName < data.Overcommitted[j].ClusterName })
+
+	return data
+}
+
+// renderReport renders a human readable summary of inv in the given format.
+func renderReport(inv *Inventory, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case "markdown", "md":
+		err = markdownReport.Execute(&buf, newReportData(inv))
+	case "html":
+		err = htmlReport.Execute(&buf, newReportData(inv))
+	default:
+		return nil, fmt.Errorf("unsupported report format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func reportContentType(format string) string {
+	if format == "html" {
+		return "text/html; charset=utf-8"
+	}
+	return "text/markdown; charset=utf-8"
+}
+
+func runReport(cfg *Config) error {
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+	inv, err := collectInventory(ctx, cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	report, err := renderReport(inv, cfg.ReportFormat)
+	if err != nil {
+		return err
+	}
+	report, err = encryptOutput(cfg, report)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(cfg.ReportOutput, report)
+}
+
+// writeOutput writes data to path, or to stdout when path is "-".
+func writeOutput(path string, data []byte) error {
+	if path == "-" || path == "" {
+		_, err := io.Copy(os.Stdout, bytes.NewReader(data))
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func sortedAnnotations(annotations map[string]string) []string {
+	var lines []string
+	for key, value := range annotations {
+		lines = append(lines, key+"="+value)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func quotaLines(quota map[string]QuotaUsage) []string {
+	var lines []string
+	for name, q := range quota {
+		lines = append(lines, fmt.Sprintf("%s: %s / %s (%.1f%%)", name, q.Used, q.Hard, q.Utilization))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+var markdownReplacer = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ", "<", "&lt;", ">", "&gt;")
+
+func markdownEscape(s string) string {
+	return markdownReplacer.Replace(s)
+}
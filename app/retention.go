@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy decides which snapshots a sink keeping history keeps;
+// the others are deleted after every write. A snapshot is kept when any
+// rule keeps it, and a policy without rules keeps every snapshot. Azure
+// Blob is the only sink keeping history, and the only one taking a policy.
+type RetentionPolicy struct {
+	// KeepLast keeps the newest snapshots.
+	KeepLast int `json:"keepLast,omitempty"`
+	// KeepDaily, KeepWeekly and KeepMonthly keep the newest snapshot of
+	// every day, ISO week or month of the last as many days, weeks or
+	// months, e.g. KeepDaily 30 and KeepWeekly 52 for dailies for a month
+	// and weeklies for a year.
+	KeepDaily   int `json:"keepDaily,omitempty"`
+	KeepWeekly  int `json:"keepWeekly,omitempty"`
+	KeepMonthly int `json:"keepMonthly,omitempty"`
+}
+
+func (p *RetentionPolicy) enabled() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+func validateRetention(name string, p *RetentionPolicy) error {
+	if p.KeepLast < 0 || p.KeepDaily < 0 || p.KeepWeekly < 0 || p.KeepMonthly < 0 {
+		return fmt.Errorf("%s retention must not keep a negative number of snapshots", name)
+	}
+	return nil
+}
+
+// expired returns the snapshots, given by when they were taken, that p
+// does not keep at now, oldest first.
+func (p *RetentionPolicy) expired(taken []time.Time, now time.Time) []time.Time {
+	if !p.enabled() {
+		return nil
+	}
+	newest := append([]time.Time(nil), taken...)
+	sort.Slice(newest, func(i, j int) bool { return newest[i].After(newest[j]) })
+
+	keep := make(map[time.Time]bool)
+	for i := 0; i < p.KeepLast && i < len(newest); i++ {
+		keep[newest[i]] = true
+	}
+	rules := []struct {
+		since  time.Time
+		period func(time.Time) string
+	}{
+		{now.AddDate(0, 0, -p.KeepDaily), func(t time.Time) string { return t.Format("2006-01-02") }},
+		{now.AddDate(0, 0, -7*p.KeepWeekly), func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{now.AddDate(0, -p.KeepMonthly, 0), func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, rule := range rules {
+		seen := make(map[string]bool)
+		for _, t := range newest {
+			if !t.After(rule.since) {
+				break
+			}
+			if period := rule.period(t.UTC()); !seen[period] {
+				seen[period] = true
+				keep[t] = true
+			}
+		}
+	}
+
+	var expired []time.Time
+	for i := len(newest) - 1; i >= 0; i-- {
+		if !keep[newest[i]] {
+			expired = append(expired, newest[i])
+		}
+	}
+	return expired
+}
+
+// parseRetention parses a policy given as comma-separated rules, e.g.
+// last=10,daily=30,weekly=52,monthly=12.
+func parseRetention(s string) (RetentionPolicy, error) {
+	var p RetentionPolicy
+	for _, rule := range splitList(s) {
+		name, value, _ := strings.Cut(rule, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid retention rule %q, expected <rule>=<count>", rule)
+		}
+		switch strings.TrimSpace(name) {
+		case "last":
+			p.KeepLast = n
+		case "daily":
+			p.KeepDaily = n
+		case "weekly":
+			p.KeepWeekly = n
+		case "monthly":
+			p.KeepMonthly = n
+		default:
+			return p, fmt.Errorf("unknown retention rule %q (expected last, daily, weekly or monthly)", name)
+		}
+	}
+	return p, nil
+}
+
+// retentionFlag is a retention policy flag in the format of
+// parseRetention.
+type retentionFlag RetentionPolicy
+
+func (f *retentionFlag) String() string {
+	var rules []string
+	for _, rule := range []struct {
+		name  string
+		count int
+	}{{"last", f.KeepLast}, {"daily", f.KeepDaily}, {"weekly", f.KeepWeekly}, {"monthly", f.KeepMonthly}} {
+		if rule.count > 0 {
+			rules = append(rules, rule.name+"="+strconv.Itoa(rule.count))
+		}
+	}
+	return strings.Join(rules, ",")
+}
+
+func (f *retentionFlag) Set(s string) error {
+	p, err := parseRetention(s)
+	if err != nil {
+		return err
+	}
+	*f = retentionFlag(p)
+	return nil
+}
+
+// envRetention parses a retention policy. An unparsable value is logged
+// and ignored.
+func envRetention(name string, def RetentionPolicy) RetentionPolicy {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	p, err := parseRetention(v)
+	if err != nil {
+		log.Printf("Ignoring %s: %v", name, err)
+		return def
+	}
+	return p
+}
+
+func recordPrunedSnapshots(cfg *Config, sink string, pruned int) {
+	metrics.addCounter("scriba_snapshots_pruned_total", "Snapshots deleted by the retention policy of a sink keeping history.", float64(pruned), cfg.metricLabels("sink", sink)...)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Role kinds: global roles grant Rancher-wide permissions, cluster and
+// project role templates are bound to users on a cluster or project.
+const (
+	roleKindGlobal  = "global"
+	roleKindCluster = "cluster"
+	roleKindProject = "project"
+)
+
+// Role is a Rancher global role or role template. Builtin roles ship with
+// Rancher; the others were created by administrators.
+type Role struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Builtin bool   `json:"builtin"`
+	// Default is whether the role is granted to new users (global roles)
+	// or to the creators of clusters and projects (role templates).
+	Default bool `json:"default,omitempty"`
+	// Locked role templates cannot be bound anymore.
+	Locked bool `json:"locked,omitempty"`
+	// Inherits lists the role templates whose rules the role includes.
+	Inherits []string            `json:"inherits,omitempty"`
+	Rules    []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+// Wildcard reports whether any of the role's rules grants all verbs, all
+// resources or all API groups.
+func (r Role) Wildcard() bool {
+	for _, rule := range r.Rules {
+		if containsString(rule.Verbs, "*") || containsString(rule.Resources, "*") || containsString(rule.APIGroups, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// getRoles lists the global roles and the cluster and project role
+// templates.
+func getRoles(ctx context.Context, rancherAPIURL string, accessToken string) ([]Role, error) {
+	log.Println("Starting getRoles function")
+
+	var globalRoles struct {
+		Data []struct {
+			ID             string              `json:"id"`
+			Name           string              `json:"name"`
+			Builtin        bool                `json:"builtin"`
+			NewUserDefault bool                `json:"newUserDefault"`
+			Rules          []rbacv1.PolicyRule `json:"rules"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/globalroles", accessToken, "global roles", &globalRoles); err != nil {
+		return nil, err
+	}
+	var roles []Role
+	for _, item := range globalRoles.Data {
+		roles = append(roles, Role{
+			Kind:    roleKindGlobal,
+			ID:      item.ID,
+			Name:    item.Name,
+			Builtin: item.Builtin,
+			Default: item.NewUserDefault,
+			Rules:   item.Rules,
+		})
+	}
+
+	var roleTemplates struct {
+		Data []struct {
+			ID                    string              `json:"id"`
+			Name                  string              `json:"name"`
+			Context               string              `json:"context"`
+			Builtin               bool                `json:"builtin"`
+			Locked                bool                `json:"locked"`
+			ClusterCreatorDefault bool                `json:"clusterCreatorDefault"`
+			ProjectCreatorDefault bool                `json:"projectCreatorDefault"`
+			RoleTemplateIDs       []string            `json:"roleTemplateIds"`
+			Rules                 []rbacv1.PolicyRule `json:"rules"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/roletemplates", accessToken, "role templates", &roleTemplates); err != nil {
+		return nil, err
+	}
+	for _, item := range roleTemplates.Data {
+		kind := roleKindProject
+		if item.Context == roleKindCluster {
+			kind = roleKindCluster
+		}
+		roles = append(roles, Role{
+			Kind:     kind,
+			ID:       item.ID,
+			Name:     item.Name,
+			Builtin:  item.Builtin,
+			Default:  item.ClusterCreatorDefault || item.ProjectCreatorDefault,
+			Locked:   item.Locked,
+			Inherits: item.RoleTemplateIDs,
+			Rules:    item.Rules,
+		})
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Kind != roles[j].Kind {
+			return roles[i].Kind < roles[j].Kind
+		}
+		return roles[i].ID < roles[j].ID
+	})
+
+	log.Printf("Fetched %d roles", len(roles))
+	return roles, nil
+}
+
+// customRoles returns the roles that do not ship with Rancher.
+func customRoles(roles []Role) []Role {
+	var custom []Role
+	for _, role := range roles {
+		if !role.Builtin {
+			custom = append(custom, role)
+		}
+	}
+	return custom
+}
+
+// ruleLines renders policy rules for the report, one line per rule, e.g.
+// "get, list apps/deployments".
+func ruleLines(rules []rbacv1.PolicyRule) []string {
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		var targets []string
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if group != "" {
+					resource = group + "/" + resource
+				}
+				targets = append(targets, resource)
+			}
+		}
+		targets = append(targets, rule.NonResourceURLs...)
+		line := fmt.Sprintf("%s %s", strings.Join(rule.Verbs, ", "), strings.Join(targets, ", "))
+		if len(rule.ResourceNames) > 0 {
+			line += " (" + strings.Join(rule.ResourceNames, ", ") + ")"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
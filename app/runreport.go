@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunReport is the machine-readable outcome of a run written with
+// --run-report, so wrapping pipelines can act on it without parsing the
+// log.
+type RunReport struct {
+	Command    string    `json:"command"`
+	Version    string    `json:"version"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Success    bool      `json:"success"`
+	ExitCode   int       `json:"exitCode"`
+	// Durations holds the duration of the run (total) and of its phases
+	// (collect, publish, or <profile>/collect and <profile>/publish with
+	// sync profiles) in seconds.
+	Durations map[string]float64 `json:"durations"`
+	// Requests counts the Rancher API requests by method and path, with
+	// cluster IDs in downstream cluster paths replaced by {cluster}.
+	Requests []EndpointRequests `json:"requests"`
+	Sinks    []SinkResult       `json:"sinks"`
+	// Shed lists the keys dropped from ConfigMaps for exceeding the output
+	// budgets.
+	Shed []ShedKeys `json:"shed,omitempty"`
+	// Propagation lists the clusters whose namespaces were reconciled
+	// with the metadata of their projects.
+	Propagation []PropagationResult `json:"propagation,omitempty"`
+	Errors      []string            `json:"errors"`
+	// RancherEndpoints reports the URL in use of the Rancher installations
+	// with fallback URLs.
+	RancherEndpoints []RancherEndpointStatus `json:"rancherEndpoints,omitempty"`
+}
+
+// EndpointRequests counts the requests sent to one Rancher API endpoint.
+// Failures are transport errors and responses with a 4xx or 5xx status.
+type EndpointRequests struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Count    int    `json:"count"`
+	Failures int    `json:"failures"`
+}
+
+// SinkResult is the outcome of writing the inventory of one ConfigMap
+// target (namespace/name) of a sync profile to one output.
+type SinkResult struct {
+	Profile         string  `json:"profile,omitempty"`
+	Sink            string  `json:"sink"`
+	Target          string  `json:"target"`
+	Success         bool    `json:"success"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// ShedKeys are the keys dropped from the output of one ConfigMap target
+// (namespace/name) of a sync profile.
+type ShedKeys struct {
+	Profile string   `json:"profile,omitempty"`
+	Target  string   `json:"target"`
+	Keys    []string `json:"keys"`
+}
+
+// PropagationResult is the outcome of propagating project metadata to
+// the namespaces of one cluster of a sync profile.
+type PropagationResult struct {
+	Profile string `json:"profile,omitempty"`
+	Cluster string `json:"cluster"`
+	// Patched is the number of namespaces patched, also when the cluster
+	// failed later.
+	Patched int    `json:"patched"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runStats accumulates what the run report records while a command runs.
+var runStats struct {
+	sync.Mutex
+	requests    map[string]*EndpointRequests
+	sinks       []SinkResult
+	shed        []ShedKeys
+	propagation []PropagationResult
+	durations   map[string]float64
+}
+
+// recordRequest counts a Rancher API request and its outcome.
+func recordRequest(req *http.Request, resp *http.Response, err error) {
+	path := endpointPath(req.URL.Path)
+	key := req.Method + " " + path
+
+	runStats.Lock()
+	defer runStats.Unlock()
+	if runStats.requests == nil {
+		runStats.requests = make(map[string]*EndpointRequests)
+	}
+	endpoint := runStats.requests[key]
+	if endpoint == nil {
+		endpoint = &EndpointRequests{Method: req.Method, Path: path}
+		runStats.requests[key] = endpoint
+	}
+	endpoint.Count++
+	if err != nil || resp.StatusCode >= 400 {
+		endpoint.Failures++
+	}
+}
+
+// rancherRequestCount returns the number of Rancher API requests sent so
+// far.
+func rancherRequestCount() int {
+	runStats.Lock()
+	defer runStats.Unlock()
+	n := 0
+	for _, endpoint := range runStats.requests {
+		n += endpoint.Count
+	}
+	return n
+}
+
+// endpointPath replaces the cluster ID of a downstream cluster proxy path
+// (/k8s/clusters/<id>/...), so the requests to every cluster are counted
+// together.
+func endpointPath(path string) string {
+	before, rest, ok := strings.Cut(path, "/k8s/clusters/")
+	if !ok {
+		return path
+	}
+	if _, tail, ok := strings.Cut(rest, "/"); ok {
+		return before + "/k8s/clusters/{cluster}/" + tail
+	}
+	return before + "/k8s/clusters/{cluster}"
+}
+
+// recordShed records the keys dropped from the output of target.
+func recordShed(cfg *Config, target string, keys []string) {
+	runStats.Lock()
+	runStats.shed = append(runStats.shed, ShedKeys{Profile: cfg.syncProfile, Target: target, Keys: keys})
+	runStats.Unlock()
+}
+
+// recordPropagation records the outcome of propagating project metadata
+// to the namespaces of a cluster.
+func recordPropagation(cfg *Config, clusterID string, patched int, err error) {
+	result := PropagationResult{Profile: cfg.syncProfile, Cluster: clusterID, Patched: patched, Success: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	runStats.Lock()
+	runStats.propagation = append(runStats.propagation, result)
+	runStats.Unlock()
+}
+
+// recordSink records the outcome of writing to sink and returns err.
+func recordSink(cfg *Config, sink, target string, started time.Time, err error) error {
+	result := SinkResult{
+		Profile:         cfg.syncProfile,
+		Sink:            sink,
+		Target:          target,
+		Success:         err == nil,
+		DurationSeconds: time.Since(started).Seconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	runStats.Lock()
+	runStats.sinks = append(runStats.sinks, result)
+	runStats.Unlock()
+	return err
+}
+
+// recordDuration records the duration of a phase of the run.
+func recordDuration(phase string, d time.Duration) {
+	runStats.Lock()
+	defer runStats.Unlock()
+	if runStats.durations == nil {
+		runStats.durations = make(map[string]float64)
+	}
+	runStats.durations[phase] = d.Seconds()
+}
+
+// phaseName names a phase of a sync for the run report, prefixed with the
+// sync profile when several are run.
+func phaseName(cfg *Config, phase string) string {
+	if cfg.syncProfile == "" {
+		return phase
+	}
+	return cfg.syncProfile + "/" + phase
+}
+
+// newRunReport builds the report of command from the recorded statistics.
+func newRunReport(command string, started time.Time, err error) *RunReport {
+	finished := time.Now()
+	report := &RunReport{
+		Command:    command,
+		Version:    version,
+		StartedAt:  started.UTC(),
+		FinishedAt: finished.UTC(),
+		Success:    err == nil,
+		ExitCode:   exitCode(err),
+		Durations:  map[string]float64{"total": finished.Sub(started).Seconds()},
+		Requests:   []EndpointRequests{},
+		Sinks:      []SinkResult{},
+		Errors:     errorMessages(err),
+	}
+	if errors.Is(err, errDriftDetected) || errors.Is(err, errValidationFailed) {
+		report.ExitCode = exitFailure
+	}
+
+	runStats.Lock()
+	defer runStats.Unlock()
+	for phase, seconds := range runStats.durations {
+		report.Durations[phase] = seconds
+	}
+	for _, key := range sortedKeys(runStats.requests) {
+		report.Requests = append(report.Requests, *runStats.requests[key])
+	}
+	report.Sinks = append(report.Sinks, runStats.sinks...)
+	report.Shed = append(report.Shed, runStats.shed...)
+	report.Propagation = append(report.Propagation, runStats.propagation...)
+	report.RancherEndpoints = rancherEndpointStatuses()
+	return report
+}
+
+// errorMessages lists the messages of err. Errors joined with errors.Join
+// are listed one per line of their message, so they are split up again.
+func errorMessages(err error) []string {
+	messages := []string{}
+	if err == nil {
+		return messages
+	}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// writeRunReport writes the run report as JSON to path, or to standard
+// output for "-".
+func writeRunReport(path string, report *RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("writing run report: %w", err)
+	}
+	return nil
+}
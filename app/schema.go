@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"sigs.k8s.io/yaml"
+)
+
+// schemaVersion is the version of the ConfigMap payload schemas. It is
+// part of their $id and only changes with incompatible payload changes.
+const schemaVersion = "v2"
+
+// The JSON Schemas of the ConfigMap payloads, by output key. Schemas of
+// earlier versions stay in the repository for consumers still on them.
+//
+//go:embed schemas/v2/*.schema.json
+var schemaFiles embed.FS
+
+var (
+	compiledSchemas     map[string]*jsonschema.Schema
+	compiledSchemasErr  error
+	compiledSchemasOnce sync.Once
+)
+
+// schemaNames returns the output keys that have a schema.
+func schemaNames() []string {
+	entries, _ := schemaFiles.ReadDir("schemas/" + schemaVersion)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".schema.json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func schemaSource(name string) ([]byte, error) {
+	return schemaFiles.ReadFile("schemas/" + schemaVersion + "/" + name + ".schema.json")
+}
+
+func getSchemas() (map[string]*jsonschema.Schema, error) {
+	compiledSchemasOnce.Do(func() {
+		compiler := jsonschema.NewCompiler()
+		compiler.AssertFormat = true
+		schemas := make(map[string]*jsonschema.Schema)
+		for _, name := range schemaNames() {
+			source, err := schemaSource(name)
+			if err != nil {
+				compiledSchemasErr = err
+				return
+			}
+			url := name + ".schema.json"
+			if err := compiler.AddResource(url, bytes.NewReader(source)); err != nil {
+				compiledSchemasErr = fmt.Errorf("loading schema %s: %w", name, err)
+				return
+			}
+			if schemas[name], err = compiler.Compile(url); err != nil {
+				compiledSchemasErr = fmt.Errorf("compiling schema %s: %w", name, err)
+				return
+			}
+		}
+		compiledSchemas = schemas
+	})
+	return compiledSchemas, compiledSchemasErr
+}
+
+// validateRendered checks every rendered output key that has a schema
+// against it before anything is written to any sink, so a payload that
+// breaks the published contract is never written.
+func validateRendered(cfg *Config, rendered map[string]string) error {
+	schemas, err := getSchemas()
+	if err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(rendered) {
+		schema, ok := schemas[key]
+		if !ok {
+			continue
+		}
+		if err := validateDocument(schema, rendered[key]); err != nil {
+			return invalidOutput(cfg, key, err)
+		}
+	}
+	return nil
+}
+
+// invalidOutput counts a document that failed validation and returns the
+// error refusing to publish it.
+func invalidOutput(cfg *Config, key string, err error) error {
+	metrics.addCounter("scriba_invalid_output_total", "Rendered documents that did not match their schema and were not published, by output key.", 1,
+		cfg.metricLabels("key", key)...)
+	return fmt.Errorf("%w: refusing to publish %s of %s/%s: %w", errInvalidOutput, key, cfg.Namespace, cfg.ConfigMapName, err)
+}
+
+// validateDocument validates a YAML or JSON document.
+func validateDocument(schema *jsonschema.Schema, doc string) error {
+	data, err := yaml.YAMLToJSON([]byte(doc))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return schema.Validate(v)
+}
+
+// runSchema prints the schema of the named output key, or lists the
+// available schemas without a name.
+func runSchema(cfg *Config) error {
+	if len(cfg.positional) == 0 {
+		fmt.Printf("Schemas (%s) of the ConfigMap payloads; run 'scriba schema <name>' to print one:\n", schemaVersion)
+		for _, name := range schemaNames() {
+			fmt.Printf("  %s\n", name)
+		}
+		return nil
+	}
+
+	name := cfg.positional[0]
+	source, err := schemaSource(name)
+	if err != nil {
+		return fmt.Errorf("unknown schema %q (expected one of %v)", name, schemaNames())
+	}
+	_, err = os.Stdout.Write(source)
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	configConfigMapKey   = "config.yaml"
+	serviceAccountNSPath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// ownNamespace returns the namespace scriba runs in: POD_NAMESPACE (set
+// through the downward API), the service account's namespace, or the
+// output namespace when running outside a cluster.
+func ownNamespace(cfg *Config) string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile(serviceAccountNSPath); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return cfg.Namespace
+}
+
+// readConfigConfigMap returns the config file stored in the config
+// ConfigMap.
+func readConfigConfigMap(cfg *Config) ([]byte, error) {
+	clientset, err := getKubeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := ownNamespace(cfg)
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cfg.ConfigConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading config ConfigMap %s/%s: %w", namespace, cfg.ConfigConfigMap, err)
+	}
+	data, ok := cm.Data[configConfigMapKey]
+	if !ok {
+		return nil, fmt.Errorf("config ConfigMap %s/%s has no %s key", namespace, cfg.ConfigConfigMap, configConfigMapKey)
+	}
+	return []byte(data), nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// server runs the sync loop in serve mode and keeps the latest inventory
+// around for the HTTP endpoints. The configuration can be replaced at
+// runtime, see watchConfig.
+type server struct {
+	mu        sync.RWMutex
+	cfg       *Config
+	inventory *Inventory
+	events    *SyncEvents
+
+	// emailed is the inventory of the last report email, the baseline for
+	// the changes listed in the next one.
+	emailed *Inventory
+
+	// alerts is only used by the sync loop.
+	alerts alertState
+
+	// clusters caches the collected clusters for differential sync. It is
+	// dropped when the configuration is reloaded.
+	clusters *clusterCache
+
+	// reloaded is signalled after the configuration was replaced so the
+	// loop picks up a changed interval.
+	reloaded chan struct{}
+
+	// trigger is signalled to start the next sync right away, see
+	// triggerSync.
+	trigger chan struct{}
+
+	// proxy caches the Rancher responses of the caching proxy.
+	proxy proxyCache
+}
+
+func runServe(cfg *Config) error {
+	configs, err := cfg.syncConfigs()
+	if err != nil {
+		return err
+	}
+	// Every sync profile runs its own sync loop on its own interval.
+	var servers []*server
+	for _, pcfg := range configs {
+		srv := &server{cfg: pcfg, reloaded: make(chan struct{}, 1), trigger: make(chan struct{}, 1)}
+		srv.alerts.lastSuccess = time.Now()
+		go srv.loop()
+		go srv.watchConfig()
+		servers = append(servers, srv)
+		if pcfg.syncProfile != "" {
+			log.Printf("Running sync profile %s every %s", pcfg.syncProfile, pcfg.Interval.Duration)
+		}
+	}
+	// The API settings cannot differ between sync profiles, so the first
+	// one's are as good as any.
+	srv := servers[0]
+
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", srv.handleHealthz)
+	mux.HandleFunc("/openapi.json", handleOpenAPI)
+	mux.HandleFunc("/inventory", srv.requireAuth(route(servers, (*server).handleInventory)))
+	mux.HandleFunc("/report", srv.requireAuth(route(servers, (*server).handleReport)))
+	mux.HandleFunc("/events", srv.requireAuth(route(servers, (*server).handleEvents)))
+	mux.HandleFunc("/sync", srv.requireAuth(denyTenants(handleSync(servers))))
+	mux.HandleFunc("/version", srv.requireAuth(handleVersion))
+	mux.HandleFunc("/metrics", srv.requireAuth(denyTenants(handleMetrics)))
+	mux.HandleFunc("/apis", srv.requireAuth(srv.handleAggregatedAPI))
+	mux.HandleFunc("/apis/", srv.requireAuth(srv.handleAggregatedAPI))
+	mux.HandleFunc("/proxy/v3/", srv.requireAuth(denyTenants(route(servers, (*server).handleProxy))))
+
+	schedule := fmt.Sprintf(", syncing every %s", srv.config().Interval.Duration)
+	if len(servers) > 1 {
+		schedule = fmt.Sprintf(", running %d sync profiles", len(servers))
+	}
+	httpServer := &http.Server{Addr: cfg.ListenAddress, Handler: mux, TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		log.Printf("Serving HTTPS on %s%s", cfg.ListenAddress, schedule)
+		return httpServer.ListenAndServeTLS("", "")
+	}
+	log.Printf("Serving on %s%s", cfg.ListenAddress, schedule)
+	return httpServer.ListenAndServe()
+}
+
+// route serves a request with the server of the sync profile named by the
+// profile query parameter, defaulting to the first sync profile.
+func route(servers []*server, handle func(*server, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("profile")
+		if name == "" {
+			handle(servers[0], w, r)
+			return
+		}
+		for _, s := range servers {
+			if s.config().syncProfile == name {
+				handle(s, w, r)
+				return
+			}
+		}
+		http.Error(w, "unknown sync profile", http.StatusNotFound)
+	}
+}
+
+func (s *server) loop() {
+	for {
+		last := time.Now()
+		s.sync()
+		s.waitForNextSync(last)
+	}
+}
+
+// waitForNextSync waits until the interval has passed since last, or a
+// sync is triggered. A reload recomputes the deadline with the new
+// interval.
+func (s *server) waitForNextSync(last time.Time) {
+	for {
+		timer := time.NewTimer(time.Until(last.Add(s.config().Interval.Duration)))
+		select {
+		case <-timer.C:
+			return
+		case <-s.trigger:
+			timer.Stop()
+			return
+		case <-s.reloaded:
+			timer.Stop()
+		}
+	}
+}
+
+func (s *server) config() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+func (s *server) sync() {
+	cfg := s.config()
+	ctx, cancel := syncContext(cfg)
+	defer cancel()
+
+	s.mu.Lock()
+	if cfg.DifferentialSync && s.clusters == nil {
+		s.clusters = newClusterCache()
+	}
+	cache := s.clusters
+	s.mu.Unlock()
+
+	started := time.Now()
+	inv, err := collectInventory(ctx, cfg, cache)
+	err = syncTimeoutError(ctx, cfg, err)
+	if err != nil {
+		log.Printf("Error collecting inventory: %v", err)
+		notifyFailure(ctx, cfg, err)
+		s.alerts.recordSync(ctx, cfg, err)
+		recordSyncMetrics(cfg, nil, err, time.Since(started))
+		return
+	}
+
+	s.mu.Lock()
+	prev := s.inventory
+	events := newSyncEvents(prev, inv)
+	s.inventory = inv
+	if events != nil {
+		s.events = events
+	}
+	s.mu.Unlock()
+
+	if events != nil {
+		log.Printf("Detected %d changes since the previous sync", len(events.Events))
+	}
+	err = syncTimeoutError(ctx, cfg, publishProfiles(ctx, cfg, prev, inv))
+	if err != nil {
+		log.Printf("Error updating ConfigMaps: %v", err)
+	} else if err = syncTimeoutError(ctx, cfg, propagateProjectMetadata(ctx, cfg, inv)); err != nil {
+		log.Printf("Error propagating project metadata, retried with the next sync: %v", err)
+	}
+	if err != nil {
+		notifyFailure(ctx, cfg, err)
+	}
+	s.alerts.recordSync(ctx, cfg, err)
+	recordSyncMetrics(cfg, inv, err, time.Since(started))
+	if err := notifyWebhook(ctx, cfg, events); err != nil {
+		log.Printf("Error posting change events to webhook: %v", err)
+	}
+	if err := notifyTeams(ctx, cfg, events); err != nil {
+		log.Printf("Error posting change events to Teams: %v", err)
+	}
+	s.email(cfg, inv)
+}
+
+// email sends the report email once the email interval has passed since
+// the last one, listing the changes since then. The first email is sent
+// one interval after startup.
+func (s *server) email(cfg *Config, inv *Inventory) {
+	if !cfg.Email.enabled() {
+		return
+	}
+	if s.emailed == nil {
+		s.emailed = inv
+		return
+	}
+	if inv.GeneratedAt.Sub(s.emailed.GeneratedAt) < cfg.Email.Interval.Duration {
+		return
+	}
+
+	if err := sendReportEmail(cfg, inv, newSyncEvents(s.emailed, inv)); err != nil {
+		log.Printf("Error sending report email: %v", err)
+		return
+	}
+	s.emailed = inv
+}
+
+func (s *server) latest() *Inventory {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.inventory
+}
+
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleInventory serves the inventory of the latest sync as JSON, along
+// with its staleness and the Rancher URL in use. Clients can poll it with
+// conditional requests.
+func (s *server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	inv := scopeInventory(s.latest(), requestTenant(r))
+	if inv == nil {
+		http.Error(w, "inventory not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	version, err := json.Marshal(inv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfg := s.config()
+	body, err := json.Marshal(struct {
+		*Inventory
+		Staleness       *Staleness             `json:"staleness"`
+		RancherEndpoint *RancherEndpointStatus `json:"rancherEndpoint,omitempty"`
+	}{inv, newStaleness(cfg, inv, time.Now()), rancherEndpointStatus(cfg.RancherURL)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveSnapshot(w, r, "application/json", inv.GeneratedAt, version, append(body, '\n'))
+}
+
+// handleReport serves the summary report of the latest sync. The format
+// defaults to the configured report format and can be overridden with the
+// format query parameter.
+func (s *server) handleReport(w http.ResponseWriter, r *http.Request) {
+	inv := scopeInventory(s.latest(), requestTenant(r))
+	if inv == nil {
+		http.Error(w, "inventory not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = s.config().ReportFormat
+	}
+
+	report, err := renderReport(inv, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serveSnapshot(w, r, reportContentType(format), inv.GeneratedAt, report, report)
+}
+
+// handleEvents serves the change events of the latest sync.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	events := scopeEvents(s.events, s.inventory, requestTenant(r))
+	s.mu.RUnlock()
+	if events == nil {
+		http.Error(w, "no changes recorded yet, events are available from the second sync on", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
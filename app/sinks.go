@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// sinkPayload is what a sink writes for one ConfigMap target: the
+// inventory and change events, and the rendered keys for the object
+// stores, which upload them as they are written to the ConfigMap.
+type sinkPayload struct {
+	Inventory *Inventory        `json:"inventory"`
+	Events    *SyncEvents       `json:"events,omitempty"`
+	Rendered  map[string]string `json:"rendered,omitempty"`
+}
+
+// sink is an output written after the ConfigMap.
+type sink struct {
+	// name identifies the sink in the run report, metrics and dead
+	// letters, title in errors.
+	name  string
+	title string
+	// rendered is whether the sink writes the rendered keys.
+	rendered bool
+	enabled  func(cfg *Config) bool
+	write    func(ctx context.Context, cfg *Config, p *sinkPayload) error
+}
+
+// sinks are written in this order. The object stores retry every object
+// on their own; Redis and MQTT retry the whole write.
+var sinks = []sink{
+	{
+		name: "gcs", title: "GCS", rendered: true,
+		enabled: func(cfg *Config) bool { return cfg.GCS.enabled() },
+		write: func(ctx context.Context, cfg *Config, p *sinkPayload) error {
+			return uploadToGCS(ctx, cfg, p.Rendered)
+		},
+	},
+	{
+		name: "azureBlob", title: "Azure Blob", rendered: true,
+		enabled: func(cfg *Config) bool { return cfg.AzureBlob.enabled() },
+		write: func(ctx context.Context, cfg *Config, p *sinkPayload) error {
+			return uploadToAzureBlob(ctx, cfg, p.Inventory.GeneratedAt, p.Rendered)
+		},
+	},
+	{
+		name: "redis", title: "Redis",
+		enabled: func(cfg *Config) bool { return cfg.Redis.enabled() },
+		write: func(ctx context.Context, cfg *Config, p *sinkPayload) error {
+			return withRetry(ctx, func() error { return writeToRedis(cfg, p.Inventory, p.Events) })
+		},
+	},
+	{
+		name: "mqtt", title: "MQTT",
+		enabled: func(cfg *Config) bool { return cfg.MQTT.enabled() },
+		write: func(ctx context.Context, cfg *Config, p *sinkPayload) error {
+			return withRetry(ctx, func() error { return publishToMQTT(cfg, p.Inventory, p.Events) })
+		},
+	},
+}
+
+func findSink(name string) *sink {
+	for i := range sinks {
+		if sinks[i].name == name {
+			return &sinks[i]
+		}
+	}
+	return nil
+}
+
+// writeSinks writes the payload to every enabled sink. A failing sink
+// does not keep the others from being written; once its retries are
+// exhausted the payload is saved as a dead letter, when enabled.
+func writeSinks(ctx context.Context, cfg *Config, p *sinkPayload) error {
+	target := cfg.Namespace + "/" + cfg.ConfigMapName
+	var errs []error
+	for _, s := range sinks {
+		if !s.enabled(cfg) {
+			continue
+		}
+		started := time.Now()
+		err := recordSink(cfg, s.name, target, started, s.write(ctx, cfg, p))
+		if err == nil {
+			continue
+		}
+		log.Printf("Error writing to the %s sink: %v", s.title, err)
+		errs = append(errs, fmt.Errorf("%s sink: %w", s.title, err))
+		if cfg.DeadLetterDir == "" {
+			continue
+		}
+		path, dlErr := writeDeadLetter(cfg, s, p, err)
+		if dlErr != nil {
+			log.Printf("Error saving the dead letter of the %s sink: %v", s.title, dlErr)
+			continue
+		}
+		metrics.addCounter("scriba_dead_letters_total", "Sink payloads saved as dead letters after their retries were exhausted.", 1, cfg.metricLabels("sink", s.name)...)
+		log.Printf("Saved the %s payload of %s to %s, run scriba replay to retry it", s.title, target, path)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsDConfig configures pushing the sync metrics and inventory counts to
+// a StatsD server or a Datadog agent (DogStatsD), for environments without
+// Prometheus scraping.
+type StatsDConfig struct {
+	// Addr is the host:port the metrics are sent to over UDP.
+	Addr   string `json:"addr,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Tags are added to every metric as DogStatsD tags, e.g. env:prod.
+	// Plain StatsD has no tags; setting any selects the DogStatsD format.
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (s *StatsDConfig) enabled() bool {
+	return s.Addr != ""
+}
+
+func validateStatsD(s *StatsDConfig) error {
+	if !s.enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(s.Addr); err != nil {
+		return fmt.Errorf("invalid StatsD address %q: %w", s.Addr, err)
+	}
+	return nil
+}
+
+// statsdMetric is one metric line: name, value and StatsD type (c, g or
+// ms).
+type statsdMetric struct {
+	name  string
+	value float64
+	typ   string
+}
+
+// sendStatsD sends metrics to the StatsD server, several per datagram.
+// Errors are logged; metrics are best effort like UDP itself.
+func sendStatsD(s *StatsDConfig, metrics []statsdMetric) {
+	conn, err := net.DialTimeout("udp", s.Addr, 5*time.Second)
+	if err != nil {
+		log.Printf("Error sending StatsD metrics to %s: %v", s.Addr, err)
+		return
+	}
+	defer conn.Close()
+
+	// Stay below the common 1432 byte limit of a datagram over Ethernet.
+	var packet strings.Builder
+	flush := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := conn.Write([]byte(packet.String())); err != nil {
+			log.Printf("Error sending StatsD metrics to %s: %v", s.Addr, err)
+		}
+		packet.Reset()
+	}
+	for _, m := range metrics {
+		line := s.Prefix + m.name + ":" + strconv.FormatFloat(m.value, 'f', -1, 64) + "|" + m.typ
+		if len(s.Tags) > 0 {
+			line += "|#" + strings.Join(s.Tags, ",")
+		}
+		if packet.Len() > 0 && packet.Len()+1+len(line) > 1432 {
+			flush()
+		}
+		if packet.Len() > 0 {
+			packet.WriteString("\n")
+		}
+		packet.WriteString(line)
+	}
+	flush()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SteveResource collects a Kubernetes resource type through Rancher's
+// steve (/v1) API, from the management cluster or from every downstream
+// cluster. Config file only.
+type SteveResource struct {
+	// Name is the collector's name in the output.
+	Name string `json:"name"`
+	// Type is the steve type, e.g. apps.deployments or
+	// management.cattle.io.settings, as listed at /v1/schemas.
+	Type string `json:"type"`
+	// Namespace and LabelSelector restrict the objects listed.
+	Namespace     string `json:"namespace,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// Scope is management (the default) for the Rancher management
+	// cluster, whose objects are Rancher-wide, or clusters for the
+	// downstream clusters of the inventory, those matching ClusterSelector
+	// when set.
+	Scope           string `json:"scope,omitempty"`
+	ClusterSelector string `json:"clusterSelector,omitempty"`
+	// Fields are the dot-separated paths recorded besides the metadata,
+	// e.g. spec.replicas.
+	Fields []string `json:"fields,omitempty"`
+}
+
+const (
+	steveScopeManagement = "management"
+	steveScopeClusters   = "clusters"
+)
+
+// steveDeniedTypes are never collected: their objects are secret.
+var steveDeniedTypes = []string{"secret", "secrets", "management.cattle.io.token", "management.cattle.io.tokens"}
+
+func validateSteveResources(resources []SteveResource) error {
+	seen := make(map[string]bool)
+	names := collectorNames()
+	for _, r := range resources {
+		if errs := validation.IsDNS1123Label(r.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid steve resource name %q: %s", r.Name, errs[0])
+		}
+		if seen[r.Name] || containsString(names, r.Name) {
+			return fmt.Errorf("steve resource %s: the collector name is already taken", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Type == "" {
+			return fmt.Errorf("steve resource %s needs a type", r.Name)
+		}
+		if containsString(steveDeniedTypes, strings.ToLower(r.Type)) {
+			return fmt.Errorf("steve resource %s: %s cannot be collected", r.Name, r.Type)
+		}
+		if r.Scope != "" && r.Scope != steveScopeManagement && r.Scope != steveScopeClusters {
+			return fmt.Errorf("steve resource %s: unknown scope %q (expected %s or %s)", r.Name, r.Scope, steveScopeManagement, steveScopeClusters)
+		}
+		if r.ClusterSelector != "" && r.Scope != steveScopeClusters {
+			return fmt.Errorf("steve resource %s: a cluster selector requires the %s scope", r.Name, steveScopeClusters)
+		}
+		if _, err := labels.Parse(r.LabelSelector); err != nil {
+			return fmt.Errorf("steve resource %s: invalid label selector: %w", r.Name, err)
+		}
+		if _, err := labels.Parse(r.ClusterSelector); err != nil {
+			return fmt.Errorf("steve resource %s: invalid cluster selector: %w", r.Name, err)
+		}
+		for _, field := range r.Fields {
+			if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") {
+				return fmt.Errorf("steve resource %s: invalid field %q", r.Name, field)
+			}
+		}
+	}
+	return nil
+}
+
+// steveCollector is the Collector of a configured steve resource.
+type steveCollector struct {
+	resource    SteveResource
+	concurrency int
+}
+
+func (c steveCollector) Name() string { return c.resource.Name }
+
+// Collect lists the objects of the management cluster, or of the selected
+// downstream clusters concurrently. A downstream cluster that cannot be
+// listed, e.g. because it is disconnected or lacks the type, is skipped
+// with a warning rather than failing the sync.
+func (c steveCollector) Collect(ctx context.Context, client *RancherClient) ([]Document, error) {
+	r := c.resource
+	if r.Scope != steveScopeClusters {
+		objects, err := client.List(ctx, "/v1"+c.path())
+		if err != nil {
+			return nil, err
+		}
+		return c.documents("", objects), nil
+	}
+
+	var (
+		mu        sync.Mutex
+		documents []Document
+	)
+	var g errgroup.Group
+	g.SetLimit(c.concurrency)
+	for _, cluster := range client.Clusters {
+		if r.ClusterSelector != "" && !cluster.matchesSelector(r.ClusterSelector) {
+			continue
+		}
+		cluster := cluster
+		g.Go(func() error {
+			objects, err := client.List(ctx, "/k8s/clusters/"+cluster.ID+"/v1"+c.path())
+			if err != nil {
+				log.Printf("Warning: skipping cluster %s for steve resource %s: %v", cluster.ID, r.Name, err)
+				return nil
+			}
+			mu.Lock()
+			documents = append(documents, c.documents(cluster.ID, objects)...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
+	return documents, ctx.Err()
+}
+
+// path returns the steve path of the resource below /v1, with its
+// namespace and label selector.
+func (c steveCollector) path() string {
+	path := "/" + c.resource.Type
+	if c.resource.Namespace != "" {
+		path += "/" + c.resource.Namespace
+	}
+	if c.resource.LabelSelector != "" {
+		path += "?labelSelector=" + url.QueryEscape(c.resource.LabelSelector)
+	}
+	return path
+}
+
+// documents records the metadata and the configured fields of objects,
+// with the downstream cluster they were listed from. The rest of the
+// objects is left out, as it may be large or sensitive.
+func (c steveCollector) documents(clusterID string, objects []Document) []Document {
+	documents := make([]Document, 0, len(objects))
+	for _, object := range objects {
+		d := Document{}
+		if clusterID != "" {
+			d["clusterId"] = clusterID
+		}
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			for _, key := range []string{"name", "namespace", "labels", "creationTimestamp"} {
+				if value, ok := metadata[key]; ok {
+					d[key] = value
+				}
+			}
+		}
+		if len(c.resource.Fields) > 0 {
+			fields := make(map[string]interface{})
+			for _, field := range c.resource.Fields {
+				if value, ok := lookupField(object, field); ok {
+					fields[field] = value
+				}
+			}
+			d["fields"] = fields
+		}
+		documents = append(documents, d)
+	}
+	return documents
+}
+
+// lookupField returns the value at the dot-separated path in object.
+func lookupField(object map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = object
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
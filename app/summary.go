@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Summary holds the totals of an inventory, written to the summary key for
+// reporting without having to process the whole inventory.
+type Summary struct {
+	Clusters           int                 `json:"clusters"`
+	ClustersByProvider map[string]int      `json:"clustersByProvider"`
+	Projects           int                 `json:"projects"`
+	Nodes              int                 `json:"nodes"`
+	Capacity           corev1.ResourceList `json:"capacity,omitempty"`
+
+	// ClustersByAge counts the clusters by age bucket, see ageBuckets.
+	// ClustersDueForRefresh counts those older than a year running a
+	// Kubernetes release past its end of life.
+	ClustersByAge         map[string]int `json:"clustersByAge,omitempty"`
+	ClustersDueForRefresh int            `json:"clustersDueForRefresh"`
+}
+
+// summaryResources are the capacity resources totalled in the summary.
+var summaryResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+func summarize(inv *Inventory) Summary {
+	summary := Summary{
+		Clusters:           len(inv.Clusters),
+		ClustersByProvider: make(map[string]int),
+		Projects:           len(inv.Projects),
+	}
+
+	var capacity corev1.ResourceList
+	for _, cluster := range inv.Clusters {
+		provider := cluster.Provider
+		if provider == "" {
+			provider = "unknown"
+		}
+		summary.ClustersByProvider[provider]++
+		summary.Nodes += cluster.NodeCount
+		capacity = addResourceLists(capacity, cluster.Capacity)
+		if cluster.AgeDays != nil {
+			if summary.ClustersByAge == nil {
+				summary.ClustersByAge = make(map[string]int)
+			}
+			summary.ClustersByAge[ageBucket(*cluster.AgeDays)]++
+		}
+		if dueForRefresh(cluster) {
+			summary.ClustersDueForRefresh++
+		}
+	}
+
+	// Nodes listed by the nodes collector are more accurate than the counts
+	// Rancher keeps on the cluster.
+	if inv.Nodes != nil {
+		summary.Nodes = len(inv.Nodes)
+	}
+
+	for _, name := range summaryResources {
+		if quantity, ok := capacity[name]; ok {
+			if summary.Capacity == nil {
+				summary.Capacity = make(corev1.ResourceList)
+			}
+			summary.Capacity[name] = quantity
+		}
+	}
+	return summary
+}
+
+func renderSummary(inv *Inventory) (string, error) {
+	out, err := yaml.Marshal(summarize(inv))
+	if err != nil {
+		return "", fmt.Errorf("rendering summary: %w", err)
+	}
+	return string(out), nil
+}
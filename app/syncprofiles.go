@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SyncProfile is a named sync run by the same process as the other sync
+// profiles, e.g. against another Rancher server or with other filters,
+// schedule and sinks. Its settings have the keys of the config file and
+// override the top-level settings.
+type SyncProfile struct {
+	Name string `json:"name"`
+
+	settings json.RawMessage
+}
+
+// processSettings are the config file keys shared by all sync profiles of
+// a process: the serve API and the headers of the shared Rancher client.
+var processSettings = []string{"syncs", "listenAddress", "api", "proxy", "userAgent", "requestHeaders", "debugHTTP", "debugHTTPBody"}
+
+// UnmarshalJSON keeps every key but the name as the profile's settings.
+// They are checked against the config file keys when the profile's
+// configuration is assembled.
+func (p *SyncProfile) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if name, ok := fields["name"]; ok {
+		if err := json.Unmarshal(name, &p.Name); err != nil {
+			return fmt.Errorf("sync profile name: %w", err)
+		}
+		delete(fields, "name")
+	}
+	for _, key := range processSettings {
+		if _, ok := fields[key]; ok {
+			return fmt.Errorf("sync profile %s: %s applies to the whole process and cannot be set per sync profile", p.Name, key)
+		}
+	}
+
+	settings, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	p.settings = settings
+	return nil
+}
+
+// applySettings overlays the profile's settings onto cfg. Unknown keys are
+// rejected like in the config file.
+func (p SyncProfile) applySettings(cfg *Config) error {
+	if len(p.settings) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(p.settings))
+	dec.DisallowUnknownFields()
+	return dec.Decode(cfg)
+}
+
+func validateSyncProfiles(profiles []SyncProfile) error {
+	seen := make(map[string]bool)
+	for _, p := range profiles {
+		if errs := validation.IsDNS1123Label(p.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid sync profile name %q: %s", p.Name, errs[0])
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate sync profile %q", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// loadSyncProfiles assembles the configuration of every sync profile of
+// cfg from the same layers as cfg, with the profile's settings applied on
+// top.
+func loadSyncProfiles(cfg *Config, configMapData []byte) error {
+	owners := make(map[string]string)
+	propagators := make(map[string]string)
+	for _, p := range cfg.Syncs {
+		pcfg, err := parseConfigLayers(cfg.args, configMapData, p)
+		if err != nil {
+			return fmt.Errorf("sync profile %s: %w", p.Name, err)
+		}
+		pcfg.Syncs = nil
+
+		// Profiles writing the same ConfigMap would overwrite each
+		// other's inventory on every sync.
+		for _, op := range outputProfiles(pcfg) {
+			target := profileConfig(pcfg, op)
+			key := target.Namespace + "/" + target.ConfigMapName
+			if owner, ok := owners[key]; ok {
+				return fmt.Errorf("sync profiles %s and %s both write the ConfigMap %s", owner, p.Name, key)
+			}
+			owners[key] = p.Name
+		}
+
+		// Sync profiles of the same Rancher would reconcile the same
+		// namespaces, so only one of them may propagate.
+		if pcfg.Propagation.enabled() {
+			rancher := strings.TrimSuffix(pcfg.RancherURL, "/")
+			if owner, ok := propagators[rancher]; ok {
+				return fmt.Errorf("sync profiles %s and %s both propagate project metadata to the namespaces of %s; set propagation in one of them", owner, p.Name, rancher)
+			}
+			propagators[rancher] = p.Name
+		}
+		cfg.syncProfiles = append(cfg.syncProfiles, pcfg)
+	}
+	return nil
+}
+
+// syncConfigs returns the configurations of the sync profiles to run:
+// those of every sync profile, or only the selected one, or cfg itself
+// when no sync profiles are defined.
+func (c *Config) syncConfigs() ([]*Config, error) {
+	if len(c.syncProfiles) == 0 {
+		if c.SyncProfile != "" {
+			return nil, fmt.Errorf("sync profile %q selected but no sync profiles are defined", c.SyncProfile)
+		}
+		return []*Config{c}, nil
+	}
+	if c.SyncProfile == "" {
+		return c.syncProfiles, nil
+	}
+	if pcfg := c.syncProfileConfig(c.SyncProfile); pcfg != nil {
+		return []*Config{pcfg}, nil
+	}
+	return nil, fmt.Errorf("unknown sync profile %q", c.SyncProfile)
+}
+
+// syncProfileConfig returns the configuration of the named sync profile,
+// or nil when there is no such profile.
+func (c *Config) syncProfileConfig(name string) *Config {
+	for _, pcfg := range c.syncProfiles {
+		if pcfg.syncProfile == name {
+			return pcfg
+		}
+	}
+	return nil
+}
+
+// singleSyncConfig returns the configuration for commands working on one
+// inventory, which need a sync profile selected when several are defined.
+func (c *Config) singleSyncConfig() (*Config, error) {
+	configs, err := c.syncConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) > 1 {
+		return nil, errors.New("several sync profiles are defined, select one with --sync-profile")
+	}
+	return configs[0], nil
+}
+
+// metricLabels returns labels with the sync profile label prepended when
+// cfg belongs to a sync profile, so the metrics of the profiles run by one
+// process can be told apart.
+func (c *Config) metricLabels(labels ...string) []string {
+	if c.syncProfile == "" {
+		return labels
+	}
+	return append([]string{"profile", c.syncProfile}, labels...)
+}
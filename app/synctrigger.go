@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// triggerSync makes the sync loop start the next sync right away. Triggers
+// arriving while one is pending, or while a sync runs, are coalesced into
+// a single sync.
+func (s *server) triggerSync() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// handleSync triggers an immediate sync of the sync profile named by the
+// profile query parameter, or of every sync profile without one, e.g. for
+// a provisioning pipeline to refresh the inventory right after creating a
+// cluster. It responds once the sync is queued, not when it is done.
+//
+// Since every trigger costs a round of Rancher API requests, triggering
+// requires the API to be authenticated, and tenants may not trigger syncs.
+func handleSync(servers []*server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !servers[0].config().API.authEnabled() {
+			http.Error(w, "triggering syncs requires API authentication", http.StatusForbidden)
+			return
+		}
+
+		targets := servers
+		if name := r.URL.Query().Get("profile"); name != "" {
+			targets = nil
+			for _, s := range servers {
+				if s.config().syncProfile == name {
+					targets = append(targets, s)
+				}
+			}
+			if len(targets) == 0 {
+				http.Error(w, "unknown sync profile", http.StatusNotFound)
+				return
+			}
+		}
+
+		for _, s := range targets {
+			cfg := s.config()
+			if cfg.syncProfile != "" {
+				log.Printf("Sync of profile %s triggered through the API", cfg.syncProfile)
+			} else {
+				log.Println("Sync triggered through the API")
+			}
+			metrics.addCounter("scriba_sync_triggers_total", "Syncs triggered through the API.", 1, cfg.metricLabels()...)
+			s.triggerSync()
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("sync queued\n"))
+	}
+}
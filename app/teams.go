@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxTeamsEvents limits the change events listed in one Teams card; Teams
+// rejects messages larger than about 28 KB.
+const maxTeamsEvents = 50
+
+// teamsMessage is the payload of a Microsoft Teams incoming webhook
+// carrying one adaptive card.
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string          `json:"$schema"`
+	Type    string          `json:"type"`
+	Version string          `json:"version"`
+	Body    []cardTextBlock `json:"body"`
+}
+
+type cardTextBlock struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Size   string `json:"size,omitempty"`
+	Weight string `json:"weight,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Wrap   bool   `json:"wrap,omitempty"`
+}
+
+func newTeamsMessage(body []cardTextBlock) teamsMessage {
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: adaptiveCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    body,
+			},
+		}},
+	}
+}
+
+func cardTitle(text, color string) cardTextBlock {
+	return cardTextBlock{Type: "TextBlock", Text: text, Size: "Medium", Weight: "Bolder", Color: color, Wrap: true}
+}
+
+func cardText(text string) cardTextBlock {
+	return cardTextBlock{Type: "TextBlock", Text: text, Wrap: true}
+}
+
+// notifyTeams posts the change events of a sync as an adaptive card to the
+// configured Teams webhook. Syncs without changes are not posted.
+func notifyTeams(ctx context.Context, cfg *Config, events *SyncEvents) error {
+	if cfg.TeamsWebhookURL == "" || events == nil || len(events.Events) == 0 {
+		return nil
+	}
+
+	body := []cardTextBlock{
+		cardTitle(fmt.Sprintf("Rancher inventory: %d changes", len(events.Events)), ""),
+		cardText(fmt.Sprintf("Since %s", events.Since.Format(time.RFC1123))),
+	}
+	lines := eventLines(events.Events)
+	for i, line := range lines {
+		if i == maxTeamsEvents {
+			body = append(body, cardText(fmt.Sprintf("… and %d more", len(lines)-maxTeamsEvents)))
+			break
+		}
+		body = append(body, cardText("- "+line))
+	}
+	return postTeams(ctx, cfg.TeamsWebhookURL, newTeamsMessage(body))
+}
+
+// notifyTeamsFailure posts a failed sync to the configured Teams webhook.
+func notifyTeamsFailure(ctx context.Context, cfg *Config, syncErr error) error {
+	if cfg.TeamsWebhookURL == "" {
+		return nil
+	}
+
+	body := []cardTextBlock{
+		cardTitle("Rancher inventory sync failed", "Attention"),
+		cardText(fmt.Sprintf("Rancher: %s", cfg.RancherURL)),
+		cardText(syncErr.Error()),
+	}
+	return postTeams(ctx, cfg.TeamsWebhookURL, newTeamsMessage(body))
+}
+
+// notifyFailure reports a failed sync to the configured notification
+// targets.
+func notifyFailure(ctx context.Context, cfg *Config, syncErr error) {
+	if err := notifyTeamsFailure(ctx, cfg, syncErr); err != nil {
+		log.Printf("Error posting sync failure to Teams: %v", err)
+	}
+}
+
+func postTeams(ctx context.Context, url string, msg teamsMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, url, body)
+}
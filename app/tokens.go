@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// APIToken is the metadata of a Rancher API token. The token value is
+// never read into it.
+type APIToken struct {
+	ID          string `json:"id"`
+	UserID      string `json:"userId"`
+	Description string `json:"description,omitempty"`
+	// ClusterID is set for tokens scoped to a single cluster.
+	ClusterID string `json:"clusterId,omitempty"`
+	Created   string `json:"created,omitempty"`
+	// TTL and ExpiresAt are unset for tokens that never expire.
+	TTL        string `json:"ttl,omitempty"`
+	ExpiresAt  string `json:"expiresAt,omitempty"`
+	Expired    bool   `json:"expired"`
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+}
+
+// tokenExpiryWindow is how far ahead the report lists expiring tokens.
+const tokenExpiryWindow = 30 * 24 * time.Hour
+
+// getAPITokens lists the metadata of the API tokens visible to the
+// Rancher token.
+func getAPITokens(ctx context.Context, rancherAPIURL string, accessToken string) ([]APIToken, error) {
+	log.Println("Starting getAPITokens function")
+
+	var response struct {
+		Data []struct {
+			ID          string `json:"id"`
+			UserID      string `json:"userId"`
+			Description string `json:"description"`
+			ClusterID   string `json:"clusterId"`
+			Created     string `json:"created"`
+			// TTL is in milliseconds.
+			TTL        int64  `json:"ttl"`
+			ExpiresAt  string `json:"expiresAt"`
+			Expired    bool   `json:"expired"`
+			LastUsedAt string `json:"lastUsedAt"`
+		} `json:"data"`
+	}
+	if err := getRancherJSON(ctx, rancherAPIURL+"/tokens", accessToken, "tokens", &response); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]APIToken, 0, len(response.Data))
+	for _, item := range response.Data {
+		token := APIToken{
+			ID:          item.ID,
+			UserID:      item.UserID,
+			Description: item.Description,
+			ClusterID:   item.ClusterID,
+			Created:     item.Created,
+			ExpiresAt:   item.ExpiresAt,
+			Expired:     item.Expired,
+			LastUsedAt:  item.LastUsedAt,
+		}
+		if item.TTL > 0 {
+			token.TTL = (time.Duration(item.TTL) * time.Millisecond).String()
+		}
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+
+	log.Printf("Fetched %d tokens", len(tokens))
+	return tokens, nil
+}
+
+// reportToken is a token listed in the report with its expiry status.
+type reportToken struct {
+	APIToken
+	Status string
+}
+
+// expiringTokens returns the tokens that have expired or expire within
+// tokenExpiryWindow of now, soonest first.
+func expiringTokens(tokens []APIToken, now time.Time) []reportToken {
+	var expiring []reportToken
+	expiries := make(map[string]time.Time)
+	for _, token := range tokens {
+		expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+		if err != nil && !token.Expired {
+			continue
+		}
+		remaining := expiresAt.Sub(now)
+		switch {
+		case token.Expired || remaining <= 0:
+			expiring = append(expiring, reportToken{APIToken: token, Status: "expired"})
+		case remaining <= tokenExpiryWindow:
+			expiring = append(expiring, reportToken{APIToken: token, Status: fmt.Sprintf("expires in %d days", int(remaining.Hours()/24))})
+		default:
+			continue
+		}
+		expiries[token.ID] = expiresAt
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiries[expiring[i].ID].Before(expiries[expiring[j].ID])
+	})
+	return expiring
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errValidationFailed is returned by the validate command when at least one
+// check did not pass.
+var errValidationFailed = errors.New("validation failed")
+
+type checkResult struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+func runValidate(cfg *Config) error {
+	var results []checkResult
+	add := func(name string, detail string, err error) {
+		if err != nil {
+			results = append(results, checkResult{Name: name, Detail: err.Error()})
+			return
+		}
+		results = append(results, checkResult{Name: name, OK: true, Detail: detail})
+	}
+
+	detail, err := checkRancherReachable(cfg)
+	add("Rancher reachable", detail, err)
+
+	detail, err = checkRancherToken(cfg)
+	add("Rancher token valid", detail, err)
+
+	clientset, err := getTargetKubeClient(cfg)
+	if err == nil {
+		detail, err = checkKubernetesAPI(clientset)
+	}
+	add("Kubernetes API reachable", detail, err)
+
+	for _, p := range outputProfiles(cfg) {
+		verbs := []string{"get", "create", "update"}
+		if profileConfig(cfg, p).ConfigMapMode == configMapModePerProject {
+			// Project ConfigMaps of removed projects are listed and deleted.
+			verbs = append(verbs, "list", "delete")
+		}
+		for _, verb := range verbs {
+			if clientset == nil {
+				add("ConfigMap "+verb+" permitted", "", errors.New("no Kubernetes client"))
+				continue
+			}
+			detail, err = checkConfigMapAccess(profileConfig(cfg, p), clientset, verb)
+			add("ConfigMap "+verb+" permitted", detail, err)
+		}
+		if pcfg := profileConfig(cfg, p); pcfg.ConfigMapMode == configMapModeSingle && clientset != nil {
+			detail, err = checkConfigMapOwnership(pcfg)
+			add("ConfigMap writable by scriba", detail, err)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+	failed := false
+	for _, r := range results {
+		result := "PASS"
+		if !r.OK {
+			result = "FAIL"
+			failed = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, result, r.Detail)
+	}
+	w.Flush()
+
+	if failed {
+		return errValidationFailed
+	}
+	return nil
+}
+
+func rancherGet(cfg *Config, path string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", cfg.RancherURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := getRancherToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return getHttpClient().Do(req)
+}
+
+func checkRancherReachable(cfg *Config) (string, error) {
+	if cfg.RancherURL == "" {
+		return "", errors.New("RANCHER_SERVER_URL is not set")
+	}
+
+	start := time.Now()
+	resp, err := rancherGet(cfg, "/ping")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from %s/ping", resp.StatusCode, cfg.RancherURL)
+	}
+	return fmt.Sprintf("%s answered in %s", cfg.RancherURL, time.Since(start).Round(time.Millisecond)), nil
+}
+
+func checkRancherToken(cfg *Config) (string, error) {
+	if credentialSourceType(&cfg.CredentialSource) == credentialStatic && cfg.RancherToken == "" && !hasKeyringToken(cfg.RancherURL) {
+		return "", errors.New("RANCHER_TOKEN_KEY is not set, no token is stored by scriba login and no other credential source is configured")
+	}
+
+	resp, err := rancherGet(cfg, "/v3/users?me=true")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", errors.New("token rejected by Rancher")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from /v3/users", resp.StatusCode)
+	}
+
+	var users struct {
+		Data []struct {
+			Username string `json:"username"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return "", err
+	}
+	detail := "authenticated"
+	if len(users.Data) > 0 {
+		detail = "authenticated as " + users.Data[0].Username
+	}
+
+	expiry, err := tokenExpiry(cfg)
+	if err != nil {
+		return detail + ", expiry unknown: " + err.Error(), nil
+	}
+	return detail + ", " + expiry, nil
+}
+
+// tokenExpiry looks up the token's own object to report when it expires.
+// API keys have the form "<token name>:<secret>".
+func tokenExpiry(cfg *Config) (string, error) {
+	apiKey, err := getRancherToken(cfg)
+	if err != nil {
+		return "", err
+	}
+	name, _, ok := strings.Cut(apiKey, ":")
+	if !ok {
+		return "", errors.New("token is not in <name>:<secret> form")
+	}
+
+	resp, err := rancherGet(cfg, "/v3/tokens/"+name)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from /v3/tokens", resp.StatusCode)
+	}
+
+	var token struct {
+		Expired   bool   `json:"expired"`
+		ExpiresAt string `json:"expiresAt"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	switch {
+	case token.Expired:
+		return "", errors.New("token has expired")
+	case token.ExpiresAt == "":
+		return "never expires", nil
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+	if err != nil {
+		return "expires at " + token.ExpiresAt, nil
+	}
+	return fmt.Sprintf("expires at %s (in %s)", token.ExpiresAt, time.Until(expiresAt).Round(time.Hour)), nil
+}
+
+func checkKubernetesAPI(clientset *kubernetes.Clientset) (string, error) {
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return "server version " + version.GitVersion, nil
+}
+
+// checkConfigMapOwnership reports whether an existing output ConfigMap may
+// be written without --adopt.
+func checkConfigMapOwnership(cfg *Config) (string, error) {
+	cm, err := getConfigMap(cfg)
+	switch {
+	case err != nil:
+		return "", err
+	case cm == nil:
+		return "not created yet", nil
+	case cfg.KeyPrefix != "":
+		return "shared, keys prefixed with " + cfg.KeyPrefix, nil
+	case ownedByScriba(cm):
+		return "managed by rancher-scriba", nil
+	case cfg.Adopt:
+		return "will be adopted", nil
+	}
+	return "", claimConfigMap(cm, false)
+}
+
+func checkConfigMapAccess(cfg *Config, clientset *kubernetes.Clientset, verb string) (string, error) {
+	attrs := &authorizationv1.ResourceAttributes{
+		Namespace: cfg.Namespace,
+		Verb:      verb,
+		Resource:  "configmaps",
+	}
+	// create and list cannot be scoped to a resource name, and per-project
+	// ConfigMaps have names of their own.
+	if verb != "create" && verb != "list" && cfg.ConfigMapMode != configMapModePerProject {
+		attrs.Name = cfg.ConfigMapName
+	}
+
+	target := cfg.Namespace
+	if attrs.Name != "" {
+		target += "/" + attrs.Name
+	}
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attrs},
+	}
+	review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	if !review.Status.Allowed {
+		err := fmt.Errorf("%s on configmaps in %s denied", verb, target)
+		if review.Status.Reason != "" {
+			err = fmt.Errorf("%w: %s", err, review.Status.Reason)
+		}
+		return "", err
+	}
+	return target, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultClient reads the Rancher token from a Vault KV secret, logging in
+// with the pod's service account through Vault's Kubernetes auth method.
+type vaultClient struct {
+	cfg    *VaultSource
+	client *http.Client
+}
+
+func newVaultTokenSource(cfg *VaultSource) (*refreshingTokenSource, error) {
+	if cfg.Role == "" {
+		return nil, fmt.Errorf("a Vault role is required to read %s", cfg.SecretPath)
+	}
+
+	tlsConfig := &tls.Config{}
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	v := &vaultClient{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+			Timeout:   30 * time.Second,
+		},
+	}
+	return &refreshingTokenSource{store: "Vault", refresh: cfg.Refresh.Duration, fetch: v.fetch}, nil
+}
+
+func (v *vaultClient) fetch() (string, error) {
+	log.Printf("Reading Rancher token from Vault path %s", v.cfg.SecretPath)
+
+	jwt, err := os.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		return "", fmt.Errorf("reading service account token for Vault login: %w", err)
+	}
+
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	body, _ := json.Marshal(map[string]string{"role": v.cfg.Role, "jwt": strings.TrimSpace(string(jwt))})
+	if err := v.do("POST", "auth/"+v.cfg.AuthPath+"/login", "", body, &login); err != nil {
+		return "", fmt.Errorf("Vault Kubernetes login: %w", err)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.do("GET", v.cfg.SecretPath, login.Auth.ClientToken, nil, &secret); err != nil {
+		return "", fmt.Errorf("reading Vault secret %s: %w", v.cfg.SecretPath, err)
+	}
+
+	// KV version 2 nests the secret's fields in another data object.
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		fields = nested
+	}
+	return tokenFromFields(fields)
+}
+
+// tokenFromFields extracts the Rancher token from a secret, either as a
+// single token field or as an access key and secret key pair.
+func tokenFromFields(fields map[string]interface{}) (string, error) {
+	str := func(name string) string {
+		s, _ := fields[name].(string)
+		return s
+	}
+
+	if token := str("token"); token != "" {
+		return token, nil
+	}
+	if accessKey, secretKey := str("accessKey"), str("secretKey"); accessKey != "" && secretKey != "" {
+		return accessKey + ":" + secretKey, nil
+	}
+	return "", fmt.Errorf("secret has neither a token field nor accessKey and secretKey fields")
+}
+
+func (v *vaultClient) do(method, path, vaultToken string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.cfg.Addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if vaultToken != "" {
+		req.Header.Set("X-Vault-Token", vaultToken)
+	}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from Vault: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
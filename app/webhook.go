@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	webhookClient     *http.Client
+	webhookClientOnce sync.Once
+)
+
+func getWebhookClient() *http.Client {
+	webhookClientOnce.Do(func() {
+		webhookClient = &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+			Timeout:   30 * time.Second,
+		}
+	})
+	return webhookClient
+}
+
+// notifyWebhook posts the change events of a sync as JSON to the
+// configured webhook. Syncs without changes are not posted.
+func notifyWebhook(ctx context.Context, cfg *Config, events *SyncEvents) error {
+	if cfg.WebhookURL == "" || events == nil || len(events.Events) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, cfg.WebhookURL, body)
+}
+
+// postJSON posts body to target, retrying on failure.
+func postJSON(ctx context.Context, target string, body []byte) error {
+	return postJSONHeader(ctx, target, nil, body)
+}
+
+// notifyTimeout bounds the notifications sent once the sync's context
+// expired, so the failure of a sync that ran out of time is still
+// reported without stalling the next one.
+const notifyTimeout = 30 * time.Second
+
+// notifyContext returns the context of a notification of the sync of
+// ctx: ctx itself while it is live, or a short budget of its own.
+func notifyContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() != nil {
+		return context.WithTimeout(context.Background(), notifyTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// postJSONHeader posts body to target with additional request headers,
+// retrying on failure until ctx expires. Errors only name the host of target, as webhook
+// URLs such as those of Teams carry their secret in the path.
+func postJSONHeader(ctx context.Context, target string, header http.Header, body []byte) error {
+	ctx, cancel := notifyContext(ctx)
+	defer cancel()
+	return withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("invalid URL: %w", withoutURL(err))
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := getWebhookClient().Do(req)
+		if err != nil {
+			return fmt.Errorf("posting to %s: %w", req.URL.Host, withoutURL(err))
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status code from %s: %d", req.URL.Host, resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// withoutURL strips the URL from the errors of net/url and net/http, which
+// quote it in full.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}